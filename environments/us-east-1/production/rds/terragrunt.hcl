@@ -37,16 +37,15 @@ inputs = {
   # allowed_security_groups is left empty - ECS module will create ingress rules
   allowed_security_groups = []
   
-  # Database configuration - larger for production
-  db_engine                 = "postgres"
-  db_engine_version         = "15.4"
-  db_instance_class         = "db.t3.medium"  # Larger instance for production
-  db_parameter_group_family = "postgres15"
+  # Database configuration - larger for production. port and
+  # db_parameter_group_family default to the values of the engine.
+  engine         = "postgres"
+  engine_version = "15.4"
+  instance_class = "db.t3.medium"  # Larger instance for production
   
-  db_name     = "gogsapp"
-  db_username = get_env("TF_VAR_db_username", "admin")
-  db_password = get_env("TF_VAR_db_password", "CHANGE_ME_IN_CI")
-  db_port     = 5432
+  db_name  = "gogsapp"
+  username = get_env("TF_VAR_db_username", "admin")
+  password = get_env("TF_VAR_db_password", "CHANGE_ME_IN_CI")
   
   # Storage configuration - larger for production
   allocated_storage     = 50
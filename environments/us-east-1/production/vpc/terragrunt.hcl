@@ -27,5 +27,18 @@ inputs = {
   
   availability_zones = local.region_vars.locals.availability_zones
   
-  enable_nat_gateway = true
+  # One NAT gateway per zone, so losing a zone does not cut egress for the
+  # private subnets of the other zones
+  nat_gateway_mode = "per_az"
+
+  # Keep image pulls, logs and secret retrieval of private tasks off the
+  # NAT gateways
+  gateway_endpoints   = ["s3"]
+  interface_endpoints = ["secretsmanager", "ecr.api", "ecr.dkr", "logs", "kms"]
+
+  # Flow logs go to S3 as Parquet with Hive partitions for Athena
+  flow_log_destination_type           = "s3"
+  flow_log_file_format                = "parquet"
+  flow_log_hive_compatible_partitions = true
+  flow_log_retention_in_days          = 365
 }
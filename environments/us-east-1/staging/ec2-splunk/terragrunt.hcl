@@ -30,16 +30,6 @@ dependency "vpc" {
   mock_outputs_allowed_terraform_commands = ["validate", "plan"]
 }
 
-dependency "ecs" {
-  config_path = "../ecs"
-  
-  # Mock outputs for plan without apply
-  mock_outputs = {
-    ecs_security_group_id = "sg-mock12345"
-  }
-  mock_outputs_allowed_terraform_commands = ["validate", "plan"]
-}
-
 dependency "secrets_manager" {
   config_path = "../secrets-manager"
   
@@ -69,8 +59,7 @@ inputs = {
   data_volume_type = "gp3"
   
   # Network access
-  allowed_cidr_blocks    = [get_env("TF_VAR_allowed_cidr", "0.0.0.0/0")]  # Restrict in production!
-  ecs_security_group_ids = [dependency.ecs.outputs.ecs_security_group_id]
+  allowed_cidr_blocks = [get_env("TF_VAR_allowed_cidr", "0.0.0.0/0")]  # Restrict in production!
   
   # SSH access - must be explicitly set for security
   enable_ssh      = true
@@ -38,6 +38,7 @@ dependency "secrets_manager" {
     all_secret_arns      = ["arn:aws:secretsmanager:us-east-1:123456789:secret:mock"]
     database_secret_arn  = "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-db"
     application_secret_arn = "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-app"
+    splunk_secret_arn      = "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-splunk"
   }
   mock_outputs_allowed_terraform_commands = ["validate", "plan"]
 }
@@ -55,6 +56,17 @@ dependency "rds" {
   mock_outputs_allowed_terraform_commands = ["validate", "plan"]
 }
 
+dependency "ec2_splunk" {
+  config_path = "../ec2-splunk"
+  
+  # Mock outputs for plan without apply
+  mock_outputs = {
+    splunk_hec_private_endpoint  = "https://10.0.1.10:8088"
+    hec_client_security_group_id = "sg-mockhec"
+  }
+  mock_outputs_allowed_terraform_commands = ["validate", "plan"]
+}
+
 # Module-specific inputs
 inputs = {
   aws_region         = local.region_vars.locals.aws_region
@@ -121,4 +133,72 @@ inputs = {
   min_capacity       = 1
   max_capacity       = 2
   cpu_target_value   = 70
+
+  # Gogs load is request-bound, so scale on ALB requests per task as well as
+  # CPU
+  scaling_policies = [
+    { name = "cpu", type = "cpu" },
+    { name = "requests", type = "requests", target_value = 500 },
+  ]
+
+  # Scale to zero on weeknights and weekends; Friday's stop lasts until
+  # Monday morning
+  scaling_windows = [
+    {
+      name         = "off-hours"
+      start        = "cron(0 20 ? * MON-FRI *)"
+      end          = "cron(0 7 ? * MON-FRI *)"
+      timezone     = "UTC"
+      min_capacity = 0
+      max_capacity = 0
+    },
+  ]
+
+  # Roll back deployments whose tasks fail to start or stay unhealthy, and
+  # fail the apply when that happens
+  wait_for_steady_state = true
+
+  # Keep the Gogs data directory, including the git repositories, on EFS so
+  # that it survives task replacements. The gogs image runs as uid/gid 1000.
+  efs_storage = {
+    container_path = "/data"
+    root_directory = "/gogs"
+    posix_user     = { uid = 1000, gid = 1000 }
+  }
+
+  # Ship the application logs to Splunk through a Fluent Bit FireLens
+  # sidecar; the HEC client security group lets the tasks reach Splunk
+  log_driver = "splunk"
+  splunk_log_routing = {
+    hec_endpoint         = dependency.ec2_splunk.outputs.splunk_hec_private_endpoint
+    hec_token_secret_arn = dependency.secrets_manager.outputs.splunk_secret_arn
+  }
+  task_security_group_ids = [dependency.ec2_splunk.outputs.hec_client_security_group_id]
+
+  # Allow aws ecs execute-command shells into the staging tasks. Sessions are
+  # encrypted and logged with a key created by the module.
+  enable_execute_command = true
+
+  # Keep idle git clones and pushes over HTTP open while the server packs
+  # objects, and keep the ALB access logs to investigate slow or failed
+  # requests
+  alb_idle_timeout                  = 600
+  enable_alb_access_logs            = true
+  alb_access_logs_retention_in_days = 30
+
+  # WAF on the ALB: rate limit the Gogs login form and API per IP, which get
+  # brute-forced, and block known bad requests. The managed rule groups are
+  # the defaults; the common group only counts large bodies, as git pushes
+  # over HTTP send them.
+  waf = {
+    rate_limits = [
+      { name = "login", limit = 100, path_prefix = "/user/login" },
+      { name = "api", limit = 1000, path_prefix = "/api/" },
+    ]
+    logging = { destination = "cloudwatch" }
+  }
+
+  # HTTPS listener - set TF_VAR_acm_certificate_arn to serve HTTPS and
+  # redirect HTTP to it with a 301
+  acm_certificate_arn = get_env("TF_VAR_acm_certificate_arn", null)
 }
@@ -36,18 +36,17 @@ inputs = {
   
   # allowed_security_groups is left empty - ECS module will create ingress rules
   allowed_security_groups = []
-  allowed_security_groups = []
   
-  # Database configuration
-  db_engine                 = "postgres"
-  db_engine_version         = "15.4"
-  db_instance_class         = "db.t3.micro"  # Small instance for staging
-  db_parameter_group_family = "postgres15"
+  # Database configuration. port and db_parameter_group_family default to
+  # the values of the engine; switching engine only needs engine and
+  # engine_version.
+  engine         = "postgres"
+  engine_version = "15.4"
+  instance_class = "db.t3.micro"  # Small instance for staging
   
-  db_name     = "gogsapp"
-  db_username = get_env("TF_VAR_db_username", "admin")
-  db_password = get_env("TF_VAR_db_password", "CHANGE_ME_IN_CI")
-  db_port     = 5432
+  db_name  = "gogsapp"
+  username = get_env("TF_VAR_db_username", "admin")
+  password = get_env("TF_VAR_db_password", "CHANGE_ME_IN_CI")
   
   # Storage configuration
   allocated_storage     = 20
@@ -64,4 +63,12 @@ inputs = {
   performance_insights_enabled = true
   monitoring_interval          = 60
   auto_minor_version_upgrade   = true
+
+  # Stop the database on weeknights and weekends, and start it before the ECS
+  # service scales back up
+  scheduled_stop = {
+    stop     = "cron(0 20 ? * MON-FRI *)"
+    start    = "cron(30 6 ? * MON-FRI *)"
+    timezone = "UTC"
+  }
 }
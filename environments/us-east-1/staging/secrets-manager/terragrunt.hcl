@@ -40,7 +40,7 @@ inputs = {
   # Splunk credentials - must be set via environment variables
   create_splunk_secret  = true
   splunk_admin_password = get_env("TF_VAR_splunk_admin_password", "validation_splunk_admin_CHANGE_IN_PRODUCTION")
-  splunk_hec_token      = get_env("TF_VAR_splunk_hec_token", "validation_hec_token_CHANGE_IN_PRODUCTION")
+  splunk_hec_token      = get_env("TF_VAR_splunk_hec_token", "00000000-0000-0000-0000-000000000000") # placeholder UUID
   
   # DockerHub credentials (optional)
   create_dockerhub_secret = false
@@ -26,5 +26,12 @@ inputs = {
   
   availability_zones = local.region_vars.locals.availability_zones
   
-  enable_nat_gateway = true
+  nat_gateway_mode = "single"
+
+  # ECR image layers are served from S3; the gateway endpoint is free
+  gateway_endpoints = ["s3"]
+
+  # Flow logs stay in CloudWatch Logs for ad-hoc queries
+  flow_log_destination_type  = "cloud-watch-logs"
+  flow_log_retention_in_days = 7
 }
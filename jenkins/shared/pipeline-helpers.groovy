@@ -94,6 +94,57 @@ def runTerragruntApply(envPath, moduleOrder) {
     echo "════════════════════════════════════════\\n"
 }
 
+/**
+ * Start a CodeDeploy blue/green deployment of the ECS task definition when the
+ * ecs module runs in blue/green mode and the service runs another revision.
+ * Terraform registers new task definitions but does not deploy them in this
+ * mode. Waits for the deployment; CodeDeploy rolls it back on failure.
+ * @param envPath Path to environment directory
+ */
+def runCodeDeployDeployment(envPath) {
+    def modulePath = "${envPath}/ecs"
+
+    sh """
+        cd ${modulePath}
+        OUTPUTS=\$(terragrunt output -json)
+        DEPLOYMENT=\$(echo "\$OUTPUTS" | jq -c '.blue_green_deployment.value')
+        if [ "\$DEPLOYMENT" = "null" ]; then
+            echo "ℹ️ [ecs] Rolling deployments, no CodeDeploy deployment needed"
+            exit 0
+        fi
+
+        TASK_DEFINITION=\$(echo "\$OUTPUTS" | jq -r '.task_definition_arn.value')
+        CLUSTER=\$(echo "\$OUTPUTS" | jq -r '.cluster_name.value')
+        SERVICE=\$(echo "\$OUTPUTS" | jq -r '.service_name.value')
+        RUNNING=\$(aws ecs describe-services --cluster "\$CLUSTER" --services "\$SERVICE" --query 'services[0].taskDefinition' --output text)
+        if [ "\$RUNNING" = "\$TASK_DEFINITION" ]; then
+            echo "ℹ️ [ecs] \$SERVICE already runs \$TASK_DEFINITION"
+            exit 0
+        fi
+
+        APPSPEC=\$(echo "\$DEPLOYMENT" | jq -c --arg td "\$TASK_DEFINITION" '{
+            version: 0.0,
+            Resources: [{TargetService: {Type: "AWS::ECS::Service", Properties: {
+                TaskDefinition: \$td,
+                LoadBalancerInfo: {ContainerName: .container_name, ContainerPort: .container_port},
+                NetworkConfiguration: {AwsvpcConfiguration: {Subnets: .subnets, SecurityGroups: .security_groups, AssignPublicIp: "DISABLED"}}
+            }}}]
+        }')
+        REVISION=\$(jq -cn --arg content "\$APPSPEC" '{revisionType: "AppSpecContent", appSpecContent: {content: \$content}}')
+
+        DEPLOYMENT_ID=\$(aws deploy create-deployment \
+            --application-name "\$(echo "\$DEPLOYMENT" | jq -r '.application_name')" \
+            --deployment-group-name "\$(echo "\$DEPLOYMENT" | jq -r '.deployment_group_name')" \
+            --revision "\$REVISION" \
+            --query deploymentId --output text)
+        echo "🚀 [ecs] CodeDeploy deployment \$DEPLOYMENT_ID of \$TASK_DEFINITION started"
+
+        aws deploy wait deployment-successful --deployment-id "\$DEPLOYMENT_ID"
+    """
+
+    echo "✅ [ecs] Deployment completed successfully"
+}
+
 //==============================================================================
 // Terraform Cloud API Functions (Deprecated - Only for reference)
 //==============================================================================
@@ -71,6 +71,8 @@ resource "aws_iam_role" "splunk" {
 resource "aws_iam_instance_profile" "splunk" {
   name = "${var.project_name}-${var.environment}-splunk-profile"
   role = aws_iam_role.splunk.name
+
+  tags = var.tags
 }
 
 # Policy for CloudWatch Logs access
@@ -164,7 +166,7 @@ resource "aws_security_group" "splunk" {
     from_port       = 8088
     to_port         = 8088
     protocol        = "tcp"
-    security_groups = var.ecs_security_group_ids
+    security_groups = concat(var.ecs_security_group_ids, [aws_security_group.hec_clients.id])
   }
 
   # SSH access (restricted)
@@ -191,6 +193,18 @@ resource "aws_security_group" "splunk" {
   })
 }
 
+# Attached to the senders of HEC events, such as the ECS tasks, so that they
+# do not have to exist before Splunk
+resource "aws_security_group" "hec_clients" {
+  name        = "${var.project_name}-${var.environment}-splunk-hec-clients-sg"
+  description = "Senders of Splunk HEC events"
+  vpc_id      = var.vpc_id
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-splunk-hec-clients-sg"
+  })
+}
+
 #------------------------------------------------------------------------------
 # EC2 Key Pair (optional)
 #------------------------------------------------------------------------------
@@ -244,6 +258,11 @@ resource "aws_instance" "splunk" {
     delete_on_termination = true
     encrypted             = true
     kms_key_id            = var.kms_key_id
+
+    # Provider default_tags do not propagate to the root volume
+    tags = merge(var.tags, {
+      Name = "${var.project_name}-${var.environment}-splunk-root"
+    })
   }
 
   # Enable EBS optimization for better performance
@@ -52,6 +52,16 @@ output "splunk_hec_endpoint" {
   value       = "https://${var.create_elastic_ip ? aws_eip.splunk[0].public_ip : aws_instance.splunk.private_ip}:8088"
 }
 
+output "splunk_hec_private_endpoint" {
+  description = "Splunk HEC endpoint URL on the private IP, for senders inside the VPC"
+  value       = "https://${aws_instance.splunk.private_ip}:8088"
+}
+
+output "hec_client_security_group_id" {
+  description = "Security group ID that allows HEC senders to reach Splunk"
+  value       = aws_security_group.hec_clients.id
+}
+
 output "data_volume_id" {
   description = "EBS data volume ID (for Ansible to mount at /opt/splunk)"
   value       = aws_ebs_volume.splunk_data.id
@@ -81,7 +81,7 @@ variable "allowed_cidr_blocks" {
 }
 
 variable "ecs_security_group_ids" {
-  description = "Security group IDs of ECS tasks that send logs to Splunk"
+  description = "Security group IDs of ECS tasks that send logs to Splunk, in addition to the HEC client security group"
   type        = list(string)
   default     = []
 }
@@ -99,9 +99,14 @@ variable "ssh_cidr_blocks" {
 }
 
 variable "ssh_public_key" {
-  description = "SSH public key for the key pair"
+  description = "SSH public key for the key pair, in authorized_keys format (ssh-ed25519 or ssh-rsa)"
   type        = string
   default     = null
+
+  validation {
+    condition     = var.ssh_public_key == null || can(regex("^(ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI[A-Za-z0-9+/]{43}|ssh-rsa AAAAB3NzaC1yc2E[A-Za-z0-9+/]+={0,2})( [^\\r\\n]*)?$", var.ssh_public_key))
+    error_message = "ssh_public_key must be an ssh-ed25519 or ssh-rsa public key in authorized_keys format."
+  }
 }
 
 variable "secrets_manager_arns" {
@@ -2,9 +2,10 @@ terraform {
   required_version = ">= 1.5.0"
 
   required_providers {
+    # evaluation_window_sec of the WAF rate-based rules needs 5.40 or later
     aws = {
       source  = "hashicorp/aws"
-      version = "~> 5.0"
+      version = "~> 5.40"
     }
   }
 }
@@ -13,6 +14,261 @@ terraform {
 # ECS Module - Container Service for Docker Image from DockerHub
 #------------------------------------------------------------------------------
 
+locals {
+  https_enabled = var.acm_certificate_arn != null
+  blue_green    = var.enable_blue_green
+
+  # The blue/green service has its own name, so that a rolling stack can
+  # start it next to the rolling service when switching to blue/green
+  service_name = local.blue_green ? "${var.project_name}-${var.environment}-service-bg" : "${var.project_name}-${var.environment}-service"
+
+  # Blue/green always redirects HTTP, so that port 80 never forwards to a
+  # target group CodeDeploy has moved away from
+  redirect_http = local.https_enabled && (var.redirect_http_to_https || local.blue_green)
+
+  blue_green_listeners = local.blue_green ? {
+    production = local.https_enabled ? 443 : 80
+    test       = var.blue_green_test_listener_port
+  } : {}
+
+  target_tracking_metrics = {
+    cpu      = "ECSServiceAverageCPUUtilization"
+    memory   = "ECSServiceAverageMemoryUtilization"
+    requests = "ALBRequestCountPerTarget"
+  }
+
+  # Scaling policies keyed by name. cpu policies without a target_value track
+  # cpu_target_value.
+  target_tracking_policies = var.enable_autoscaling ? {
+    for policy in var.scaling_policies : policy.name => merge(policy, {
+      metric_type  = local.target_tracking_metrics[policy.type]
+      target_value = policy.type == "cpu" ? coalesce(policy.target_value, var.cpu_target_value) : policy.target_value
+    }) if policy.type != "step"
+  } : {}
+
+  step_policies = var.enable_autoscaling ? { for policy in var.scaling_policies : policy.name => policy if policy.type == "step" } : {}
+
+  # Each scaling window sets its capacity at start and restores min_capacity
+  # and max_capacity at end
+  window_actions = flatten([
+    for window in var.scaling_windows : [
+      {
+        name         = "${window.name}-start"
+        schedule     = window.start
+        timezone     = window.timezone
+        min_capacity = window.min_capacity
+        max_capacity = window.max_capacity
+      },
+      {
+        name         = "${window.name}-end"
+        schedule     = window.end
+        timezone     = window.timezone
+        min_capacity = var.min_capacity
+        max_capacity = var.max_capacity
+      },
+    ]
+  ])
+
+  deployment_alarm_names = concat(var.deployment_alarm_names, aws_cloudwatch_metric_alarm.deployment_5xx[*].alarm_name)
+
+  # The scaling window actions are kept without enable_autoscaling so that the
+  # scheduled action precondition rejects them
+  scheduled_actions = { for action in concat(var.enable_autoscaling ? var.scheduled_actions : [], local.window_actions) : action.name => action }
+
+  # The splunk log_driver routes the application logs through a Fluent Bit
+  # FireLens sidecar, which the application waits for
+  splunk_routing = var.log_driver == "splunk" ? var.splunk_log_routing : null
+  splunk_logs    = local.splunk_routing != null
+  splunk_hec     = local.splunk_logs ? regex("^(https?)://([^:/]+):([0-9]+)", local.splunk_routing.hec_endpoint) : null
+
+  log_router = local.splunk_logs ? [{
+    name          = "log-router"
+    image         = local.splunk_routing.image
+    essential     = true
+    cpu           = null
+    memory        = null
+    command       = null
+    port_mappings = []
+    environment   = []
+    secrets       = []
+    depends_on    = []
+    firelens = {
+      type    = "fluentbit"
+      options = { "enable-ecs-log-metadata" = "true" }
+    }
+    log_configuration = null
+  }] : []
+
+  # The router is concatenated as a tuple, as its null attributes do not have
+  # the types of the var.sidecars attributes
+  sidecars             = concat(local.log_router, [for sidecar in var.sidecars : sidecar])
+  container_depends_on = concat(local.splunk_logs ? [{ container_name = "log-router", condition = "START" }] : [], var.container_depends_on)
+
+  efs_enabled = var.efs_storage != null
+
+  # ECS Exec sessions are encrypted with the caller's key or one created by the
+  # module, which also encrypts the session logs
+  create_exec_kms_key = var.enable_execute_command && var.execute_command_kms_key_arn == null
+  exec_kms_key_arn    = local.create_exec_kms_key ? aws_kms_key.exec[0].arn : var.execute_command_kms_key_arn
+  exec_log_group_name = "/ecs/${var.project_name}-${var.environment}/exec"
+  exec_log_group_arn  = "arn:aws:logs:${var.aws_region}:${data.aws_caller_identity.current.account_id}:log-group:${local.exec_log_group_name}"
+
+  # The SSM agent in the task opens the session channels, decrypts the
+  # session and writes its log
+  exec_task_statements = var.enable_execute_command ? [
+    {
+      Sid    = "ExecSessionChannels"
+      Effect = "Allow"
+      Action = [
+        "ssmmessages:CreateControlChannel",
+        "ssmmessages:CreateDataChannel",
+        "ssmmessages:OpenControlChannel",
+        "ssmmessages:OpenDataChannel"
+      ]
+      Resource = ["*"]
+    },
+    {
+      Sid      = "ExecSessionDecrypt"
+      Effect   = "Allow"
+      Action   = ["kms:Decrypt"]
+      Resource = [local.exec_kms_key_arn]
+    },
+    {
+      Sid      = "ExecSessionLogGroups"
+      Effect   = "Allow"
+      Action   = ["logs:DescribeLogGroups"]
+      Resource = ["*"]
+    },
+    {
+      Sid    = "ExecSessionLogs"
+      Effect = "Allow"
+      Action = [
+        "logs:CreateLogStream",
+        "logs:DescribeLogStreams",
+        "logs:PutLogEvents"
+      ]
+      Resource = ["${local.exec_log_group_arn}:*"]
+    }
+  ] : []
+
+  # Sid and Condition are left out when not set, so each statement has its
+  # own type and the statements are concatenated as tuples
+  app_task_statements = [
+    for statement in var.task_role_policy_statements : merge(
+      statement.sid != null ? { Sid = statement.sid } : {},
+      {
+        Effect   = statement.effect
+        Action   = statement.actions
+        Resource = statement.resources
+      },
+      length(statement.conditions) > 0 ? {
+        Condition = {
+          for test in distinct([for condition in statement.conditions : condition.test]) : test => {
+            for condition in statement.conditions : condition.variable => condition.values if condition.test == test
+          }
+        }
+      } : {}
+    )
+  ]
+  task_role_statements = concat([for statement in local.exec_task_statements : statement], local.app_task_statements)
+
+  # WAF rules run by priority: the IP deny and allow lists, the rate limits
+  # and the managed rule groups, each in the order given. Allowing a request
+  # ends the evaluation, so allowed IPs skip every later rule, and blocked IPs
+  # are blocked even when they are also allowed.
+  waf_enabled = var.waf != null
+  waf_ip_sets = local.waf_enabled ? {
+    for name, ip_set in {
+      blocked = { priority = 0, addresses = var.waf.blocked_ip_addresses }
+      allowed = { priority = 1, addresses = var.waf.allowed_ip_addresses }
+    } : name => ip_set if length(ip_set.addresses) > 0
+  } : {}
+  waf_rate_rules = local.waf_enabled ? { for index, rule in var.waf.rate_limits : rule.name => merge(rule, { priority = 10 + index }) } : {}
+  waf_managed_rule_groups = {
+    common           = "AWSManagedRulesCommonRuleSet"
+    known_bad_inputs = "AWSManagedRulesKnownBadInputsRuleSet"
+    ip_reputation    = "AWSManagedRulesAmazonIpReputationList"
+  }
+  waf_managed_rules = local.waf_enabled ? {
+    for index, group in var.waf.managed_rule_groups : group.name => {
+      priority    = 20 + index
+      rule_group  = local.waf_managed_rule_groups[group.name]
+      count_rules = group.count_rules
+    }
+  } : {}
+  waf_log_destination = try(var.waf.logging.destination, null)
+
+  create_alb_logs_bucket = var.enable_alb_access_logs && var.alb_access_logs_bucket == null
+  alb_access_logs_bucket = coalesce(var.alb_access_logs_bucket, "${var.project_name}-${var.environment}-alb-logs-${data.aws_caller_identity.current.account_id}")
+  alb_access_logs_prefix = coalesce(var.alb_access_logs_prefix, "${var.project_name}-${var.environment}")
+
+  task_security_group_ids = concat([aws_security_group.ecs_tasks.id], var.task_security_group_ids)
+
+  execution_secret_arns = distinct(concat(var.secrets_manager_arns, local.splunk_logs ? [local.splunk_routing.hec_token_secret_arn] : []))
+
+  sidecar_names   = [for sidecar in local.sidecars : sidecar.name]
+  container_names = concat([var.container_name], local.sidecar_names)
+
+  # Containers share the network namespace of the task, so each port and
+  # protocol can only be mapped once
+  container_ports = concat(
+    ["${var.container_port}/tcp"],
+    flatten([for sidecar in local.sidecars : [for mapping in sidecar.port_mappings : "${mapping.container_port}/${mapping.protocol}"]])
+  )
+  duplicate_container_ports = distinct([for port in local.container_ports : port if length([for other in local.container_ports : other if other == port]) > 1])
+
+  unknown_container_dependencies = distinct(concat(
+    [for dependency in local.container_depends_on : dependency.container_name if !contains(local.sidecar_names, dependency.container_name)],
+    flatten([for sidecar in local.sidecars : [for dependency in sidecar.depends_on : dependency.container_name if !contains(local.container_names, dependency.container_name)]])
+  ))
+
+  sidecar_containers = [
+    for sidecar in local.sidecars : {
+      name      = sidecar.name
+      image     = sidecar.image
+      essential = sidecar.essential
+      cpu       = sidecar.cpu
+      memory    = sidecar.memory
+      command   = sidecar.command
+
+      portMappings = [
+        for mapping in sidecar.port_mappings : {
+          containerPort = mapping.container_port
+          hostPort      = mapping.container_port
+          protocol      = mapping.protocol
+        }
+      ]
+
+      environment = sidecar.environment
+
+      secrets = sidecar.secrets
+
+      dependsOn = length(sidecar.depends_on) > 0 ? [
+        for dependency in sidecar.depends_on : {
+          containerName = dependency.container_name
+          condition     = dependency.condition
+        }
+      ] : null
+
+      firelensConfiguration = sidecar.firelens
+
+      logConfiguration = sidecar.log_configuration != null ? {
+        logDriver     = sidecar.log_configuration.log_driver
+        options       = sidecar.log_configuration.options
+        secretOptions = sidecar.log_configuration.secret_options
+        } : {
+        logDriver = "awslogs"
+        options = {
+          "awslogs-group"         = aws_cloudwatch_log_group.ecs.name
+          "awslogs-region"        = var.aws_region
+          "awslogs-stream-prefix" = sidecar.name
+        }
+        secretOptions = []
+      }
+    }
+  ]
+}
+
 #------------------------------------------------------------------------------
 # ECS Cluster
 #------------------------------------------------------------------------------
@@ -25,6 +281,21 @@ resource "aws_ecs_cluster" "main" {
     value = var.enable_container_insights ? "enabled" : "disabled"
   }
 
+  dynamic "configuration" {
+    for_each = var.enable_execute_command ? [1] : []
+    content {
+      execute_command_configuration {
+        kms_key_id = local.exec_kms_key_arn
+        logging    = "OVERRIDE"
+
+        log_configuration {
+          cloud_watch_log_group_name     = aws_cloudwatch_log_group.exec[0].name
+          cloud_watch_encryption_enabled = true
+        }
+      }
+    }
+  }
+
   tags = merge(var.tags, {
     Name = "${var.project_name}-${var.environment}-cluster"
   })
@@ -71,8 +342,8 @@ resource "aws_iam_role_policy" "ecs_secrets_policy" {
         Action = [
           "secretsmanager:GetSecretValue"
         ]
-        # Prevent wildcard access - use restrictive ARN if secrets_manager_arns is empty
-        Resource = length(var.secrets_manager_arns) > 0 ? var.secrets_manager_arns : ["arn:aws:secretsmanager:*:*:secret:DO_NOT_ALLOW"]
+        # Prevent wildcard access - use restrictive ARN if there is no secret
+        Resource = length(local.execution_secret_arns) > 0 ? local.execution_secret_arns : ["arn:aws:secretsmanager:*:*:secret:DO_NOT_ALLOW"]
       }
     ]
   })
@@ -101,6 +372,46 @@ resource "aws_iam_role" "ecs_task" {
   tags = var.tags
 }
 
+# Lets the tasks mount the EFS storage through its access point with IAM
+# authorization
+resource "aws_iam_role_policy" "ecs_task_efs" {
+  count = local.efs_enabled && try(var.efs_storage.iam_authorization, false) ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-ecs-task-efs-policy"
+  role  = aws_iam_role.ecs_task.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "elasticfilesystem:ClientMount",
+          "elasticfilesystem:ClientWrite"
+        ]
+        Resource = aws_efs_file_system.main[0].arn
+        Condition = {
+          StringEquals = {
+            "elasticfilesystem:AccessPointArn" = aws_efs_access_point.main[0].arn
+          }
+        }
+      }
+    ]
+  })
+}
+
+# Application permissions and, with ECS Exec, the permissions of the SSM
+# agent
+resource "aws_iam_role_policy" "ecs_task" {
+  count = length(local.task_role_statements) > 0 ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-ecs-task-policy"
+  role  = aws_iam_role.ecs_task.id
+
+  policy = jsonencode({
+    Version   = "2012-10-17"
+    Statement = local.task_role_statements
+  })
+}
+
 #------------------------------------------------------------------------------
 # CloudWatch Log Group
 #------------------------------------------------------------------------------
@@ -112,6 +423,72 @@ resource "aws_cloudwatch_log_group" "ecs" {
   tags = var.tags
 }
 
+resource "aws_cloudwatch_log_group" "exec" {
+  count             = var.enable_execute_command ? 1 : 0
+  name              = local.exec_log_group_name
+  retention_in_days = var.log_retention_days
+  kms_key_id        = local.exec_kms_key_arn
+
+  tags = var.tags
+}
+
+#------------------------------------------------------------------------------
+# ECS Exec Encryption
+#------------------------------------------------------------------------------
+
+resource "aws_kms_key" "exec" {
+  count                   = local.create_exec_kms_key ? 1 : 0
+  description             = "KMS key for ${var.project_name} ${var.environment} ECS Exec sessions"
+  deletion_window_in_days = 30
+  enable_key_rotation     = true
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Sid    = "Enable IAM User Permissions"
+        Effect = "Allow"
+        Principal = {
+          AWS = "arn:aws:iam::${data.aws_caller_identity.current.account_id}:root"
+        }
+        Action   = "kms:*"
+        Resource = "*"
+      },
+      {
+        Sid    = "Allow CloudWatch Logs to encrypt the exec log group"
+        Effect = "Allow"
+        Principal = {
+          Service = "logs.${var.aws_region}.amazonaws.com"
+        }
+        Action = [
+          "kms:Encrypt*",
+          "kms:Decrypt*",
+          "kms:ReEncrypt*",
+          "kms:GenerateDataKey*",
+          "kms:Describe*"
+        ]
+        Resource = "*"
+        # Only for the exec log group of this module
+        Condition = {
+          ArnEquals = {
+            "kms:EncryptionContext:aws:logs:arn" = local.exec_log_group_arn
+          }
+        }
+      }
+    ]
+  })
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-ecs-exec-kms"
+  })
+}
+
+resource "aws_kms_alias" "exec" {
+  count         = local.create_exec_kms_key ? 1 : 0
+  name          = "alias/${var.project_name}-${var.environment}-ecs-exec"
+  target_key_id = aws_kms_key.exec[0].key_id
+}
+
 #------------------------------------------------------------------------------
 # ECS Task Definition
 #------------------------------------------------------------------------------
@@ -125,7 +502,25 @@ resource "aws_ecs_task_definition" "main" {
   execution_role_arn       = aws_iam_role.ecs_task_execution.arn
   task_role_arn            = aws_iam_role.ecs_task.arn
 
-  container_definitions = jsonencode([
+  dynamic "volume" {
+    for_each = local.efs_enabled ? [1] : []
+    content {
+      name = "efs"
+
+      efs_volume_configuration {
+        file_system_id     = aws_efs_file_system.main[0].id
+        transit_encryption = "ENABLED"
+
+        authorization_config {
+          access_point_id = aws_efs_access_point.main[0].id
+          iam             = var.efs_storage.iam_authorization ? "ENABLED" : "DISABLED"
+        }
+      }
+    }
+  }
+
+  # The application container first, then the sidecars in the given order
+  container_definitions = jsonencode(concat([
     {
       name      = var.container_name
       image     = var.docker_image
@@ -143,18 +538,81 @@ resource "aws_ecs_task_definition" "main" {
 
       secrets = var.secrets
 
-      logConfiguration = {
+      logConfiguration = local.splunk_logs ? {
+        logDriver = "awsfirelens"
+        options = merge(
+          {
+            Name         = "splunk"
+            Host         = local.splunk_hec[1]
+            Port         = local.splunk_hec[2]
+            TLS          = local.splunk_hec[0] == "https" ? "On" : "Off"
+            "TLS.Verify" = local.splunk_routing.tls_verify ? "On" : "Off"
+            event_source = "${var.project_name}-${var.environment}"
+          },
+          local.splunk_routing.index != null ? { event_index = local.splunk_routing.index } : {},
+          local.splunk_routing.source_type != null ? { event_sourcetype = local.splunk_routing.source_type } : {},
+        )
+        secretOptions = [
+          {
+            name      = "splunk_token"
+            valueFrom = "${local.splunk_routing.hec_token_secret_arn}:hec_token::"
+          }
+        ]
+        } : {
         logDriver = "awslogs"
         options = {
           "awslogs-group"         = aws_cloudwatch_log_group.ecs.name
           "awslogs-region"        = var.aws_region
           "awslogs-stream-prefix" = "ecs"
         }
+        secretOptions = null
       }
 
+      dependsOn = length(local.container_depends_on) > 0 ? [
+        for dependency in local.container_depends_on : {
+          containerName = dependency.container_name
+          condition     = dependency.condition
+        }
+      ] : null
+
+      mountPoints = local.efs_enabled ? [
+        {
+          sourceVolume  = "efs"
+          containerPath = var.efs_storage.container_path
+          readOnly      = false
+        }
+      ] : null
+
       healthCheck = var.health_check != null ? var.health_check : null
     }
-  ])
+  ], local.sidecar_containers))
+
+  lifecycle {
+    precondition {
+      condition     = !contains(local.sidecar_names, var.container_name)
+      error_message = "sidecars cannot be named ${var.container_name} like the application container."
+    }
+
+    precondition {
+      condition     = var.log_driver != "splunk" || var.splunk_log_routing != null
+      error_message = "The splunk log_driver needs splunk_log_routing."
+    }
+
+    precondition {
+      condition     = !local.splunk_logs || (!contains(var.sidecars[*].name, "log-router") && alltrue([for sidecar in var.sidecars : sidecar.firelens == null]))
+      error_message = "The splunk log_driver adds the log-router FireLens sidecar; sidecars cannot use that name or define another FireLens router."
+    }
+
+    precondition {
+      condition     = length(local.duplicate_container_ports) == 0
+      error_message = "Container ports must be unique within the task: ${join(", ", local.duplicate_container_ports)}."
+    }
+
+    precondition {
+      condition     = length(local.unknown_container_dependencies) == 0
+      error_message = "container_depends_on and sidecars depends_on must name sidecars of the task: ${join(", ", local.unknown_container_dependencies)}."
+    }
+  }
 
   tags = var.tags
 }
@@ -188,6 +646,84 @@ resource "aws_security_group" "ecs_tasks" {
   })
 }
 
+#------------------------------------------------------------------------------
+# EFS Storage
+#------------------------------------------------------------------------------
+
+resource "aws_efs_file_system" "main" {
+  count            = local.efs_enabled ? 1 : 0
+  creation_token   = "${var.project_name}-${var.environment}-efs"
+  encrypted        = true
+  kms_key_id       = var.efs_storage.kms_key_arn
+  performance_mode = var.efs_storage.performance_mode
+  throughput_mode  = var.efs_storage.throughput_mode
+
+  dynamic "lifecycle_policy" {
+    for_each = var.efs_storage.transition_to_ia != null ? [1] : []
+    content {
+      transition_to_ia = var.efs_storage.transition_to_ia
+    }
+  }
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-efs"
+  })
+}
+
+resource "aws_security_group" "efs" {
+  count       = local.efs_enabled ? 1 : 0
+  name        = "${var.project_name}-${var.environment}-efs-sg"
+  description = "Security group for the EFS mount targets"
+  vpc_id      = var.vpc_id
+
+  ingress {
+    description     = "NFS from ECS tasks"
+    from_port       = 2049
+    to_port         = 2049
+    protocol        = "tcp"
+    security_groups = [aws_security_group.ecs_tasks.id]
+  }
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-efs-sg"
+  })
+}
+
+# One mount target in each private subnet, so that tasks in every
+# availability zone reach the file system
+resource "aws_efs_mount_target" "main" {
+  count           = local.efs_enabled ? length(var.private_subnet_ids) : 0
+  file_system_id  = aws_efs_file_system.main[0].id
+  subnet_id       = var.private_subnet_ids[count.index]
+  security_groups = [aws_security_group.efs[0].id]
+}
+
+# Tasks see root_directory as the root of the file system and access it as
+# posix_user, whatever user the container runs as
+resource "aws_efs_access_point" "main" {
+  count          = local.efs_enabled ? 1 : 0
+  file_system_id = aws_efs_file_system.main[0].id
+
+  posix_user {
+    uid = var.efs_storage.posix_user.uid
+    gid = var.efs_storage.posix_user.gid
+  }
+
+  root_directory {
+    path = var.efs_storage.root_directory
+
+    creation_info {
+      owner_uid   = var.efs_storage.posix_user.uid
+      owner_gid   = var.efs_storage.posix_user.gid
+      permissions = var.efs_storage.permissions
+    }
+  }
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-efs-ap"
+  })
+}
+
 #------------------------------------------------------------------------------
 # Application Load Balancer
 #------------------------------------------------------------------------------
@@ -197,6 +733,7 @@ resource "aws_security_group" "alb" {
   description = "Security group for ALB"
   vpc_id      = var.vpc_id
 
+  # Port 80 stays open for the redirect to HTTPS
   ingress {
     description = "HTTP"
     from_port   = 80
@@ -205,12 +742,28 @@ resource "aws_security_group" "alb" {
     cidr_blocks = var.alb_ingress_cidr_blocks
   }
 
-  ingress {
-    description = "HTTPS"
-    from_port   = 443
-    to_port     = 443
-    protocol    = "tcp"
-    cidr_blocks = var.alb_ingress_cidr_blocks
+  dynamic "ingress" {
+    for_each = local.https_enabled ? [1] : []
+    content {
+      description = "HTTPS"
+      from_port   = 443
+      to_port     = 443
+      protocol    = "tcp"
+      cidr_blocks = var.alb_ingress_cidr_blocks
+    }
+  }
+
+  # The test listener serves the new tasks before they take traffic, so it is
+  # only open to blue_green_test_listener_cidr_blocks
+  dynamic "ingress" {
+    for_each = local.blue_green && length(var.blue_green_test_listener_cidr_blocks) > 0 ? [1] : []
+    content {
+      description = "Blue/green test listener"
+      from_port   = var.blue_green_test_listener_port
+      to_port     = var.blue_green_test_listener_port
+      protocol    = "tcp"
+      cidr_blocks = var.blue_green_test_listener_cidr_blocks
+    }
   }
 
   egress {
@@ -232,11 +785,99 @@ resource "aws_lb" "main" {
   security_groups    = [aws_security_group.alb.id]
   subnets            = var.public_subnet_ids
 
-  enable_deletion_protection = var.environment == "production" ? true : false
+  idle_timeout               = var.alb_idle_timeout
+  enable_deletion_protection = coalesce(var.enable_deletion_protection, var.environment == "production")
+
+  dynamic "access_logs" {
+    for_each = var.enable_alb_access_logs ? [1] : []
+    content {
+      bucket  = local.alb_access_logs_bucket
+      prefix  = local.alb_access_logs_prefix
+      enabled = true
+    }
+  }
 
   tags = merge(var.tags, {
     Name = "${var.project_name}-${var.environment}-alb"
   })
+
+  # Elastic Load Balancing checks that it can write to the bucket when access
+  # logs are enabled
+  depends_on = [aws_s3_bucket_policy.alb_logs]
+}
+
+#------------------------------------------------------------------------------
+# ALB Access Logs
+#------------------------------------------------------------------------------
+
+# S3 bucket for the ALB access logs, unless alb_access_logs_bucket names one
+resource "aws_s3_bucket" "alb_logs" {
+  count  = local.create_alb_logs_bucket ? 1 : 0
+  bucket = local.alb_access_logs_bucket
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-alb-logs"
+  })
+}
+
+resource "aws_s3_bucket_public_access_block" "alb_logs" {
+  count  = local.create_alb_logs_bucket ? 1 : 0
+  bucket = aws_s3_bucket.alb_logs[0].id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+# Access logs only support SSE-S3
+resource "aws_s3_bucket_server_side_encryption_configuration" "alb_logs" {
+  count  = local.create_alb_logs_bucket ? 1 : 0
+  bucket = aws_s3_bucket.alb_logs[0].id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "alb_logs" {
+  count  = local.create_alb_logs_bucket ? 1 : 0
+  bucket = aws_s3_bucket.alb_logs[0].id
+
+  rule {
+    id     = "expire-alb-access-logs"
+    status = "Enabled"
+
+    filter {}
+
+    expiration {
+      days = var.alb_access_logs_retention_in_days
+    }
+  }
+}
+
+# The Elastic Load Balancing account of the region writes the logs of this
+# account under the prefix
+resource "aws_s3_bucket_policy" "alb_logs" {
+  count  = local.create_alb_logs_bucket ? 1 : 0
+  bucket = aws_s3_bucket.alb_logs[0].id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Sid       = "ELBAccessLogsWrite"
+        Effect    = "Allow"
+        Principal = { AWS = data.aws_elb_service_account.main.arn }
+        Action    = "s3:PutObject"
+        Resource  = "arn:aws:s3:::${local.alb_access_logs_bucket}/${local.alb_access_logs_prefix}/AWSLogs/${data.aws_caller_identity.current.account_id}/*"
+      }
+    ]
+  })
+
+  depends_on = [aws_s3_bucket_public_access_block.alb_logs]
 }
 
 resource "aws_lb_target_group" "main" {
@@ -261,64 +902,328 @@ resource "aws_lb_target_group" "main" {
   tags = var.tags
 }
 
+resource "aws_lb_target_group" "green" {
+  count       = local.blue_green ? 1 : 0
+  name        = "${var.project_name}-${var.environment}-tg-green"
+  port        = var.container_port
+  protocol    = "HTTP"
+  vpc_id      = var.vpc_id
+  target_type = "ip"
+
+  health_check {
+    enabled             = true
+    healthy_threshold   = 2
+    interval            = 30
+    matcher             = "200-299"
+    path                = var.health_check_path
+    port                = "traffic-port"
+    protocol            = "HTTP"
+    timeout             = 5
+    unhealthy_threshold = 3
+  }
+
+  tags = var.tags
+}
+
+moved {
+  from = aws_lb_listener.http
+  to   = aws_lb_listener.http[0]
+}
+
+# Forwards to the target group without a certificate, and redirects to the
+# HTTPS listener with one unless redirect_http_to_https is false. In
+# blue/green mode without a certificate, port 80 is the production listener
+# of CodeDeploy instead.
 resource "aws_lb_listener" "http" {
+  count             = local.blue_green && !local.https_enabled ? 0 : 1
   load_balancer_arn = aws_lb.main.arn
   port              = 80
   protocol          = "HTTP"
 
-  # SECURITY WARNING: The ALB is exposed publicly on port 80 with only an HTTP listener.
-  # This means credentials or sensitive data can be intercepted by network attackers.
-  # 
-  # RECOMMENDATIONS:
-  # 1. Configure an HTTPS listener using ACM certificates (see commented example below)
-  # 2. Redirect HTTP to HTTPS for secure communication
-  # 3. Update this listener to redirect instead of forward
-  #
-  # Example HTTPS redirect configuration:
-  # default_action {
-  #   type = "redirect"
-  #   redirect {
-  #     port        = "443"
-  #     protocol    = "HTTPS"
-  #     status_code = "HTTP_301"
-  #   }
-  # }
-  #
-  # Example HTTPS listener (requires ACM certificate):
-  # resource "aws_lb_listener" "https" {
-  #   load_balancer_arn = aws_lb.main.arn
-  #   port              = 443
-  #   protocol          = "HTTPS"
-  #   ssl_policy        = "ELBSecurityPolicy-TLS-1-2-2017-01"
-  #   certificate_arn   = var.acm_certificate_arn
-  #   default_action {
-  #     type             = "forward"
-  #     target_group_arn = aws_lb_target_group.main.arn
-  #   }
-  # }
+  default_action {
+    type             = local.redirect_http ? "redirect" : "forward"
+    target_group_arn = local.redirect_http ? null : aws_lb_target_group.main.arn
+
+    dynamic "redirect" {
+      for_each = local.redirect_http ? [1] : []
+      content {
+        port        = "443"
+        protocol    = "HTTPS"
+        status_code = "HTTP_301"
+      }
+    }
+  }
+
+  tags = var.tags
+}
+
+resource "aws_lb_listener" "https" {
+  count             = local.https_enabled && !local.blue_green ? 1 : 0
+  load_balancer_arn = aws_lb.main.arn
+  port              = 443
+  protocol          = "HTTPS"
+  ssl_policy        = var.ssl_policy
+  certificate_arn   = var.acm_certificate_arn
+
+  default_action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.main.arn
+  }
+
+  tags = var.tags
+}
+
+# Production and test listeners of CodeDeploy. Both start on the blue target
+# group; CodeDeploy moves them to the other target group on each deployment.
+resource "aws_lb_listener" "blue_green" {
+  for_each          = local.blue_green_listeners
+  load_balancer_arn = aws_lb.main.arn
+  port              = each.value
+  protocol          = local.https_enabled ? "HTTPS" : "HTTP"
+  ssl_policy        = local.https_enabled ? var.ssl_policy : null
+  certificate_arn   = var.acm_certificate_arn
 
   default_action {
     type             = "forward"
     target_group_arn = aws_lb_target_group.main.arn
   }
+
+  lifecycle {
+    ignore_changes = [default_action]
+  }
+
+  tags = var.tags
+}
+
+#------------------------------------------------------------------------------
+# WAF
+#------------------------------------------------------------------------------
+
+resource "aws_wafv2_ip_set" "waf" {
+  for_each           = local.waf_ip_sets
+  name               = "${var.project_name}-${var.environment}-${each.key}-ips"
+  scope              = "REGIONAL"
+  ip_address_version = "IPV4"
+  addresses          = each.value.addresses
+
+  tags = var.tags
+}
+
+resource "aws_wafv2_web_acl" "main" {
+  count = local.waf_enabled ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-alb"
+  scope = "REGIONAL"
+
+  default_action {
+    allow {}
+  }
+
+  dynamic "rule" {
+    for_each = local.waf_ip_sets
+    content {
+      name     = "${rule.key}-ip-addresses"
+      priority = rule.value.priority
+
+      action {
+        dynamic "allow" {
+          for_each = rule.key == "allowed" ? [1] : []
+          content {}
+        }
+        dynamic "block" {
+          for_each = rule.key == "blocked" ? [1] : []
+          content {}
+        }
+      }
+
+      statement {
+        ip_set_reference_statement {
+          arn = aws_wafv2_ip_set.waf[rule.key].arn
+        }
+      }
+
+      visibility_config {
+        cloudwatch_metrics_enabled = true
+        metric_name                = "${var.project_name}-${var.environment}-${rule.key}-ip-addresses"
+        sampled_requests_enabled   = true
+      }
+    }
+  }
+
+  dynamic "rule" {
+    for_each = local.waf_rate_rules
+    content {
+      name     = "rate-${rule.key}"
+      priority = rule.value.priority
+
+      action {
+        dynamic "block" {
+          for_each = rule.value.action == "block" ? [1] : []
+          content {}
+        }
+        dynamic "count" {
+          for_each = rule.value.action == "count" ? [1] : []
+          content {}
+        }
+      }
+
+      statement {
+        rate_based_statement {
+          limit                 = rule.value.limit
+          evaluation_window_sec = rule.value.evaluation_window_sec
+          aggregate_key_type    = "IP"
+
+          dynamic "scope_down_statement" {
+            for_each = rule.value.path_prefix != null ? [rule.value.path_prefix] : []
+            content {
+              byte_match_statement {
+                search_string         = lower(scope_down_statement.value)
+                positional_constraint = "STARTS_WITH"
+
+                field_to_match {
+                  uri_path {}
+                }
+
+                text_transformation {
+                  priority = 0
+                  type     = "LOWERCASE"
+                }
+              }
+            }
+          }
+        }
+      }
+
+      visibility_config {
+        cloudwatch_metrics_enabled = true
+        metric_name                = "${var.project_name}-${var.environment}-rate-${rule.key}"
+        sampled_requests_enabled   = true
+      }
+    }
+  }
+
+  dynamic "rule" {
+    for_each = local.waf_managed_rules
+    content {
+      name     = "aws-${replace(rule.key, "_", "-")}"
+      priority = rule.value.priority
+
+      override_action {
+        none {}
+      }
+
+      statement {
+        managed_rule_group_statement {
+          vendor_name = "AWS"
+          name        = rule.value.rule_group
+
+          dynamic "rule_action_override" {
+            for_each = rule.value.count_rules
+            content {
+              name = rule_action_override.value
+
+              action_to_use {
+                count {}
+              }
+            }
+          }
+        }
+      }
+
+      visibility_config {
+        cloudwatch_metrics_enabled = true
+        metric_name                = "${var.project_name}-${var.environment}-aws-${replace(rule.key, "_", "-")}"
+        sampled_requests_enabled   = true
+      }
+    }
+  }
+
+  visibility_config {
+    cloudwatch_metrics_enabled = true
+    metric_name                = "${var.project_name}-${var.environment}-alb"
+    sampled_requests_enabled   = true
+  }
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-alb-waf"
+  })
+}
+
+resource "aws_wafv2_web_acl_association" "main" {
+  count        = local.waf_enabled ? 1 : 0
+  resource_arn = aws_lb.main.arn
+  web_acl_arn  = aws_wafv2_web_acl.main[0].arn
+}
+
+# WAF only delivers to log groups named aws-waf-logs-*
+resource "aws_cloudwatch_log_group" "waf" {
+  count             = local.waf_log_destination == "cloudwatch" ? 1 : 0
+  name              = "aws-waf-logs-${var.project_name}-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = var.tags
+}
+
+# Git over HTTP sends the user's password in the Authorization header, and
+# the session cookie is as good as one
+resource "aws_wafv2_web_acl_logging_configuration" "main" {
+  count                   = local.waf_log_destination != null ? 1 : 0
+  resource_arn            = aws_wafv2_web_acl.main[0].arn
+  log_destination_configs = [local.waf_log_destination == "cloudwatch" ? aws_cloudwatch_log_group.waf[0].arn : var.waf.logging.s3_bucket_arn]
+
+  redacted_fields {
+    single_header {
+      name = "authorization"
+    }
+  }
+
+  redacted_fields {
+    single_header {
+      name = "cookie"
+    }
+  }
 }
 
 #------------------------------------------------------------------------------
 # ECS Service
 #------------------------------------------------------------------------------
 
+moved {
+  from = aws_ecs_service.main
+  to   = aws_ecs_service.main[0]
+}
+
 resource "aws_ecs_service" "main" {
-  name                               = "${var.project_name}-${var.environment}-service"
+  count                              = local.blue_green ? 0 : 1
+  name                               = local.service_name
   cluster                            = aws_ecs_cluster.main.id
   task_definition                    = aws_ecs_task_definition.main.arn
   desired_count                      = var.desired_count
-  deployment_minimum_healthy_percent = 50
-  deployment_maximum_percent         = 200
+  deployment_minimum_healthy_percent = var.deployment_minimum_healthy_percent
+  deployment_maximum_percent         = var.deployment_maximum_percent
+  health_check_grace_period_seconds  = var.health_check_grace_period_seconds
   launch_type                        = "FARGATE"
   scheduling_strategy                = "REPLICA"
+  wait_for_steady_state              = var.wait_for_steady_state
+  enable_execute_command             = var.enable_execute_command
+
+  # Stops a deployment whose tasks keep failing to start or to pass health
+  # checks, and rolls back to the last completed one
+  deployment_circuit_breaker {
+    enable   = var.deployment_circuit_breaker.enable
+    rollback = var.deployment_circuit_breaker.rollback
+  }
+
+  dynamic "alarms" {
+    for_each = length(local.deployment_alarm_names) > 0 ? [1] : []
+    content {
+      alarm_names = local.deployment_alarm_names
+      enable      = true
+      rollback    = var.deployment_circuit_breaker.rollback
+    }
+  }
 
   network_configuration {
-    security_groups  = [aws_security_group.ecs_tasks.id]
+    security_groups  = local.task_security_group_ids
     subnets          = var.private_subnet_ids
     assign_public_ip = false
   }
@@ -329,11 +1234,187 @@ resource "aws_ecs_service" "main" {
     container_port   = var.container_port
   }
 
+  # desired_count is managed by auto scaling. Task definition changes, such as
+  # a new docker_image, are deployed.
   lifecycle {
-    ignore_changes = [task_definition, desired_count]
+    ignore_changes = [desired_count]
   }
 
   tags = var.tags
+
+  # Tasks cannot start before the EFS storage is reachable
+  depends_on = [aws_efs_mount_target.main]
+}
+
+# Deployed by CodeDeploy, which shifts traffic between the blue and green
+# target groups. ECS only accepts task definition, load balancer and network
+# changes through a CodeDeploy deployment, so terraform ignores them after
+# creation.
+resource "aws_ecs_service" "blue_green" {
+  count                             = local.blue_green ? 1 : 0
+  name                              = local.service_name
+  cluster                           = aws_ecs_cluster.main.id
+  task_definition                   = aws_ecs_task_definition.main.arn
+  desired_count                     = var.desired_count
+  health_check_grace_period_seconds = var.health_check_grace_period_seconds
+  launch_type                       = "FARGATE"
+  scheduling_strategy               = "REPLICA"
+  wait_for_steady_state             = var.wait_for_steady_state
+  enable_execute_command            = var.enable_execute_command
+
+  deployment_controller {
+    type = "CODE_DEPLOY"
+  }
+
+  network_configuration {
+    security_groups  = local.task_security_group_ids
+    subnets          = var.private_subnet_ids
+    assign_public_ip = false
+  }
+
+  load_balancer {
+    target_group_arn = aws_lb_target_group.main.arn
+    container_name   = var.container_name
+    container_port   = var.container_port
+  }
+
+  lifecycle {
+    ignore_changes = [task_definition, load_balancer, network_configuration, desired_count]
+  }
+
+  tags = var.tags
+
+  depends_on = [aws_efs_mount_target.main]
+}
+
+# Rolls back deployments whose tasks answer with 5XX errors
+resource "aws_cloudwatch_metric_alarm" "deployment_5xx" {
+  count               = var.deployment_5xx_alarm_threshold != null ? 1 : 0
+  alarm_name          = "${var.project_name}-${var.environment}-target-5xx"
+  alarm_description   = "5XX responses of the ${var.environment} ECS tasks"
+  namespace           = "AWS/ApplicationELB"
+  metric_name         = "HTTPCode_Target_5XX_Count"
+  statistic           = "Sum"
+  period              = 60
+  evaluation_periods  = 3
+  datapoints_to_alarm = 2
+  threshold           = var.deployment_5xx_alarm_threshold
+  comparison_operator = "GreaterThanOrEqualToThreshold"
+  treat_missing_data  = "notBreaching"
+
+  # The whole load balancer, as blue/green deployments move the tasks
+  # between target groups
+  dimensions = {
+    LoadBalancer = aws_lb.main.arn_suffix
+  }
+
+  tags = var.tags
+}
+
+#------------------------------------------------------------------------------
+# Blue/Green Deployments
+#------------------------------------------------------------------------------
+
+resource "aws_iam_role" "codedeploy" {
+  count = local.blue_green ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-codedeploy-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "codedeploy.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy_attachment" "codedeploy" {
+  count      = local.blue_green ? 1 : 0
+  role       = aws_iam_role.codedeploy[0].name
+  policy_arn = "arn:aws:iam::aws:policy/AWSCodeDeployRoleForECS"
+}
+
+resource "aws_codedeploy_app" "main" {
+  count            = local.blue_green ? 1 : 0
+  name             = "${var.project_name}-${var.environment}-app"
+  compute_platform = "ECS"
+
+  tags = var.tags
+}
+
+# Keeps the previous task set for blue_green_termination_wait_minutes, so
+# traffic can be moved back to it at once by stopping the deployment
+resource "aws_codedeploy_deployment_group" "main" {
+  count                  = local.blue_green ? 1 : 0
+  app_name               = aws_codedeploy_app.main[0].name
+  deployment_group_name  = "${var.project_name}-${var.environment}-dg"
+  deployment_config_name = var.blue_green_deployment_config
+  service_role_arn       = aws_iam_role.codedeploy[0].arn
+
+  auto_rollback_configuration {
+    enabled = var.deployment_circuit_breaker.rollback
+    events  = ["DEPLOYMENT_FAILURE", "DEPLOYMENT_STOP_ON_ALARM"]
+  }
+
+  dynamic "alarm_configuration" {
+    for_each = length(local.deployment_alarm_names) > 0 ? [1] : []
+    content {
+      alarms  = local.deployment_alarm_names
+      enabled = true
+    }
+  }
+
+  blue_green_deployment_config {
+    deployment_ready_option {
+      action_on_timeout = "CONTINUE_DEPLOYMENT"
+    }
+
+    terminate_blue_instances_on_deployment_success {
+      action                           = "TERMINATE"
+      termination_wait_time_in_minutes = var.blue_green_termination_wait_minutes
+    }
+  }
+
+  deployment_style {
+    deployment_option = "WITH_TRAFFIC_CONTROL"
+    deployment_type   = "BLUE_GREEN"
+  }
+
+  ecs_service {
+    cluster_name = aws_ecs_cluster.main.name
+    service_name = aws_ecs_service.blue_green[0].name
+  }
+
+  load_balancer_info {
+    target_group_pair_info {
+      prod_traffic_route {
+        listener_arns = [aws_lb_listener.blue_green["production"].arn]
+      }
+
+      test_traffic_route {
+        listener_arns = [aws_lb_listener.blue_green["test"].arn]
+      }
+
+      target_group {
+        name = aws_lb_target_group.main.name
+      }
+
+      target_group {
+        name = aws_lb_target_group.green[0].name
+      }
+    }
+  }
+
+  tags = var.tags
+
+  depends_on = [aws_iam_role_policy_attachment.codedeploy]
 }
 
 #------------------------------------------------------------------------------
@@ -344,14 +1425,25 @@ resource "aws_appautoscaling_target" "ecs" {
   count              = var.enable_autoscaling ? 1 : 0
   max_capacity       = var.max_capacity
   min_capacity       = var.min_capacity
-  resource_id        = "service/${aws_ecs_cluster.main.name}/${aws_ecs_service.main.name}"
+  resource_id        = "service/${aws_ecs_cluster.main.name}/${local.service_name}"
   scalable_dimension = "ecs:service:DesiredCount"
   service_namespace  = "ecs"
+
+  tags = var.tags
+
+  depends_on = [aws_ecs_service.main, aws_ecs_service.blue_green]
 }
 
-resource "aws_appautoscaling_policy" "ecs_cpu" {
-  count              = var.enable_autoscaling ? 1 : 0
-  name               = "${var.project_name}-${var.environment}-cpu-autoscaling"
+moved {
+  from = aws_appautoscaling_policy.ecs_cpu[0]
+  to   = aws_appautoscaling_policy.target_tracking["cpu"]
+}
+
+# cpu, memory and requests policies track a predefined metric. requests
+# tracks ALBRequestCountPerTarget on the module's own target group.
+resource "aws_appautoscaling_policy" "target_tracking" {
+  for_each           = local.target_tracking_policies
+  name               = "${var.project_name}-${var.environment}-${each.key}-autoscaling"
   policy_type        = "TargetTrackingScaling"
   resource_id        = aws_appautoscaling_target.ecs[0].resource_id
   scalable_dimension = aws_appautoscaling_target.ecs[0].scalable_dimension
@@ -359,10 +1451,87 @@ resource "aws_appautoscaling_policy" "ecs_cpu" {
 
   target_tracking_scaling_policy_configuration {
     predefined_metric_specification {
-      predefined_metric_type = "ECSServiceAverageCPUUtilization"
+      predefined_metric_type = each.value.metric_type
+      resource_label         = each.value.metric_type == "ALBRequestCountPerTarget" ? "${aws_lb.main.arn_suffix}/${aws_lb_target_group.main.arn_suffix}" : null
+    }
+    target_value       = each.value.target_value
+    scale_in_cooldown  = each.value.scale_in_cooldown
+    scale_out_cooldown = each.value.scale_out_cooldown
+    disable_scale_in   = each.value.disable_scale_in
+  }
+}
+
+# step policies are driven by a CloudWatch alarm on a custom metric. Step
+# bounds are relative to the alarm threshold.
+resource "aws_appautoscaling_policy" "step" {
+  for_each           = local.step_policies
+  name               = "${var.project_name}-${var.environment}-${each.key}-autoscaling"
+  policy_type        = "StepScaling"
+  resource_id        = aws_appautoscaling_target.ecs[0].resource_id
+  scalable_dimension = aws_appautoscaling_target.ecs[0].scalable_dimension
+  service_namespace  = aws_appautoscaling_target.ecs[0].service_namespace
+
+  step_scaling_policy_configuration {
+    adjustment_type         = each.value.adjustment_type
+    cooldown                = each.value.cooldown
+    metric_aggregation_type = contains(["Minimum", "Maximum"], each.value.metric.statistic) ? each.value.metric.statistic : "Average"
+
+    dynamic "step_adjustment" {
+      for_each = each.value.steps
+      content {
+        metric_interval_lower_bound = step_adjustment.value.lower_bound
+        metric_interval_upper_bound = step_adjustment.value.upper_bound
+        scaling_adjustment          = step_adjustment.value.scaling_adjustment
+      }
+    }
+  }
+}
+
+resource "aws_cloudwatch_metric_alarm" "step_scaling" {
+  for_each            = local.step_policies
+  alarm_name          = "${var.project_name}-${var.environment}-${each.key}-scaling"
+  alarm_description   = "Triggers the ${each.key} step scaling policy of the ECS service"
+  namespace           = each.value.metric.namespace
+  metric_name         = each.value.metric.name
+  statistic           = each.value.metric.statistic
+  dimensions          = each.value.metric.dimensions
+  period              = each.value.metric.period
+  evaluation_periods  = each.value.metric.evaluation_periods
+  comparison_operator = each.value.metric.comparison_operator
+  threshold           = each.value.metric.threshold
+  alarm_actions       = [aws_appautoscaling_policy.step[each.key].arn]
+
+  tags = var.tags
+}
+
+resource "aws_appautoscaling_scheduled_action" "ecs" {
+  for_each           = local.scheduled_actions
+  name               = "${var.project_name}-${var.environment}-${each.key}"
+  service_namespace  = one(aws_appautoscaling_target.ecs[*].service_namespace)
+  resource_id        = one(aws_appautoscaling_target.ecs[*].resource_id)
+  scalable_dimension = one(aws_appautoscaling_target.ecs[*].scalable_dimension)
+  schedule           = each.value.schedule
+  timezone           = each.value.timezone
+
+  scalable_target_action {
+    min_capacity = each.value.min_capacity
+    max_capacity = each.value.max_capacity
+  }
+
+  lifecycle {
+    # Scaling windows are scheduled actions of the auto scaling target, which
+    # only exists with enable_autoscaling
+    precondition {
+      condition     = var.enable_autoscaling
+      error_message = "scaling_windows need enable_autoscaling."
     }
-    target_value       = var.cpu_target_value
-    scale_in_cooldown  = 300
-    scale_out_cooldown = 60
   }
 }
+
+#------------------------------------------------------------------------------
+# Data Sources
+#------------------------------------------------------------------------------
+
+data "aws_caller_identity" "current" {}
+
+data "aws_elb_service_account" "main" {}
@@ -19,12 +19,12 @@ output "cluster_arn" {
 
 output "service_id" {
   description = "ID of the ECS service"
-  value       = aws_ecs_service.main.id
+  value       = one(concat(aws_ecs_service.main[*].id, aws_ecs_service.blue_green[*].id))
 }
 
 output "service_name" {
   description = "Name of the ECS service"
-  value       = aws_ecs_service.main.name
+  value       = one(concat(aws_ecs_service.main[*].name, aws_ecs_service.blue_green[*].name))
 }
 
 output "task_definition_arn" {
@@ -52,6 +52,11 @@ output "target_group_arn" {
   value       = aws_lb_target_group.main.arn
 }
 
+output "https_listener_arn" {
+  description = "ARN of the HTTPS listener (null without a certificate)"
+  value       = local.https_enabled ? one(concat(aws_lb_listener.https[*].arn, [for name, listener in aws_lb_listener.blue_green : listener.arn if name == "production"])) : null
+}
+
 output "ecs_security_group_id" {
   description = "Security group ID for ECS tasks"
   value       = aws_security_group.ecs_tasks.id
@@ -76,3 +81,65 @@ output "cloudwatch_log_group_name" {
   description = "Name of the CloudWatch log group"
   value       = aws_cloudwatch_log_group.ecs.name
 }
+
+output "autoscaling_policy_arns" {
+  description = "ARNs of the auto scaling policies by name"
+  value       = merge({ for name, policy in aws_appautoscaling_policy.target_tracking : name => policy.arn }, { for name, policy in aws_appautoscaling_policy.step : name => policy.arn })
+}
+
+output "scheduled_action_arns" {
+  description = "ARNs of the scheduled scaling actions by name"
+  value       = { for name, action in aws_appautoscaling_scheduled_action.ecs : name => action.arn }
+}
+
+output "green_target_group_arn" {
+  description = "ARN of the green target group (null without blue/green)"
+  value       = one(aws_lb_target_group.green[*].arn)
+}
+
+output "test_listener_arn" {
+  description = "ARN of the blue/green test listener (null without blue/green)"
+  value       = local.blue_green ? aws_lb_listener.blue_green["test"].arn : null
+}
+
+output "blue_green_deployment" {
+  description = "CodeDeploy application, deployment group and the appspec settings needed to deploy a new task definition (null without blue/green)"
+  value = local.blue_green ? {
+    application_name      = aws_codedeploy_app.main[0].name
+    deployment_group_name = aws_codedeploy_deployment_group.main[0].deployment_group_name
+    container_name        = var.container_name
+    container_port        = var.container_port
+    subnets               = var.private_subnet_ids
+    security_groups       = local.task_security_group_ids
+  } : null
+}
+
+output "efs_file_system_id" {
+  description = "ID of the EFS file system (null without efs_storage)"
+  value       = one(aws_efs_file_system.main[*].id)
+}
+
+output "efs_access_point_id" {
+  description = "ID of the EFS access point used by the tasks (null without efs_storage)"
+  value       = one(aws_efs_access_point.main[*].id)
+}
+
+output "execute_command_log_group_name" {
+  description = "Name of the CloudWatch log group of the ECS Exec sessions (null without enable_execute_command)"
+  value       = one(aws_cloudwatch_log_group.exec[*].name)
+}
+
+output "execute_command_kms_key_arn" {
+  description = "ARN of the KMS key that encrypts the ECS Exec sessions (null without enable_execute_command)"
+  value       = var.enable_execute_command ? local.exec_kms_key_arn : null
+}
+
+output "waf_web_acl_arn" {
+  description = "ARN of the WAF web ACL of the ALB (null without waf)"
+  value       = one(aws_wafv2_web_acl.main[*].arn)
+}
+
+output "alb_access_logs_bucket" {
+  description = "S3 bucket of the ALB access logs (null without enable_alb_access_logs)"
+  value       = var.enable_alb_access_logs ? local.alb_access_logs_bucket : null
+}
@@ -140,7 +140,7 @@ variable "max_capacity" {
 }
 
 variable "cpu_target_value" {
-  description = "Target CPU utilization for auto scaling"
+  description = "Target CPU utilization of cpu scaling_policies without a target_value"
   type        = number
   default     = 70
 }
@@ -156,3 +156,558 @@ variable "alb_ingress_cidr_blocks" {
   type        = list(string)
   default     = ["0.0.0.0/0"] # Should be restricted in production
 }
+
+variable "acm_certificate_arn" {
+  description = "ARN of the ACM certificate for the HTTPS listener (null serves HTTP only)"
+  type        = string
+  default     = null
+
+  validation {
+    condition     = var.acm_certificate_arn == null || can(regex("^arn:aws[a-z-]*:acm:[a-z0-9-]+:[0-9]{12}:certificate/[0-9a-f-]+$", coalesce(var.acm_certificate_arn, "-")))
+    error_message = "acm_certificate_arn must be an ACM certificate ARN."
+  }
+}
+
+variable "ssl_policy" {
+  description = "TLS security policy of the HTTPS listener"
+  type        = string
+  default     = "ELBSecurityPolicy-TLS13-1-2-2021-06"
+
+  validation {
+    condition     = startswith(var.ssl_policy, "ELBSecurityPolicy-")
+    error_message = "ssl_policy must be an ELB security policy name (ELBSecurityPolicy-*)."
+  }
+}
+
+variable "redirect_http_to_https" {
+  description = "Redirect HTTP to HTTPS with a 301 when a certificate is set"
+  type        = bool
+  default     = true
+}
+
+variable "scaling_policies" {
+  description = "Auto scaling policies. cpu, memory and requests (ALB requests per target) track target_value; step scales by steps when a CloudWatch alarm on metric fires"
+  type = list(object({
+    name               = string
+    type               = string
+    target_value       = optional(number)
+    scale_in_cooldown  = optional(number, 300)
+    scale_out_cooldown = optional(number, 60)
+    disable_scale_in   = optional(bool, false)
+    metric = optional(object({
+      name                = string
+      namespace           = string
+      statistic           = optional(string, "Average")
+      dimensions          = optional(map(string))
+      period              = optional(number, 60)
+      evaluation_periods  = optional(number, 2)
+      comparison_operator = string
+      threshold           = number
+    }))
+    adjustment_type = optional(string, "ChangeInCapacity")
+    cooldown        = optional(number, 60)
+    steps = optional(list(object({
+      lower_bound        = optional(number)
+      upper_bound        = optional(number)
+      scaling_adjustment = number
+    })), [])
+  }))
+  default = [{ name = "cpu", type = "cpu" }]
+
+  validation {
+    condition     = alltrue([for policy in var.scaling_policies : contains(["cpu", "memory", "requests", "step"], policy.type)])
+    error_message = "scaling_policies types must be cpu, memory, requests or step."
+  }
+
+  validation {
+    condition     = alltrue([for policy in var.scaling_policies : can(regex("^[a-z0-9-]+$", policy.name))]) && length(distinct([for policy in var.scaling_policies : policy.name])) == length(var.scaling_policies)
+    error_message = "scaling_policies names must be unique and use lowercase letters, digits and hyphens."
+  }
+
+  validation {
+    condition     = alltrue([for policy in var.scaling_policies : contains(["cpu", "step"], policy.type) || policy.target_value != null])
+    error_message = "memory and requests scaling_policies need a target_value."
+  }
+
+  validation {
+    condition     = alltrue([for policy in var.scaling_policies : policy.type != "step" || (policy.metric != null && length(policy.steps) > 0)])
+    error_message = "step scaling_policies need a metric and at least one step."
+  }
+
+  validation {
+    condition     = alltrue([for policy in var.scaling_policies : policy.type != "step" || contains(["GreaterThanOrEqualToThreshold", "GreaterThanThreshold", "LessThanThreshold", "LessThanOrEqualToThreshold"], try(policy.metric.comparison_operator, ""))])
+    error_message = "step scaling_policies metric comparison_operator must be a threshold comparison."
+  }
+
+  validation {
+    condition     = alltrue([for policy in var.scaling_policies : policy.type != "step" || contains(["ChangeInCapacity", "ExactCapacity", "PercentChangeInCapacity"], policy.adjustment_type)])
+    error_message = "step scaling_policies adjustment_type must be ChangeInCapacity, ExactCapacity or PercentChangeInCapacity."
+  }
+}
+
+variable "scheduled_actions" {
+  description = "Scheduled changes of the auto scaling min and max capacity (schedule is an at(), rate() or cron() expression)"
+  type = list(object({
+    name         = string
+    schedule     = string
+    timezone     = optional(string, "UTC")
+    min_capacity = optional(number)
+    max_capacity = optional(number)
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for action in var.scheduled_actions : can(regex("^(at|rate|cron)\\(.+\\)$", action.schedule))])
+    error_message = "scheduled_actions schedules must be at(), rate() or cron() expressions."
+  }
+
+  validation {
+    condition     = alltrue([for action in var.scheduled_actions : action.min_capacity != null || action.max_capacity != null])
+    error_message = "scheduled_actions need a min_capacity or a max_capacity."
+  }
+
+  validation {
+    condition     = length(distinct([for action in var.scheduled_actions : action.name])) == length(var.scheduled_actions)
+    error_message = "scheduled_actions names must be unique."
+  }
+}
+
+variable "scaling_windows" {
+  description = "Recurring windows with their own auto scaling capacity, such as scaling to zero outside office hours. start and end are cron() expressions; min_capacity and max_capacity are restored at end. Needs enable_autoscaling"
+  type = list(object({
+    name         = string
+    start        = string
+    end          = string
+    timezone     = optional(string, "UTC")
+    min_capacity = number
+    max_capacity = number
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for window in var.scaling_windows : can(regex("^cron\\(.+\\)$", window.start)) && can(regex("^cron\\(.+\\)$", window.end))])
+    error_message = "scaling_windows start and end must be cron() expressions."
+  }
+
+  validation {
+    condition     = alltrue([for window in var.scaling_windows : window.min_capacity >= 0 && window.min_capacity <= window.max_capacity])
+    error_message = "scaling_windows min_capacity must be between 0 and max_capacity."
+  }
+
+  validation {
+    condition     = alltrue([for window in var.scaling_windows : can(regex("^[a-z0-9-]+$", window.name))]) && length(distinct([for window in var.scaling_windows : window.name])) == length(var.scaling_windows)
+    error_message = "scaling_windows names must be unique and use lowercase letters, digits and hyphens."
+  }
+}
+
+variable "deployment_circuit_breaker" {
+  description = "Deployment circuit breaker of the ECS service; rollback also applies to the deployment alarms"
+  type = object({
+    enable   = optional(bool, true)
+    rollback = optional(bool, true)
+  })
+  default = {}
+}
+
+variable "deployment_minimum_healthy_percent" {
+  description = "Lower limit of running tasks during a deployment, as a percentage of desired_count"
+  type        = number
+  default     = 50
+
+  validation {
+    condition     = var.deployment_minimum_healthy_percent >= 0 && var.deployment_minimum_healthy_percent <= 100
+    error_message = "deployment_minimum_healthy_percent must be between 0 and 100."
+  }
+}
+
+variable "deployment_maximum_percent" {
+  description = "Upper limit of running tasks during a deployment, as a percentage of desired_count"
+  type        = number
+  default     = 200
+
+  validation {
+    condition     = var.deployment_maximum_percent >= 100 && var.deployment_maximum_percent <= 200
+    error_message = "deployment_maximum_percent must be between 100 and 200."
+  }
+}
+
+variable "health_check_grace_period_seconds" {
+  description = "Seconds the service ignores failing load balancer health checks of new tasks"
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.health_check_grace_period_seconds >= 0 && var.health_check_grace_period_seconds <= 2147483647
+    error_message = "health_check_grace_period_seconds must be between 0 and 2147483647."
+  }
+}
+
+variable "deployment_alarm_names" {
+  description = "Names of existing CloudWatch alarms that fail a deployment when they go off"
+  type        = list(string)
+  default     = []
+}
+
+variable "deployment_5xx_alarm_threshold" {
+  description = "Target 5XX responses per minute that fail a deployment (null creates no alarm)"
+  type        = number
+  default     = null
+
+  validation {
+    condition     = var.deployment_5xx_alarm_threshold == null || coalesce(var.deployment_5xx_alarm_threshold, 1) > 0
+    error_message = "deployment_5xx_alarm_threshold must be greater than 0."
+  }
+}
+
+variable "wait_for_steady_state" {
+  description = "Wait for deployments to complete, so a rolled back deployment fails the apply"
+  type        = bool
+  default     = false
+}
+
+variable "enable_blue_green" {
+  description = "Deploy the service blue/green with CodeDeploy instead of the ECS rolling update. Changing it replaces the service"
+  type        = bool
+  default     = false
+}
+
+variable "blue_green_test_listener_port" {
+  description = "Port of the ALB test listener that serves the new task set during a blue/green deployment"
+  type        = number
+  default     = 8443
+
+  validation {
+    condition     = var.blue_green_test_listener_port >= 1 && var.blue_green_test_listener_port <= 65535 && !contains([80, 443], var.blue_green_test_listener_port)
+    error_message = "blue_green_test_listener_port must be a port other than 80 and 443."
+  }
+}
+
+variable "blue_green_test_listener_cidr_blocks" {
+  description = "CIDR blocks allowed to reach the blue/green test listener, such as the VPC CIDR for in-VPC checks. Empty keeps it closed"
+  type        = list(string)
+  default     = []
+
+  validation {
+    condition     = alltrue([for cidr in var.blue_green_test_listener_cidr_blocks : can(cidrhost(cidr, 0)) && cidr != "0.0.0.0/0"])
+    error_message = "blue_green_test_listener_cidr_blocks must be CIDR blocks other than 0.0.0.0/0; the test listener serves tasks that are not released yet."
+  }
+}
+
+variable "blue_green_deployment_config" {
+  description = "CodeDeploy deployment configuration, e.g. CodeDeployDefault.ECSAllAtOnce or CodeDeployDefault.ECSCanary10Percent5Minutes"
+  type        = string
+  default     = "CodeDeployDefault.ECSAllAtOnce"
+}
+
+variable "blue_green_termination_wait_minutes" {
+  description = "Minutes the previous task set keeps running after a blue/green deployment, for instant rollback"
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.blue_green_termination_wait_minutes >= 0 && var.blue_green_termination_wait_minutes <= 2880
+    error_message = "blue_green_termination_wait_minutes must be between 0 and 2880."
+  }
+}
+
+variable "container_depends_on" {
+  description = "Sidecars the application container waits for, with the START, COMPLETE, SUCCESS or HEALTHY condition"
+  type = list(object({
+    container_name = string
+    condition      = optional(string, "START")
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for dependency in var.container_depends_on : contains(["START", "COMPLETE", "SUCCESS", "HEALTHY"], dependency.condition)])
+    error_message = "container_depends_on conditions must be START, COMPLETE, SUCCESS or HEALTHY."
+  }
+}
+
+variable "sidecars" {
+  description = "Additional containers of the task, after the application container. Logs go to the module log group under the sidecar name unless log_configuration is set"
+  type = list(object({
+    name      = string
+    image     = string
+    essential = optional(bool, false)
+    cpu       = optional(number)
+    memory    = optional(number)
+    command   = optional(list(string))
+    port_mappings = optional(list(object({
+      container_port = number
+      protocol       = optional(string, "tcp")
+    })), [])
+    environment = optional(list(object({
+      name  = string
+      value = string
+    })), [])
+    secrets = optional(list(object({
+      name      = string
+      valueFrom = string
+    })), [])
+    depends_on = optional(list(object({
+      container_name = string
+      condition      = optional(string, "START")
+    })), [])
+    firelens = optional(object({
+      type    = optional(string, "fluentbit")
+      options = optional(map(string))
+    }))
+    log_configuration = optional(object({
+      log_driver = string
+      options    = optional(map(string), {})
+      secret_options = optional(list(object({
+        name      = string
+        valueFrom = string
+      })), [])
+    }))
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for sidecar in var.sidecars : can(regex("^[a-zA-Z0-9_-]{1,255}$", sidecar.name))]) && length(distinct([for sidecar in var.sidecars : sidecar.name])) == length(var.sidecars)
+    error_message = "sidecars names must be unique and use letters, digits, hyphens and underscores."
+  }
+
+  validation {
+    condition     = alltrue(flatten([for sidecar in var.sidecars : [for mapping in sidecar.port_mappings : contains(["tcp", "udp"], mapping.protocol) && mapping.container_port >= 1 && mapping.container_port <= 65535]]))
+    error_message = "sidecars port_mappings need a container_port between 1 and 65535 and the tcp or udp protocol."
+  }
+
+  validation {
+    condition     = alltrue(flatten([for sidecar in var.sidecars : [for dependency in sidecar.depends_on : contains(["START", "COMPLETE", "SUCCESS", "HEALTHY"], dependency.condition) && dependency.container_name != sidecar.name]]))
+    error_message = "sidecars depends_on conditions must be START, COMPLETE, SUCCESS or HEALTHY, and a sidecar cannot depend on itself."
+  }
+
+  validation {
+    condition     = alltrue([for sidecar in var.sidecars : sidecar.firelens == null || contains(["fluentbit", "fluentd"], try(sidecar.firelens.type, ""))]) && length([for sidecar in var.sidecars : sidecar if sidecar.firelens != null]) <= 1
+    error_message = "At most one of the sidecars can be the FireLens log router, of type fluentbit or fluentd."
+  }
+}
+
+variable "log_driver" {
+  description = "Log destination of the application container: awslogs ships to CloudWatch Logs, splunk routes through a Fluent Bit FireLens sidecar to splunk_log_routing"
+  type        = string
+  default     = "awslogs"
+
+  validation {
+    condition     = contains(["awslogs", "splunk"], var.log_driver)
+    error_message = "log_driver must be awslogs or splunk."
+  }
+}
+
+variable "splunk_log_routing" {
+  description = "Splunk HEC endpoint (https://host:port) and the Secrets Manager secret whose hec_token key holds the token, for the splunk log_driver. TLS is not verified by default as Splunk serves HEC with a self-signed certificate"
+  type = object({
+    hec_endpoint         = string
+    hec_token_secret_arn = string
+    index                = optional(string)
+    source_type          = optional(string)
+    tls_verify           = optional(bool, false)
+    image                = optional(string, "public.ecr.aws/aws-observability/aws-for-fluent-bit:stable")
+  })
+  default = null
+
+  validation {
+    condition     = var.splunk_log_routing == null || can(regex("^https?://[^:/]+:[0-9]+/?$", var.splunk_log_routing.hec_endpoint))
+    error_message = "splunk_log_routing hec_endpoint must be a URL with a scheme, host and port, e.g. https://10.0.1.10:8088."
+  }
+
+  validation {
+    condition     = var.splunk_log_routing == null || can(regex("^arn:aws[a-zA-Z-]*:secretsmanager:", var.splunk_log_routing.hec_token_secret_arn))
+    error_message = "splunk_log_routing hec_token_secret_arn must be a Secrets Manager secret ARN."
+  }
+}
+
+variable "task_security_group_ids" {
+  description = "Additional security groups of the tasks, such as the Splunk HEC client security group"
+  type        = list(string)
+  default     = []
+}
+
+variable "efs_storage" {
+  description = "Persistent EFS storage mounted into the application container at container_path, such as the Gogs repositories. Tasks reach it through an access point that creates root_directory for posix_user, with transit encryption and, unless iam_authorization is false, the task role"
+  type = object({
+    container_path = string
+    root_directory = optional(string, "/gogs")
+    posix_user = optional(object({
+      uid = number
+      gid = number
+    }), { uid = 1000, gid = 1000 })
+    permissions       = optional(string, "0755")
+    performance_mode  = optional(string, "generalPurpose")
+    throughput_mode   = optional(string, "bursting")
+    transition_to_ia  = optional(string)
+    kms_key_arn       = optional(string)
+    iam_authorization = optional(bool, true)
+  })
+  default = null
+
+  validation {
+    condition     = var.efs_storage == null || (startswith(try(var.efs_storage.container_path, ""), "/") && startswith(try(var.efs_storage.root_directory, ""), "/"))
+    error_message = "efs_storage container_path and root_directory must be absolute paths."
+  }
+
+  validation {
+    condition     = var.efs_storage == null || (try(var.efs_storage.posix_user.uid, -1) >= 0 && try(var.efs_storage.posix_user.gid, -1) >= 0 && can(regex("^[0-7]{3,4}$", var.efs_storage.permissions)))
+    error_message = "efs_storage posix_user needs a non-negative uid and gid, and permissions must be an octal mode such as 0755."
+  }
+
+  validation {
+    condition     = var.efs_storage == null || (contains(["generalPurpose", "maxIO"], try(var.efs_storage.performance_mode, "")) && contains(["bursting", "elastic"], try(var.efs_storage.throughput_mode, "")))
+    error_message = "efs_storage performance_mode must be generalPurpose or maxIO, and throughput_mode bursting or elastic."
+  }
+
+  validation {
+    condition     = contains(["AFTER_1_DAY", "AFTER_7_DAYS", "AFTER_14_DAYS", "AFTER_30_DAYS", "AFTER_60_DAYS", "AFTER_90_DAYS", "AFTER_180_DAYS", "AFTER_270_DAYS", "AFTER_365_DAYS"], coalesce(try(var.efs_storage.transition_to_ia, null), "AFTER_30_DAYS"))
+    error_message = "efs_storage transition_to_ia must be an EFS lifecycle policy such as AFTER_30_DAYS."
+  }
+}
+
+variable "enable_execute_command" {
+  description = "Enable ECS Exec, so that aws ecs execute-command can open shells in the tasks. Sessions are encrypted with KMS and logged to an encrypted CloudWatch log group"
+  type        = bool
+  default     = false
+}
+
+variable "execute_command_kms_key_arn" {
+  description = "KMS key ARN that encrypts ECS Exec sessions and their log group. Its key policy must let CloudWatch Logs use it. When null, the module creates a key"
+  type        = string
+  default     = null
+
+  validation {
+    condition     = var.execute_command_kms_key_arn == null || can(regex("^arn:aws[a-zA-Z-]*:kms:[a-z0-9-]+:[0-9]{12}:key/", var.execute_command_kms_key_arn))
+    error_message = "execute_command_kms_key_arn must be a KMS key ARN."
+  }
+}
+
+variable "task_role_policy_statements" {
+  description = "IAM policy statements granted to the application through the task role. Conditions with the same test are combined"
+  type = list(object({
+    sid       = optional(string)
+    effect    = optional(string, "Allow")
+    actions   = list(string)
+    resources = list(string)
+    conditions = optional(list(object({
+      test     = string
+      variable = string
+      values   = list(string)
+    })), [])
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for statement in var.task_role_policy_statements : contains(["Allow", "Deny"], statement.effect) && length(statement.actions) > 0 && length(statement.resources) > 0])
+    error_message = "task_role_policy_statements need an effect of Allow or Deny and at least one action and resource."
+  }
+
+  validation {
+    condition     = alltrue([for statement in var.task_role_policy_statements : statement.sid == null || can(regex("^[a-zA-Z0-9]+$", statement.sid))])
+    error_message = "task_role_policy_statements sids must only use letters and digits."
+  }
+}
+
+variable "waf" {
+  description = "WAF web ACL of the ALB. Rules run in order: blocked_ip_addresses, allowed_ip_addresses, rate_limits and managed_rule_groups (common, known_bad_inputs, ip_reputation). allowed_ip_addresses do not restrict access: their requests skip the rate limits and managed rule groups, unless they are also blocked. Rate limits count the requests of each IP in evaluation_window_sec, optionally only under path_prefix. count_rules of a managed group only count matches; the common group's body size rule would block git pushes over HTTP. Logs go to a CloudWatch log group created by the module or to an S3 bucket named aws-waf-logs-*"
+  type = object({
+    managed_rule_groups = optional(list(object({
+      name        = string
+      count_rules = optional(list(string), [])
+    })), [{ name = "common", count_rules = ["SizeRestrictions_BODY"] }, { name = "known_bad_inputs" }, { name = "ip_reputation" }])
+    rate_limits = optional(list(object({
+      name                  = string
+      limit                 = number
+      evaluation_window_sec = optional(number, 300)
+      path_prefix           = optional(string)
+      action                = optional(string, "block")
+    })), [])
+    allowed_ip_addresses = optional(list(string), [])
+    blocked_ip_addresses = optional(list(string), [])
+    logging = optional(object({
+      destination   = string
+      s3_bucket_arn = optional(string)
+    }))
+  })
+  default = null
+
+  validation {
+    condition     = var.waf == null || (alltrue([for group in try(var.waf.managed_rule_groups, []) : contains(["common", "known_bad_inputs", "ip_reputation"], group.name)]) && length(distinct([for group in try(var.waf.managed_rule_groups, []) : group.name])) == length(try(var.waf.managed_rule_groups, [])))
+    error_message = "waf managed_rule_groups must be distinct names out of common, known_bad_inputs and ip_reputation."
+  }
+
+  validation {
+    condition     = var.waf == null || (length(try(var.waf.rate_limits, [])) <= 10 && length(distinct([for rule in try(var.waf.rate_limits, []) : rule.name])) == length(try(var.waf.rate_limits, [])) && alltrue([for rule in try(var.waf.rate_limits, []) : can(regex("^[a-z0-9-]{1,64}$", rule.name))]))
+    error_message = "waf rate_limits can have up to 10 rules with unique names of lowercase letters, digits and hyphens."
+  }
+
+  validation {
+    condition     = var.waf == null || alltrue([for rule in try(var.waf.rate_limits, []) : rule.limit >= 10 && rule.limit <= 2000000000 && contains([60, 120, 300, 600], rule.evaluation_window_sec) && contains(["block", "count"], rule.action) && startswith(coalesce(rule.path_prefix, "/"), "/")])
+    error_message = "waf rate_limits need a limit between 10 and 2000000000, an evaluation_window_sec of 60, 120, 300 or 600, the block or count action and a path_prefix starting with /."
+  }
+
+  validation {
+    condition     = var.waf == null || alltrue([for address in concat(try(var.waf.allowed_ip_addresses, []), try(var.waf.blocked_ip_addresses, [])) : can(regex("^[0-9.]+/[0-9]+$", address)) && can(cidrhost(address, 0))])
+    error_message = "waf allowed_ip_addresses and blocked_ip_addresses must be IPv4 CIDR blocks."
+  }
+
+  validation {
+    condition     = try(var.waf.logging, null) == null || (contains(["cloudwatch", "s3"], try(var.waf.logging.destination, "")) && (try(var.waf.logging.destination, "") != "s3" || can(regex("^arn:aws[a-zA-Z-]*:s3:::aws-waf-logs-", var.waf.logging.s3_bucket_arn))))
+    error_message = "waf logging destination must be cloudwatch or s3, and s3 needs the s3_bucket_arn of a bucket named aws-waf-logs-*."
+  }
+}
+
+variable "alb_idle_timeout" {
+  description = "Seconds the ALB keeps an idle connection open. Git clones and pushes over HTTP can stay quiet for longer than the AWS default of 60 while the server packs objects"
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.alb_idle_timeout >= 1 && var.alb_idle_timeout <= 4000 && floor(var.alb_idle_timeout) == var.alb_idle_timeout
+    error_message = "alb_idle_timeout must be a whole number of seconds between 1 and 4000."
+  }
+}
+
+variable "enable_deletion_protection" {
+  description = "Protect the ALB from deletion. When null, only production is protected"
+  type        = bool
+  default     = null
+}
+
+variable "enable_alb_access_logs" {
+  description = "Write the ALB access logs to S3"
+  type        = bool
+  default     = false
+}
+
+variable "alb_access_logs_bucket" {
+  description = "Name of an existing S3 bucket for the ALB access logs, whose policy lets Elastic Load Balancing write under the prefix. A bucket is created when null"
+  type        = string
+  default     = null
+
+  validation {
+    condition     = var.alb_access_logs_bucket == null || can(regex("^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$", var.alb_access_logs_bucket))
+    error_message = "alb_access_logs_bucket must be an S3 bucket name, not an ARN."
+  }
+}
+
+variable "alb_access_logs_prefix" {
+  description = "Key prefix of the ALB access logs. When null, <project_name>-<environment>"
+  type        = string
+  default     = null
+
+  validation {
+    condition     = var.alb_access_logs_prefix == null || can(regex("^[a-zA-Z0-9!_.*'()-]+(/[a-zA-Z0-9!_.*'()-]+)*$", var.alb_access_logs_prefix)) && !can(regex("AWSLogs", coalesce(var.alb_access_logs_prefix, "-")))
+    error_message = "alb_access_logs_prefix must not start or end with a slash or contain AWSLogs."
+  }
+}
+
+variable "alb_access_logs_retention_in_days" {
+  description = "Days to keep the ALB access logs in the created bucket"
+  type        = number
+  default     = 90
+
+  validation {
+    condition     = var.alb_access_logs_retention_in_days > 0 && floor(var.alb_access_logs_retention_in_days) == var.alb_access_logs_retention_in_days
+    error_message = "alb_access_logs_retention_in_days must be a positive whole number of days."
+  }
+}
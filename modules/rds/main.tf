@@ -13,6 +13,56 @@ terraform {
 # RDS Module - Relational Database Service
 #------------------------------------------------------------------------------
 
+locals {
+  version_parts = split(".", var.engine_version)
+
+  # Settings AWS accepts for each engine. MariaDB only supports IAM database
+  # authentication from 10.6, so it stays disabled unless requested.
+  engine_defaults = {
+    postgres = {
+      port                = 5432
+      family              = "postgres${local.version_parts[0]}"
+      log_exports         = ["postgresql", "upgrade"]
+      allowed_log_exports = ["postgresql", "upgrade"]
+      iam_authentication  = true
+    }
+    mysql = {
+      port                = 3306
+      family              = "mysql${join(".", slice(local.version_parts, 0, min(2, length(local.version_parts))))}"
+      log_exports         = ["error", "general", "slowquery"]
+      allowed_log_exports = ["audit", "error", "general", "slowquery"]
+      iam_authentication  = true
+    }
+    mariadb = {
+      port                = 3306
+      family              = "mariadb${join(".", slice(local.version_parts, 0, min(2, length(local.version_parts))))}"
+      log_exports         = ["error", "general", "slowquery"]
+      allowed_log_exports = ["audit", "error", "general", "slowquery"]
+      iam_authentication  = false
+    }
+  }
+
+  engine = local.engine_defaults[var.engine]
+
+  port                   = coalesce(var.port, local.engine.port)
+  parameter_group_family = coalesce(var.db_parameter_group_family, local.engine.family)
+  log_exports            = var.enabled_cloudwatch_logs_exports != null ? var.enabled_cloudwatch_logs_exports : local.engine.log_exports
+  iam_authentication     = coalesce(var.iam_database_authentication_enabled, local.engine.iam_authentication)
+
+  # EventBridge Scheduler universal targets calling the RDS API, keyed by
+  # schedule
+  rds_schedules = var.scheduled_stop == null ? {} : {
+    stop = {
+      expression = var.scheduled_stop.stop
+      action     = "stopDBInstance"
+    }
+    start = {
+      expression = var.scheduled_stop.start
+      action     = "startDBInstance"
+    }
+  }
+}
+
 #------------------------------------------------------------------------------
 # DB Subnet Group
 #------------------------------------------------------------------------------
@@ -38,8 +88,8 @@ resource "aws_security_group" "rds" {
 
   ingress {
     description     = "Database access from ECS"
-    from_port       = var.port
-    to_port         = var.port
+    from_port       = local.port
+    to_port         = local.port
     protocol        = "tcp"
     security_groups = var.allowed_security_groups
   }
@@ -62,7 +112,7 @@ resource "aws_security_group" "rds" {
 
 resource "aws_db_parameter_group" "main" {
   name        = "${var.project_name}-${var.environment}-db-params"
-  family      = var.db_parameter_group_family
+  family      = local.parameter_group_family
   description = "Database parameter group for ${var.project_name} ${var.environment}"
 
   dynamic "parameter" {
@@ -78,6 +128,11 @@ resource "aws_db_parameter_group" "main" {
 
   lifecycle {
     create_before_destroy = true
+
+    precondition {
+      condition     = startswith(local.parameter_group_family, var.engine)
+      error_message = "db_parameter_group_family ${local.parameter_group_family} does not belong to the ${var.engine} engine."
+    }
   }
 }
 
@@ -100,13 +155,13 @@ resource "aws_db_instance" "main" {
   db_name  = var.db_name
   username = var.username
   password = var.password
-  port     = var.port
+  port     = local.port
 
   # Enable IAM database authentication
-  iam_database_authentication_enabled = true
+  iam_database_authentication_enabled = local.iam_authentication
 
   # Enable CloudWatch logging
-  enabled_cloudwatch_logs_exports = ["postgresql", "upgrade"]
+  enabled_cloudwatch_logs_exports = local.log_exports
 
   vpc_security_group_ids = [aws_security_group.rds.id]
   db_subnet_group_name   = aws_db_subnet_group.main.name
@@ -139,6 +194,17 @@ resource "aws_db_instance" "main" {
       Name = "${var.project_name}-${var.environment}-db"
     }
   )
+
+  lifecycle {
+    precondition {
+      condition     = alltrue([for log in local.log_exports : contains(local.engine.allowed_log_exports, log)])
+      error_message = "enabled_cloudwatch_logs_exports for ${var.engine} must be a subset of ${join(", ", local.engine.allowed_log_exports)}."
+    }
+
+    # The snapshot name embeds timestamp() and would otherwise change on every
+    # plan; keep the name chosen when the instance was created.
+    ignore_changes = [final_snapshot_identifier]
+  }
 }
 
 #------------------------------------------------------------------------------
@@ -170,3 +236,66 @@ resource "aws_iam_role_policy_attachment" "rds_monitoring" {
   role       = aws_iam_role.rds_monitoring[0].name
   policy_arn = "arn:aws:iam::aws:policy/service-role/AmazonRDSEnhancedMonitoringRole"
 }
+
+#------------------------------------------------------------------------------
+# Scheduled Stop/Start
+#------------------------------------------------------------------------------
+
+resource "aws_iam_role" "rds_scheduler" {
+  count = var.scheduled_stop != null ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-rds-scheduler-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "scheduler.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy" "rds_scheduler" {
+  count = var.scheduled_stop != null ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-rds-scheduler-policy"
+  role  = aws_iam_role.rds_scheduler[0].id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["rds:StopDBInstance", "rds:StartDBInstance"]
+        Resource = aws_db_instance.main.arn
+      }
+    ]
+  })
+}
+
+resource "aws_scheduler_schedule" "rds" {
+  for_each    = local.rds_schedules
+  name        = "${var.project_name}-${var.environment}-db-${each.key}"
+  description = "Runs ${each.value.action} on the ${var.environment} database"
+
+  schedule_expression          = each.value.expression
+  schedule_expression_timezone = var.scheduled_stop.timezone
+
+  flexible_time_window {
+    mode = "OFF"
+  }
+
+  target {
+    arn      = "arn:aws:scheduler:::aws-sdk:rds:${each.value.action}"
+    role_arn = aws_iam_role.rds_scheduler[0].arn
+
+    input = jsonencode({
+      DbInstanceIdentifier = aws_db_instance.main.identifier
+    })
+  }
+}
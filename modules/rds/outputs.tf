@@ -52,3 +52,8 @@ output "db_parameter_group_name" {
   description = "Name of the DB parameter group"
   value       = aws_db_parameter_group.main.name
 }
+
+output "db_schedule_arns" {
+  description = "ARNs of the stop and start schedules by name (empty without scheduled_stop)"
+  value       = { for name, schedule in aws_scheduler_schedule.rds : name => schedule.arn }
+}
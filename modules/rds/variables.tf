@@ -28,9 +28,14 @@ variable "allowed_security_groups" {
 }
 
 variable "engine" {
-  description = "Database engine (mysql, postgres, etc.)"
+  description = "Database engine (postgres, mysql or mariadb)"
   type        = string
   default     = "postgres"
+
+  validation {
+    condition     = contains(["postgres", "mysql", "mariadb"], var.engine)
+    error_message = "engine must be one of postgres, mysql or mariadb."
+  }
 }
 
 variable "engine_version" {
@@ -46,9 +51,9 @@ variable "instance_class" {
 }
 
 variable "db_parameter_group_family" {
-  description = "Database parameter group family"
+  description = "Database parameter group family (defaults to the family of engine and engine_version, e.g. postgres15 or mysql8.0)"
   type        = string
-  default     = "postgres15"
+  default     = null
 }
 
 variable "db_parameters" {
@@ -76,12 +81,28 @@ variable "password" {
   description = "Master password for the database"
   type        = string
   sensitive   = true
+  validation {
+    condition     = can(regex("^[!#-.0-?A-~]{8,41}$", var.password))
+    error_message = "password must be 8 to 41 printable ASCII characters other than /, @, \" and space."
+  }
 }
 
 variable "port" {
-  description = "Port for the database"
+  description = "Port for the database (defaults to 5432 for postgres and 3306 for mysql and mariadb)"
   type        = number
-  default     = 5432
+  default     = null
+}
+
+variable "enabled_cloudwatch_logs_exports" {
+  description = "Log types to export to CloudWatch (defaults to every general-purpose log of the engine)"
+  type        = list(string)
+  default     = null
+}
+
+variable "iam_database_authentication_enabled" {
+  description = "Enable IAM database authentication (defaults to true for postgres and mysql, false for mariadb)"
+  type        = bool
+  default     = null
 }
 
 variable "allocated_storage" {
@@ -173,3 +194,18 @@ variable "tags" {
   type        = map(string)
   default     = {}
 }
+
+variable "scheduled_stop" {
+  description = "Stop and start the instance with EventBridge Scheduler on cron() schedules (null keeps it running). Meant for non-production environments"
+  type = object({
+    stop     = string
+    start    = string
+    timezone = optional(string, "UTC")
+  })
+  default = null
+
+  validation {
+    condition     = var.scheduled_stop == null || alltrue([for expression in [try(var.scheduled_stop.stop, ""), try(var.scheduled_stop.start, "")] : can(regex("^cron\\(.+\\)$", expression))])
+    error_message = "scheduled_stop stop and start must be cron() expressions."
+  }
+}
@@ -35,6 +35,8 @@ resource "aws_secretsmanager_secret_version" "database" {
     password = var.db_password
     host     = var.db_host
     port     = var.db_port
+    dbname   = var.db_name
+    # Old name of dbname, kept for readers of :database:: until the next release
     database = var.db_name
   })
 }
@@ -113,11 +115,13 @@ resource "aws_secretsmanager_secret_version" "dockerhub" {
 # Custom Secrets
 #------------------------------------------------------------------------------
 
+# The map is sensitive, but its keys and descriptions are not: they appear in
+# secret names and in the console
 resource "aws_secretsmanager_secret" "custom" {
-  for_each = var.custom_secrets
+  for_each = nonsensitive(toset(keys(var.custom_secrets)))
 
   name                    = "${var.project_name}/${var.environment}/${each.key}"
-  description             = each.value.description
+  description             = nonsensitive(var.custom_secrets[each.key].description)
   recovery_window_in_days = var.recovery_window_in_days
   kms_key_id              = var.create_kms_key ? aws_kms_key.secrets[0].id : var.kms_key_id
 
@@ -127,10 +131,10 @@ resource "aws_secretsmanager_secret" "custom" {
 }
 
 resource "aws_secretsmanager_secret_version" "custom" {
-  for_each = var.custom_secrets
+  for_each = nonsensitive(toset(keys(var.custom_secrets)))
 
   secret_id     = aws_secretsmanager_secret.custom[each.key].id
-  secret_string = jsonencode(each.value.value)
+  secret_string = jsonencode(var.custom_secrets[each.key].value)
 }
 
 #------------------------------------------------------------------------------
@@ -166,6 +170,13 @@ resource "aws_kms_key" "secrets" {
           "kms:GenerateDataKey"
         ]
         Resource = "*"
+        # Only through Secrets Manager, for tasks of this account
+        Condition = {
+          StringEquals = {
+            "kms:ViaService"    = "secretsmanager.${data.aws_region.current.name}.amazonaws.com"
+            "aws:SourceAccount" = data.aws_caller_identity.current.account_id
+          }
+        }
       }
     ]
   })
@@ -186,3 +197,5 @@ resource "aws_kms_alias" "secrets" {
 #------------------------------------------------------------------------------
 
 data "aws_caller_identity" "current" {}
+
+data "aws_region" "current" {}
@@ -13,9 +13,14 @@ variable "environment" {
 }
 
 variable "kms_key_id" {
-  description = "KMS key ID for encryption (if not creating a new one)"
+  description = "KMS key ID, key ARN, alias name or alias ARN for encryption (if not creating a new one)"
   type        = string
   default     = null
+
+  validation {
+    condition     = var.kms_key_id == null || can(regex("^(arn:aws[a-z-]*:kms:[a-z0-9-]+:[0-9]{12}:(key/[0-9a-f-]{36}|alias/[A-Za-z0-9/_-]+)|alias/[A-Za-z0-9/_-]+|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|mrk-[0-9a-f]{32})$", var.kms_key_id))
+    error_message = "kms_key_id must be a KMS key ID, key ARN, alias name (alias/...) or alias ARN."
+  }
 }
 
 variable "create_kms_key" {
@@ -44,6 +49,10 @@ variable "db_password" {
   description = "Database password"
   type        = string
   sensitive   = true
+  validation {
+    condition     = can(regex("^[!#-.0-?A-~]{8,41}$", var.db_password))
+    error_message = "db_password must be 8 to 41 printable ASCII characters other than /, @, \" and space."
+  }
 }
 
 variable "db_host" {
@@ -93,10 +102,15 @@ variable "splunk_admin_password" {
 }
 
 variable "splunk_hec_token" {
-  description = "Splunk HTTP Event Collector token"
+  description = "Splunk HTTP Event Collector token (a UUID)"
   type        = string
   sensitive   = true
   default     = ""
+
+  validation {
+    condition     = var.splunk_hec_token == "" || can(regex("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$", var.splunk_hec_token))
+    error_message = "splunk_hec_token must be a UUID, e.g. 00000000-0000-0000-0000-000000000000."
+  }
 }
 
 #------------------------------------------------------------------------------
@@ -133,7 +147,8 @@ variable "custom_secrets" {
     description = string
     value       = map(string)
   }))
-  default = {}
+  default   = {}
+  sensitive = true
 }
 
 variable "tags" {
@@ -13,6 +13,35 @@ terraform {
 # VPC Module - Network Infrastructure
 #------------------------------------------------------------------------------
 
+locals {
+  vpc_prefix_length = tonumber(split("/", var.vpc_cidr)[1])
+  vpc_network       = cidrhost(var.vpc_cidr, 0)
+
+  subnets = [
+    for cidr in concat(var.public_subnet_cidrs, var.private_subnet_cidrs) : {
+      cidr          = cidr
+      network       = cidrhost(cidr, 0)
+      prefix_length = tonumber(split("/", cidr)[1])
+    }
+  ]
+
+  # A subnet is inside the VPC when it is no larger than the VPC and its
+  # network address, masked to the VPC prefix length, is the VPC network.
+  subnets_outside_vpc = [
+    for subnet in local.subnets : subnet.cidr
+    if subnet.prefix_length < local.vpc_prefix_length || cidrhost("${subnet.network}/${local.vpc_prefix_length}", 0) != local.vpc_network
+  ]
+
+  # Two blocks overlap when they have the same network address at the
+  # shorter of their prefix lengths.
+  overlapping_subnets = flatten([
+    for i, a in local.subnets : [
+      for j, b in local.subnets : "${a.cidr} and ${b.cidr}"
+      if i < j && cidrhost("${a.network}/${min(a.prefix_length, b.prefix_length)}", 0) == cidrhost("${b.network}/${min(a.prefix_length, b.prefix_length)}", 0)
+    ]
+  ])
+}
+
 resource "aws_vpc" "main" {
   cidr_block           = var.vpc_cidr
   enable_dns_hostnames = var.enable_dns_hostnames
@@ -24,19 +53,69 @@ resource "aws_vpc" "main" {
       Name = "${var.project_name}-${var.environment}-vpc"
     }
   )
+
+  lifecycle {
+    precondition {
+      condition     = length(var.public_subnet_cidrs) == length(var.availability_zones) && length(var.private_subnet_cidrs) == length(var.availability_zones)
+      error_message = "public_subnet_cidrs and private_subnet_cidrs must each have one CIDR block per availability zone (${length(var.availability_zones)})."
+    }
+
+    precondition {
+      condition     = length(local.subnets_outside_vpc) == 0
+      error_message = "Subnet CIDR blocks must be inside vpc_cidr ${var.vpc_cidr}: ${join(", ", local.subnets_outside_vpc)}."
+    }
+
+    precondition {
+      condition     = length(local.overlapping_subnets) == 0
+      error_message = "Subnet CIDR blocks must not overlap: ${join(", ", local.overlapping_subnets)}."
+    }
+  }
 }
 
+#------------------------------------------------------------------------------
+# VPC Flow Logs
+#------------------------------------------------------------------------------
+
+locals {
+  flow_logs_to_cloudwatch = var.flow_log_destination_type == "cloud-watch-logs"
+  create_flow_log_bucket  = !local.flow_logs_to_cloudwatch && var.flow_log_s3_bucket_arn == null
+
+  # "${field} ${field} ..." in the order given, or the AWS default format
+  flow_log_format = length(var.flow_log_format_fields) > 0 ? join(" ", [for field in var.flow_log_format_fields : "$${${field}}"]) : null
+
+  flow_log_destination = local.flow_logs_to_cloudwatch ? aws_cloudwatch_log_group.vpc_flow_logs[0].arn : (
+    local.create_flow_log_bucket ? aws_s3_bucket.flow_logs[0].arn : var.flow_log_s3_bucket_arn
+  )
+
+  flow_log_bucket_name = "${var.project_name}-${var.environment}-vpc-flow-logs-${data.aws_caller_identity.current.account_id}"
+
+  # Log delivery writes under AWSLogs/<account>/, or under
+  # AWSLogs/aws-account-id=<account>/ with Hive-compatible partitions
+  flow_log_account_prefix = var.flow_log_hive_compatible_partitions ? "aws-account-id=${data.aws_caller_identity.current.account_id}" : data.aws_caller_identity.current.account_id
+}
+
+data "aws_caller_identity" "current" {}
+
 # CloudWatch Log Group for VPC Flow Logs
 resource "aws_cloudwatch_log_group" "vpc_flow_logs" {
+  count             = local.flow_logs_to_cloudwatch ? 1 : 0
   name              = "/aws/vpc/${var.project_name}-${var.environment}-flow-logs"
-  retention_in_days = 7
+  retention_in_days = var.flow_log_retention_in_days
 
   tags = var.tags
+
+  lifecycle {
+    precondition {
+      condition     = contains([1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653], var.flow_log_retention_in_days)
+      error_message = "flow_log_retention_in_days must be a retention period CloudWatch Logs supports, such as 7, 14, 30, 90 or 365."
+    }
+  }
 }
 
-# IAM Role for VPC Flow Logs
+# IAM Role for VPC Flow Logs, only needed to write to CloudWatch Logs
 resource "aws_iam_role" "vpc_flow_logs" {
-  name = "${var.project_name}-${var.environment}-vpc-flow-logs"
+  count = local.flow_logs_to_cloudwatch ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-vpc-flow-logs"
 
   assume_role_policy = jsonencode({
     Version = "2012-10-17"
@@ -56,8 +135,9 @@ resource "aws_iam_role" "vpc_flow_logs" {
 
 # IAM Policy for VPC Flow Logs
 resource "aws_iam_role_policy" "vpc_flow_logs" {
-  name = "${var.project_name}-${var.environment}-vpc-flow-logs"
-  role = aws_iam_role.vpc_flow_logs.id
+  count = local.flow_logs_to_cloudwatch ? 1 : 0
+  name  = "${var.project_name}-${var.environment}-vpc-flow-logs"
+  role  = aws_iam_role.vpc_flow_logs[0].id
 
   policy = jsonencode({
     Version = "2012-10-17"
@@ -77,12 +157,111 @@ resource "aws_iam_role_policy" "vpc_flow_logs" {
   })
 }
 
+# S3 bucket for VPC Flow Logs, unless flow_log_s3_bucket_arn names one
+resource "aws_s3_bucket" "flow_logs" {
+  count  = local.create_flow_log_bucket ? 1 : 0
+  bucket = local.flow_log_bucket_name
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-vpc-flow-logs"
+  })
+}
+
+resource "aws_s3_bucket_public_access_block" "flow_logs" {
+  count  = local.create_flow_log_bucket ? 1 : 0
+  bucket = aws_s3_bucket.flow_logs[0].id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "flow_logs" {
+  count  = local.create_flow_log_bucket ? 1 : 0
+  bucket = aws_s3_bucket.flow_logs[0].id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "flow_logs" {
+  count  = local.create_flow_log_bucket ? 1 : 0
+  bucket = aws_s3_bucket.flow_logs[0].id
+
+  rule {
+    id     = "expire-flow-logs"
+    status = "Enabled"
+
+    filter {}
+
+    expiration {
+      days = var.flow_log_retention_in_days
+    }
+  }
+}
+
+# Log delivery writes the flow logs; the conditions keep other accounts from
+# using it to write into the bucket
+resource "aws_s3_bucket_policy" "flow_logs" {
+  count  = local.create_flow_log_bucket ? 1 : 0
+  bucket = aws_s3_bucket.flow_logs[0].id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Sid       = "AWSLogDeliveryWrite"
+        Effect    = "Allow"
+        Principal = { Service = "delivery.logs.amazonaws.com" }
+        Action    = "s3:PutObject"
+        Resource  = "arn:aws:s3:::${local.flow_log_bucket_name}/AWSLogs/${local.flow_log_account_prefix}/*"
+        Condition = {
+          StringEquals = {
+            "s3:x-amz-acl"      = "bucket-owner-full-control"
+            "aws:SourceAccount" = data.aws_caller_identity.current.account_id
+          }
+        }
+      },
+      {
+        Sid       = "AWSLogDeliveryAclCheck"
+        Effect    = "Allow"
+        Principal = { Service = "delivery.logs.amazonaws.com" }
+        Action    = ["s3:GetBucketAcl", "s3:ListBucket"]
+        Resource  = "arn:aws:s3:::${local.flow_log_bucket_name}"
+        Condition = {
+          StringEquals = {
+            "aws:SourceAccount" = data.aws_caller_identity.current.account_id
+          }
+        }
+      }
+    ]
+  })
+
+  depends_on = [aws_s3_bucket_public_access_block.flow_logs]
+}
+
 # VPC Flow Logs
 resource "aws_flow_log" "main" {
-  iam_role_arn    = aws_iam_role.vpc_flow_logs.arn
-  log_destination = aws_cloudwatch_log_group.vpc_flow_logs.arn
-  traffic_type    = "ALL"
-  vpc_id          = aws_vpc.main.id
+  iam_role_arn             = local.flow_logs_to_cloudwatch ? aws_iam_role.vpc_flow_logs[0].arn : null
+  log_destination_type     = var.flow_log_destination_type
+  log_destination          = local.flow_log_destination
+  log_format               = local.flow_log_format
+  traffic_type             = var.flow_log_traffic_type
+  max_aggregation_interval = var.flow_log_max_aggregation_interval
+  vpc_id                   = aws_vpc.main.id
+
+  dynamic "destination_options" {
+    for_each = local.flow_logs_to_cloudwatch ? [] : [1]
+    content {
+      file_format                = var.flow_log_file_format
+      hive_compatible_partitions = var.flow_log_hive_compatible_partitions
+      per_hour_partition         = var.flow_log_per_hour_partition
+    }
+  }
 
   tags = merge(
     var.tags,
@@ -90,6 +269,30 @@ resource "aws_flow_log" "main" {
       Name = "${var.project_name}-${var.environment}-vpc-flow-logs"
     }
   )
+
+  lifecycle {
+    precondition {
+      condition     = !local.flow_logs_to_cloudwatch || (var.flow_log_s3_bucket_arn == null && var.flow_log_file_format == "plain-text" && !var.flow_log_hive_compatible_partitions && !var.flow_log_per_hour_partition)
+      error_message = "flow_log_s3_bucket_arn, flow_log_file_format, flow_log_hive_compatible_partitions and flow_log_per_hour_partition only apply to the s3 destination."
+    }
+  }
+
+  depends_on = [aws_s3_bucket_policy.flow_logs]
+}
+
+moved {
+  from = aws_cloudwatch_log_group.vpc_flow_logs
+  to   = aws_cloudwatch_log_group.vpc_flow_logs[0]
+}
+
+moved {
+  from = aws_iam_role.vpc_flow_logs
+  to   = aws_iam_role.vpc_flow_logs[0]
+}
+
+moved {
+  from = aws_iam_role_policy.vpc_flow_logs
+  to   = aws_iam_role_policy.vpc_flow_logs[0]
 }
 
 #------------------------------------------------------------------------------
@@ -138,27 +341,42 @@ resource "aws_subnet" "private" {
 }
 
 #------------------------------------------------------------------------------
-# NAT Gateway (for private subnet internet access)
+# NAT Gateways (for private subnet internet access)
 #------------------------------------------------------------------------------
 
+locals {
+  nat_gateway_mode = coalesce(var.nat_gateway_mode, var.enable_nat_gateway ? "single" : "none")
+  per_az           = local.nat_gateway_mode == "per_az"
+
+  nat_gateway_count = {
+    none   = 0
+    single = 1
+    per_az = length(var.availability_zones)
+  }[local.nat_gateway_mode]
+
+  # One private route table per zone in per_az mode, so each zone keeps its
+  # egress when another zone fails
+  private_route_table_count = local.per_az ? length(var.availability_zones) : 1
+}
+
 resource "aws_eip" "nat" {
-  count  = var.enable_nat_gateway ? 1 : 0
+  count  = local.nat_gateway_count
   domain = "vpc"
 
   tags = merge(var.tags, {
-    Name = "${var.project_name}-${var.environment}-nat-eip"
+    Name = local.per_az ? "${var.project_name}-${var.environment}-nat-eip-${var.availability_zones[count.index]}" : "${var.project_name}-${var.environment}-nat-eip"
   })
 
   depends_on = [aws_internet_gateway.main]
 }
 
 resource "aws_nat_gateway" "main" {
-  count         = var.enable_nat_gateway ? 1 : 0
-  allocation_id = aws_eip.nat[0].id
-  subnet_id     = aws_subnet.public[0].id
+  count         = local.nat_gateway_count
+  allocation_id = aws_eip.nat[count.index].id
+  subnet_id     = aws_subnet.public[count.index].id
 
   tags = merge(var.tags, {
-    Name = "${var.project_name}-${var.environment}-nat-gw"
+    Name = local.per_az ? "${var.project_name}-${var.environment}-nat-gw-${var.availability_zones[count.index]}" : "${var.project_name}-${var.environment}-nat-gw"
   })
 
   depends_on = [aws_internet_gateway.main]
@@ -181,22 +399,30 @@ resource "aws_route_table" "public" {
   })
 }
 
+# Route table i routes through NAT gateway i in per_az mode and through the
+# only NAT gateway in single mode
 resource "aws_route_table" "private" {
+  count  = local.private_route_table_count
   vpc_id = aws_vpc.main.id
 
   dynamic "route" {
-    for_each = var.enable_nat_gateway ? [1] : []
+    for_each = local.nat_gateway_count > 0 ? [1] : []
     content {
       cidr_block     = "0.0.0.0/0"
-      nat_gateway_id = aws_nat_gateway.main[0].id
+      nat_gateway_id = aws_nat_gateway.main[local.per_az ? count.index : 0].id
     }
   }
 
   tags = merge(var.tags, {
-    Name = "${var.project_name}-${var.environment}-private-rt"
+    Name = local.per_az ? "${var.project_name}-${var.environment}-private-rt-${var.availability_zones[count.index]}" : "${var.project_name}-${var.environment}-private-rt"
   })
 }
 
+moved {
+  from = aws_route_table.private
+  to   = aws_route_table.private[0]
+}
+
 #------------------------------------------------------------------------------
 # Route Table Associations
 #------------------------------------------------------------------------------
@@ -210,5 +436,69 @@ resource "aws_route_table_association" "public" {
 resource "aws_route_table_association" "private" {
   count          = length(aws_subnet.private)
   subnet_id      = aws_subnet.private[count.index].id
-  route_table_id = aws_route_table.private.id
+  route_table_id = aws_route_table.private[local.per_az ? count.index : 0].id
+}
+
+#------------------------------------------------------------------------------
+# VPC Endpoints (keep AWS API traffic of private subnets off the NAT gateways)
+#------------------------------------------------------------------------------
+
+data "aws_region" "current" {}
+
+# Gateway endpoints add a route to the service prefix list in every private
+# route table
+resource "aws_vpc_endpoint" "gateway" {
+  for_each = toset(var.gateway_endpoints)
+
+  vpc_id            = aws_vpc.main.id
+  service_name      = "com.amazonaws.${data.aws_region.current.name}.${each.key}"
+  vpc_endpoint_type = "Gateway"
+  route_table_ids   = aws_route_table.private[*].id
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-${each.key}-endpoint"
+  })
+}
+
+resource "aws_security_group" "vpc_endpoints" {
+  count       = length(var.interface_endpoints) > 0 ? 1 : 0
+  name        = "${var.project_name}-${var.environment}-vpc-endpoints-sg"
+  description = "Security group for VPC interface endpoints"
+  vpc_id      = aws_vpc.main.id
+
+  ingress {
+    description = "HTTPS from the VPC"
+    from_port   = 443
+    to_port     = 443
+    protocol    = "tcp"
+    cidr_blocks = [var.vpc_cidr]
+  }
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-vpc-endpoints-sg"
+  })
+}
+
+# Interface endpoints place a network interface in every private subnet. With
+# private DNS the default service hostnames resolve to those interfaces.
+resource "aws_vpc_endpoint" "interface" {
+  for_each = toset(var.interface_endpoints)
+
+  vpc_id              = aws_vpc.main.id
+  service_name        = "com.amazonaws.${data.aws_region.current.name}.${each.key}"
+  vpc_endpoint_type   = "Interface"
+  subnet_ids          = aws_subnet.private[*].id
+  security_group_ids  = [aws_security_group.vpc_endpoints[0].id]
+  private_dns_enabled = true
+
+  tags = merge(var.tags, {
+    Name = "${var.project_name}-${var.environment}-${replace(each.key, ".", "-")}-endpoint"
+  })
+
+  lifecycle {
+    precondition {
+      condition     = var.enable_dns_support && var.enable_dns_hostnames
+      error_message = "Interface endpoints use private DNS, which needs enable_dns_support and enable_dns_hostnames."
+    }
+  }
 }
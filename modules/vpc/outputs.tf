@@ -28,8 +28,13 @@ output "internet_gateway_id" {
 }
 
 output "nat_gateway_id" {
-  description = "ID of the NAT Gateway"
-  value       = var.enable_nat_gateway ? aws_nat_gateway.main[0].id : null
+  description = "ID of the first NAT Gateway"
+  value       = length(aws_nat_gateway.main) > 0 ? aws_nat_gateway.main[0].id : null
+}
+
+output "nat_gateway_ids" {
+  description = "List of NAT Gateway IDs, one per availability zone in per_az mode"
+  value       = aws_nat_gateway.main[*].id
 }
 
 output "public_route_table_id" {
@@ -38,6 +43,34 @@ output "public_route_table_id" {
 }
 
 output "private_route_table_id" {
-  description = "ID of the private route table"
-  value       = aws_route_table.private.id
+  description = "ID of the first private route table"
+  value       = aws_route_table.private[0].id
+}
+
+output "private_route_table_ids" {
+  description = "List of private route table IDs, one per availability zone in per_az mode"
+  value       = aws_route_table.private[*].id
+}
+
+output "vpc_endpoint_ids" {
+  description = "Map of service name to VPC endpoint ID"
+  value = merge(
+    { for service, endpoint in aws_vpc_endpoint.gateway : service => endpoint.id },
+    { for service, endpoint in aws_vpc_endpoint.interface : service => endpoint.id },
+  )
+}
+
+output "vpc_endpoints_security_group_id" {
+  description = "ID of the security group of the interface endpoints"
+  value       = length(aws_security_group.vpc_endpoints) > 0 ? aws_security_group.vpc_endpoints[0].id : null
+}
+
+output "flow_log_id" {
+  description = "ID of the VPC Flow Log"
+  value       = aws_flow_log.main.id
+}
+
+output "flow_log_destination_arn" {
+  description = "ARN of the CloudWatch log group or S3 bucket receiving the VPC Flow Logs"
+  value       = local.flow_log_destination
 }
@@ -16,31 +16,208 @@ variable "vpc_cidr" {
   description = "CIDR block for the VPC"
   type        = string
   default     = "10.0.0.0/16"
+
+  validation {
+    condition     = can(regex("^((25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\\.){3}(25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])/([0-9]|[12][0-9]|3[0-2])$", var.vpc_cidr))
+    error_message = "vpc_cidr must be an IPv4 CIDR block such as 10.0.0.0/16."
+  }
+
+  validation {
+    condition     = try(cidrhost(var.vpc_cidr, 0) == split("/", var.vpc_cidr)[0], false)
+    error_message = "vpc_cidr must not have host bits set, such as 10.0.0.5/16 for 10.0.0.0/16."
+  }
+
+  validation {
+    condition     = can(regex("/(1[6-9]|2[0-8])$", var.vpc_cidr))
+    error_message = "vpc_cidr must have a prefix length between /16 and /28."
+  }
 }
 
 variable "public_subnet_cidrs" {
   description = "List of CIDR blocks for public subnets"
   type        = list(string)
   default     = ["10.0.1.0/24", "10.0.2.0/24"]
+
+  validation {
+    condition     = alltrue([for cidr in var.public_subnet_cidrs : can(regex("^((25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\\.){3}(25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])/([0-9]|[12][0-9]|3[0-2])$", cidr))])
+    error_message = "public_subnet_cidrs must only contain IPv4 CIDR blocks such as 10.0.1.0/24."
+  }
+
+  validation {
+    condition     = alltrue([for cidr in var.public_subnet_cidrs : try(cidrhost(cidr, 0) == split("/", cidr)[0], false)])
+    error_message = "public_subnet_cidrs must not have host bits set, such as 10.0.1.5/24 for 10.0.1.0/24."
+  }
+
+  validation {
+    condition     = alltrue([for cidr in var.public_subnet_cidrs : can(regex("/(1[6-9]|2[0-8])$", cidr))])
+    error_message = "public_subnet_cidrs must have prefix lengths between /16 and /28."
+  }
 }
 
 variable "private_subnet_cidrs" {
   description = "List of CIDR blocks for private subnets"
   type        = list(string)
   default     = ["10.0.10.0/24", "10.0.11.0/24"]
+
+  validation {
+    condition     = alltrue([for cidr in var.private_subnet_cidrs : can(regex("^((25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\\.){3}(25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])/([0-9]|[12][0-9]|3[0-2])$", cidr))])
+    error_message = "private_subnet_cidrs must only contain IPv4 CIDR blocks such as 10.0.1.0/24."
+  }
+
+  validation {
+    condition     = alltrue([for cidr in var.private_subnet_cidrs : try(cidrhost(cidr, 0) == split("/", cidr)[0], false)])
+    error_message = "private_subnet_cidrs must not have host bits set, such as 10.0.1.5/24 for 10.0.1.0/24."
+  }
+
+  validation {
+    condition     = alltrue([for cidr in var.private_subnet_cidrs : can(regex("/(1[6-9]|2[0-8])$", cidr))])
+    error_message = "private_subnet_cidrs must have prefix lengths between /16 and /28."
+  }
 }
 
 variable "availability_zones" {
-  description = "List of availability zones"
+  description = "List of availability zones, one public and one private subnet per zone"
   type        = list(string)
+
+  validation {
+    condition     = length(var.availability_zones) > 0
+    error_message = "availability_zones must contain at least one zone."
+  }
 }
 
 variable "enable_nat_gateway" {
-  description = "Enable NAT Gateway for private subnets"
+  description = "Enable a single NAT Gateway for private subnets. Ignored when nat_gateway_mode is set"
   type        = bool
   default     = true
 }
 
+variable "nat_gateway_mode" {
+  description = "NAT Gateways for private subnets: none, single (one shared gateway) or per_az (one gateway and private route table per availability zone). Defaults to single or none from enable_nat_gateway"
+  type        = string
+  default     = null
+
+  validation {
+    condition     = contains(["none", "single", "per_az"], coalesce(var.nat_gateway_mode, "single"))
+    error_message = "nat_gateway_mode must be none, single or per_az."
+  }
+}
+
+variable "gateway_endpoints" {
+  description = "Services to create gateway endpoints for in the private route tables (s3, dynamodb)"
+  type        = list(string)
+  default     = []
+
+  validation {
+    condition     = alltrue([for service in var.gateway_endpoints : contains(["s3", "dynamodb"], service)])
+    error_message = "gateway_endpoints must only contain s3 and dynamodb."
+  }
+}
+
+variable "interface_endpoints" {
+  description = "Services to create interface endpoints with private DNS for in the private subnets, e.g. secretsmanager, ecr.api, ecr.dkr, logs, kms"
+  type        = list(string)
+  default     = []
+
+  validation {
+    condition     = alltrue([for service in var.interface_endpoints : can(regex("^[a-z][a-z0-9-]*(\\.[a-z][a-z0-9-]*)*$", service)) && !startswith(service, "com.amazonaws.")])
+    error_message = "interface_endpoints must contain service names without the com.amazonaws.<region> prefix, such as secretsmanager or ecr.dkr."
+  }
+
+  validation {
+    condition     = alltrue([for service in var.interface_endpoints : !contains(["s3", "dynamodb"], service)])
+    error_message = "Use gateway_endpoints for s3 and dynamodb; their gateway endpoints have no hourly charge."
+  }
+}
+
+variable "flow_log_destination_type" {
+  description = "Destination of the VPC flow logs: cloud-watch-logs or s3"
+  type        = string
+  default     = "cloud-watch-logs"
+
+  validation {
+    condition     = contains(["cloud-watch-logs", "s3"], var.flow_log_destination_type)
+    error_message = "flow_log_destination_type must be cloud-watch-logs or s3."
+  }
+}
+
+variable "flow_log_traffic_type" {
+  description = "Traffic captured by the VPC flow logs: ACCEPT, REJECT or ALL"
+  type        = string
+  default     = "ALL"
+
+  validation {
+    condition     = contains(["ACCEPT", "REJECT", "ALL"], var.flow_log_traffic_type)
+    error_message = "flow_log_traffic_type must be ACCEPT, REJECT or ALL."
+  }
+}
+
+variable "flow_log_format_fields" {
+  description = "Flow log record fields in order, e.g. [\"srcaddr\", \"dstaddr\", \"action\"]. Empty uses the AWS default format"
+  type        = list(string)
+  default     = []
+
+  validation {
+    condition     = alltrue([for field in var.flow_log_format_fields : can(regex("^[a-z][a-z0-9-]*$", field))])
+    error_message = "flow_log_format_fields must contain field names such as srcaddr or pkt-srcaddr, without the $${} wrapper."
+  }
+}
+
+variable "flow_log_max_aggregation_interval" {
+  description = "Maximum interval in seconds during which a flow is captured into a record: 60 or 600"
+  type        = number
+  default     = 600
+
+  validation {
+    condition     = contains([60, 600], var.flow_log_max_aggregation_interval)
+    error_message = "flow_log_max_aggregation_interval must be 60 or 600."
+  }
+}
+
+variable "flow_log_retention_in_days" {
+  description = "Days to keep flow logs, as the log group retention or the expiration of the created S3 bucket"
+  type        = number
+  default     = 7
+
+  validation {
+    condition     = var.flow_log_retention_in_days > 0 && floor(var.flow_log_retention_in_days) == var.flow_log_retention_in_days
+    error_message = "flow_log_retention_in_days must be a positive whole number of days."
+  }
+}
+
+variable "flow_log_s3_bucket_arn" {
+  description = "ARN of an existing S3 bucket, optionally with a key prefix, for the s3 destination. A bucket is created when null"
+  type        = string
+  default     = null
+
+  validation {
+    condition     = var.flow_log_s3_bucket_arn == null || can(regex("^arn:aws[a-z-]*:s3:::[a-z0-9][a-z0-9.-]{1,61}[a-z0-9](/.*)?$", coalesce(var.flow_log_s3_bucket_arn, "-")))
+    error_message = "flow_log_s3_bucket_arn must be an S3 bucket ARN such as arn:aws:s3:::my-bucket or arn:aws:s3:::my-bucket/prefix."
+  }
+}
+
+variable "flow_log_file_format" {
+  description = "Format of flow log files in S3: plain-text or parquet"
+  type        = string
+  default     = "plain-text"
+
+  validation {
+    condition     = contains(["plain-text", "parquet"], var.flow_log_file_format)
+    error_message = "flow_log_file_format must be plain-text or parquet."
+  }
+}
+
+variable "flow_log_hive_compatible_partitions" {
+  description = "Use Hive-compatible S3 prefixes (key=value) so Athena can load partitions"
+  type        = bool
+  default     = false
+}
+
+variable "flow_log_per_hour_partition" {
+  description = "Partition flow log files in S3 per hour instead of per day"
+  type        = bool
+  default     = false
+}
+
 variable "enable_dns_hostnames" {
   description = "Enable DNS hostnames in the VPC"
   type        = bool
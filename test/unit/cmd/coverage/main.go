@@ -0,0 +1,123 @@
+// Command coverage reports which module variables and count/for_each branches
+// the plan-based module tests exercise.
+//
+// Usage:
+//
+//	MODULE_COVERAGE_DIR=$PWD/.coverage go test -run 'TestCost|TestTag' ./...
+//	go run ./cmd/coverage -records .coverage -json coverage.json -threshold 60
+//
+// The command exits with status 1 when a module is below the threshold.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/coverage"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	records := flag.String("records", os.Getenv(coverage.EnvDir), "directory containing the test records (default $"+coverage.EnvDir+")")
+	modulesDir := flag.String("modules", "../../modules", "directory containing the Terraform modules")
+	only := flag.String("module", "", "comma-separated modules to report (default all)")
+	jsonOut := flag.String("json", "", "write the JSON report to this file (\"-\" for stdout)")
+	threshold := flag.Float64("threshold", 0, "minimum coverage percentage per module")
+	flag.Parse()
+
+	if *records == "" {
+		fmt.Fprintf(os.Stderr, "coverage: -records or $%s is required\n", coverage.EnvDir)
+		return 1
+	}
+
+	modules, err := moduleNames(*modulesDir, *only)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "coverage: %v\n", err)
+		return 1
+	}
+
+	recs, err := coverage.ReadRecords(*records)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "coverage: %v\n", err)
+		return 1
+	}
+
+	report, err := coverage.Analyze(*modulesDir, modules, recs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "coverage: %v\n", err)
+		return 1
+	}
+
+	if *jsonOut != "-" {
+		if err := coverage.WriteText(os.Stdout, report); err != nil {
+			fmt.Fprintf(os.Stderr, "coverage: %v\n", err)
+			return 1
+		}
+	}
+	if *jsonOut != "" {
+		if err := writeJSON(*jsonOut, report); err != nil {
+			fmt.Fprintf(os.Stderr, "coverage: %v\n", err)
+			return 1
+		}
+	}
+
+	if below := report.BelowThreshold(*threshold); len(below) > 0 {
+		for _, m := range below {
+			fmt.Fprintf(os.Stderr, "coverage: %s is at %.1f%%, below the %.1f%% threshold\n", m.Module, m.Percent(), *threshold)
+		}
+		return 1
+	}
+	return 0
+}
+
+// moduleNames returns the modules listed in only, or every directory under
+// modulesDir.
+func moduleNames(modulesDir, only string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		return names, nil
+	}
+
+	entries, err := os.ReadDir(modulesDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no modules found under %s", filepath.Clean(modulesDir))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func writeJSON(path string, report coverage.Report) error {
+	if path == "-" {
+		return coverage.WriteJSON(os.Stdout, report)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := coverage.WriteJSON(f, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
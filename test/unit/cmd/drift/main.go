@@ -0,0 +1,127 @@
+// Command drift runs a refresh-only plan for every Terragrunt stack under
+// environments/ and reports out-of-band changes as JSON, JUnit XML and
+// Markdown.
+//
+// Usage:
+//
+//	go run ./cmd/drift -root ../.. -env staging,production \
+//	    -json drift.json -junit drift.xml -markdown drift.md
+//
+// The command exits with status 2 when drift is detected and 1 when a stack
+// could not be checked.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/drift"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	root := flag.String("root", "../..", "repository root containing the environments/ directory")
+	envs := flag.String("env", "staging,production", "comma-separated environments to check (empty for all)")
+	module := flag.String("module", "", "only check the named module")
+	binary := flag.String("terragrunt", "terragrunt", "terragrunt executable")
+	jsonOut := flag.String("json", "", "write the JSON report to this file")
+	junitOut := flag.String("junit", "", "write the JUnit XML report to this file")
+	markdownOut := flag.String("markdown", "", "write the Markdown report to this file (\"-\" for stdout)")
+	verbose := flag.Bool("v", false, "stream terragrunt output to stderr")
+	flag.Parse()
+
+	var filter []string
+	for _, env := range strings.Split(*envs, ",") {
+		if env = strings.TrimSpace(env); env != "" {
+			filter = append(filter, env)
+		}
+	}
+
+	targets, err := drift.Discover(*root, filter...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drift: %v\n", err)
+		return 1
+	}
+	if *module != "" {
+		var selected []drift.Target
+		for _, target := range targets {
+			if target.Module == *module {
+				selected = append(selected, target)
+			}
+		}
+		targets = selected
+	}
+	if len(targets) == 0 {
+		fmt.Fprintf(os.Stderr, "drift: no stacks found under %s/environments\n", *root)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	runner := &drift.Runner{Binary: *binary}
+	if *verbose {
+		runner.Log = os.Stderr
+	}
+
+	report := drift.Report{GeneratedAt: time.Now().UTC()}
+	for _, target := range targets {
+		fmt.Fprintf(os.Stderr, "checking %s\n", target.Name())
+		report.Results = append(report.Results, runner.Check(ctx, target))
+	}
+
+	writers := []struct {
+		path  string
+		write func(io.Writer, drift.Report) error
+	}{
+		{*jsonOut, drift.WriteJSON},
+		{*junitOut, drift.WriteJUnit},
+		{*markdownOut, drift.WriteMarkdown},
+	}
+	for _, w := range writers {
+		if w.path == "" {
+			continue
+		}
+		if err := writeReport(w.path, report, w.write); err != nil {
+			fmt.Fprintf(os.Stderr, "drift: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d stack(s) checked, %d drifted, %d failed\n",
+		len(report.Results), report.DriftedCount(), report.ErrorCount())
+
+	switch {
+	case report.ErrorCount() > 0:
+		return 1
+	case report.DriftedCount() > 0:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func writeReport(path string, report drift.Report, write func(io.Writer, drift.Report) error) error {
+	if path == "-" {
+		return write(os.Stdout, report)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
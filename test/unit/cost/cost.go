@@ -0,0 +1,641 @@
+// Package cost estimates the monthly AWS cost of a Terraform plan offline.
+//
+// Prices come from a checked-in price table (prices/<region>.json) rather than
+// the AWS Pricing API, so estimates are deterministic and can be asserted in
+// tests. RDS instances and storage, EC2 instances, EBS volumes, ALBs, NAT
+// gateways, Elastic IPs, interface VPC endpoints, Fargate tasks, WAF web ACLs,
+// KMS keys, Secrets Manager secrets and CloudWatch alarms are priced from the
+// plan; S3, EFS and CloudWatch Logs storage from Usage. Every other resource
+// type must be listed in unmetered, so a new billable type fails the estimate
+// instead of being left out of it.
+package cost
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed prices/*.json
+var priceFiles embed.FS
+
+// PriceTable holds on-demand prices for a single region. Hourly prices are
+// converted to monthly prices using HoursPerMonth.
+type PriceTable struct {
+	Region        string  `json:"region"`
+	Currency      string  `json:"currency"`
+	EffectiveDate string  `json:"effective_date"`
+	HoursPerMonth float64 `json:"hours_per_month"`
+
+	RDS struct {
+		InstanceHourly            map[string]map[string]float64 `json:"instance_hourly"`
+		MultiAZMultiplier         float64                       `json:"multi_az_multiplier"`
+		StorageGBMonth            map[string]float64            `json:"storage_gb_month"`
+		GP3BaselineIOPS           float64                       `json:"gp3_baseline_iops"`
+		GP3BaselineThroughputMBps float64                       `json:"gp3_baseline_throughput_mbps"`
+		GP3IOPSMonth              float64                       `json:"gp3_iops_month"`
+		GP3ThroughputMBpsMonth    float64                       `json:"gp3_throughput_mbps_month"`
+		IO1IOPSMonth              float64                       `json:"io1_iops_month"`
+	} `json:"rds"`
+
+	EC2 struct {
+		InstanceHourly map[string]float64 `json:"instance_hourly"`
+	} `json:"ec2"`
+
+	EBS struct {
+		VolumeGBMonth             map[string]float64 `json:"volume_gb_month"`
+		GP3BaselineIOPS           float64            `json:"gp3_baseline_iops"`
+		GP3BaselineThroughputMBps float64            `json:"gp3_baseline_throughput_mbps"`
+		GP3IOPSMonth              float64            `json:"gp3_iops_month"`
+		GP3ThroughputMBpsMonth    float64            `json:"gp3_throughput_mbps_month"`
+		ProvisionedIOPSMonth      float64            `json:"provisioned_iops_month"`
+	} `json:"ebs"`
+
+	ALB struct {
+		Hourly    float64 `json:"hourly"`
+		LCUHourly float64 `json:"lcu_hourly"`
+	} `json:"alb"`
+
+	NATGateway struct {
+		Hourly          float64 `json:"hourly"`
+		DataProcessedGB float64 `json:"data_processed_gb"`
+	} `json:"nat_gateway"`
+
+	EIP struct {
+		Hourly float64 `json:"hourly"`
+	} `json:"eip"`
+
+	Fargate struct {
+		VCPUHourly float64 `json:"vcpu_hourly"`
+		GBHourly   float64 `json:"gb_hourly"`
+	} `json:"fargate"`
+
+	KMS struct {
+		KeyMonth float64 `json:"key_month"`
+	} `json:"kms"`
+
+	SecretsManager struct {
+		SecretMonth float64 `json:"secret_month"`
+	} `json:"secrets_manager"`
+
+	VPCEndpoint struct {
+		InterfaceENIHourly float64 `json:"interface_eni_hourly"`
+		DataProcessedGB    float64 `json:"data_processed_gb"`
+	} `json:"vpc_endpoint"`
+
+	S3 struct {
+		StandardGBMonth float64 `json:"standard_gb_month"`
+	} `json:"s3"`
+
+	EFS struct {
+		StandardGBMonth float64 `json:"standard_gb_month"`
+	} `json:"efs"`
+
+	WAF struct {
+		WebACLMonth     float64 `json:"web_acl_month"`
+		RuleMonth       float64 `json:"rule_month"`
+		RequestsMillion float64 `json:"requests_million"`
+	} `json:"waf"`
+
+	CloudWatch struct {
+		AlarmMonth        float64 `json:"alarm_month"`
+		LogsIngestGB      float64 `json:"logs_ingest_gb"`
+		LogsStoredGBMonth float64 `json:"logs_stored_gb_month"`
+	} `json:"cloudwatch"`
+}
+
+// unmetered lists the managed resource types that have no charge of their own.
+// Their usage is billed through another resource, such as the log group or
+// bucket a flow log delivers to.
+var unmetered = map[string]bool{
+	"aws_appautoscaling_policy":                          true,
+	"aws_appautoscaling_scheduled_action":                true,
+	"aws_appautoscaling_target":                          true,
+	"aws_codedeploy_app":                                 true,
+	"aws_codedeploy_deployment_group":                    true,
+	"aws_db_parameter_group":                             true,
+	"aws_db_subnet_group":                                true,
+	"aws_ecs_cluster":                                    true,
+	"aws_ecs_task_definition":                            true,
+	"aws_efs_access_point":                               true,
+	"aws_efs_mount_target":                               true,
+	"aws_flow_log":                                       true,
+	"aws_iam_instance_profile":                           true,
+	"aws_iam_role":                                       true,
+	"aws_iam_role_policy":                                true,
+	"aws_iam_role_policy_attachment":                     true,
+	"aws_internet_gateway":                               true,
+	"aws_key_pair":                                       true,
+	"aws_kms_alias":                                      true,
+	"aws_lb_listener":                                    true,
+	"aws_lb_target_group":                                true,
+	"aws_route_table":                                    true,
+	"aws_route_table_association":                        true,
+	"aws_s3_bucket_lifecycle_configuration":              true,
+	"aws_s3_bucket_policy":                               true,
+	"aws_s3_bucket_public_access_block":                  true,
+	"aws_s3_bucket_server_side_encryption_configuration": true,
+	"aws_scheduler_schedule":                             true,
+	"aws_secretsmanager_secret_version":                  true,
+	"aws_security_group":                                 true,
+	"aws_subnet":                                         true,
+	"aws_volume_attachment":                              true,
+	"aws_vpc":                                            true,
+	"aws_wafv2_ip_set":                                   true,
+	"aws_wafv2_web_acl_association":                      true,
+	"aws_wafv2_web_acl_logging_configuration":            true,
+}
+
+// LoadPriceTable returns the checked-in price table for a region.
+func LoadPriceTable(region string) (*PriceTable, error) {
+	data, err := priceFiles.ReadFile("prices/" + region + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("no price table for region %q: %w", region, err)
+	}
+
+	var table PriceTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("parsing price table for region %q: %w", region, err)
+	}
+	return &table, nil
+}
+
+// Usage holds the usage-based quantities a plan cannot express. The zero
+// value assumes one ALB capacity unit and no data processing, requests or
+// storage.
+type Usage struct {
+	// ALBCapacityUnits is the average number of LCUs per ALB.
+	ALBCapacityUnits float64
+
+	// NATProcessedGB is the monthly data processed per NAT gateway in GB.
+	NATProcessedGB float64
+
+	// EndpointProcessedGB is the monthly data processed per interface VPC
+	// endpoint in GB.
+	EndpointProcessedGB float64
+
+	// WAFRequestsMillion is the monthly number of requests per web ACL in
+	// millions.
+	WAFRequestsMillion float64
+
+	// EFSStorageGB is the average data stored per EFS file system in GB.
+	EFSStorageGB float64
+
+	// S3StorageGB is the average data stored per S3 bucket in GB.
+	S3StorageGB float64
+
+	// LogsIngestedGB is the monthly data ingested per CloudWatch log group in
+	// GB, and LogsStoredGB the average data it stores.
+	LogsIngestedGB float64
+	LogsStoredGB   float64
+}
+
+// LineItem is a single priced component of a resource.
+type LineItem struct {
+	Address   string  `json:"address"`
+	Component string  `json:"component"`
+	Quantity  float64 `json:"quantity"`
+	Unit      string  `json:"unit"`
+	UnitPrice float64 `json:"unit_price"`
+	Monthly   float64 `json:"monthly"`
+}
+
+// Estimate is the monthly cost of one module in one environment.
+type Estimate struct {
+	Module      string     `json:"module"`
+	Environment string     `json:"environment"`
+	Currency    string     `json:"currency"`
+	Items       []LineItem `json:"items"`
+}
+
+// MonthlyTotal returns the sum of all line items.
+func (e Estimate) MonthlyTotal() float64 {
+	total := 0.0
+	for _, item := range e.Items {
+		total += item.Monthly
+	}
+	return total
+}
+
+// CheckBudget returns an error listing the line items if the estimate exceeds
+// limit per month.
+func (e Estimate) CheckBudget(limit float64) error {
+	total := e.MonthlyTotal()
+	if total <= limit {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s/%s costs %.2f %s/month, budget is %.2f", e.Environment, e.Module, total, e.Currency, limit)
+	for _, item := range e.Items {
+		msg += fmt.Sprintf("\n  %-50s %-28s %10.2f", item.Address, item.Component, item.Monthly)
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// AssertUnderBudget fails the test if the estimate exceeds limit per month.
+func AssertUnderBudget(t assert.TestingT, e Estimate, limit float64) bool {
+	if err := e.CheckBudget(limit); err != nil {
+		return assert.Fail(t, "monthly cost over budget", err.Error())
+	}
+	return true
+}
+
+// ParsePlanJSON decodes the output of `terraform show -json`.
+func ParsePlanJSON(data []byte) (*tfjson.Plan, error) {
+	var plan tfjson.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("parsing plan JSON: %w", err)
+	}
+	return &plan, nil
+}
+
+// EstimatePlan prices every planned resource in plan. An error is returned if
+// a resource type is neither priced nor unmetered, or if a priced resource
+// type uses a class or volume type missing from the price table, so the table
+// has to be extended rather than silently under-reporting.
+func (p *PriceTable) EstimatePlan(module, environment string, plan *tfjson.Plan, usage Usage) (Estimate, error) {
+	est := Estimate{Module: module, Environment: environment, Currency: p.Currency}
+	if plan == nil || plan.PlannedValues == nil || plan.PlannedValues.RootModule == nil {
+		return est, nil
+	}
+
+	resources := collectResources(plan.PlannedValues.RootModule)
+
+	var taskDefinitions []*tfjson.StateResource
+	privateSubnets := 0
+	for _, r := range resources {
+		if r.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		switch {
+		case r.Type == "aws_ecs_task_definition":
+			taskDefinitions = append(taskDefinitions, r)
+		case r.Type == "aws_subnet" && r.Name == "private":
+			privateSubnets++
+		}
+	}
+
+	for _, r := range resources {
+		if r.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+
+		var items []LineItem
+		var err error
+
+		switch r.Type {
+		case "aws_db_instance":
+			items, err = p.rdsInstance(r)
+		case "aws_instance":
+			items, err = p.ec2Instance(r)
+		case "aws_ebs_volume":
+			items, err = p.ebsVolume(r.Address, "volume", r.AttributeValues)
+		case "aws_lb":
+			items = p.loadBalancer(r, usage)
+		case "aws_nat_gateway":
+			items = p.natGateway(r, usage)
+		case "aws_eip":
+			items = []LineItem{p.hourly(r.Address, "public IPv4 address", 1, "address", p.EIP.Hourly)}
+		case "aws_ecs_service":
+			items, err = p.fargateService(r, taskDefinitions)
+		case "aws_kms_key":
+			items = []LineItem{monthly(r.Address, "customer managed key", 1, "key", p.KMS.KeyMonth)}
+		case "aws_secretsmanager_secret":
+			items = []LineItem{monthly(r.Address, "secret", 1, "secret", p.SecretsManager.SecretMonth)}
+		case "aws_cloudwatch_log_group":
+			items = p.logGroup(r, usage)
+		case "aws_vpc_endpoint":
+			items = p.vpcEndpoint(r, privateSubnets, usage)
+		case "aws_s3_bucket":
+			items = storage(r.Address, "S3 Standard storage", usage.S3StorageGB, p.S3.StandardGBMonth)
+		case "aws_cloudwatch_metric_alarm":
+			items = []LineItem{monthly(r.Address, "metric alarm", 1, "alarm", p.CloudWatch.AlarmMonth)}
+		case "aws_efs_file_system":
+			items = storage(r.Address, "EFS Standard storage", usage.EFSStorageGB, p.EFS.StandardGBMonth)
+		case "aws_wafv2_web_acl":
+			items = p.webACL(r, usage)
+		default:
+			if !unmetered[r.Type] {
+				err = fmt.Errorf("no price for resource type %q", r.Type)
+			}
+		}
+		if err != nil {
+			return est, fmt.Errorf("%s: %w", r.Address, err)
+		}
+		est.Items = append(est.Items, items...)
+	}
+
+	sort.SliceStable(est.Items, func(i, j int) bool {
+		return est.Items[i].Address < est.Items[j].Address
+	})
+
+	return est, nil
+}
+
+func collectResources(module *tfjson.StateModule) []*tfjson.StateResource {
+	resources := append([]*tfjson.StateResource{}, module.Resources...)
+	for _, child := range module.ChildModules {
+		resources = append(resources, collectResources(child)...)
+	}
+	return resources
+}
+
+func (p *PriceTable) rdsInstance(r *tfjson.StateResource) ([]LineItem, error) {
+	v := r.AttributeValues
+	engine := stringValue(v["engine"])
+	class := stringValue(v["instance_class"])
+
+	prices, ok := p.RDS.InstanceHourly[engine]
+	if !ok {
+		return nil, fmt.Errorf("no RDS prices for engine %q", engine)
+	}
+	hourly, ok := prices[class]
+	if !ok {
+		return nil, fmt.Errorf("no RDS price for %s instance class %q", engine, class)
+	}
+
+	multiplier := 1.0
+	deployment := "single-AZ"
+	if boolValue(v["multi_az"]) {
+		multiplier = p.RDS.MultiAZMultiplier
+		deployment = "multi-AZ"
+	}
+
+	items := []LineItem{
+		p.hourly(r.Address, fmt.Sprintf("%s %s instance", deployment, class), multiplier, "instance", hourly),
+	}
+
+	storageType := stringValue(v["storage_type"])
+	if storageType == "" {
+		storageType = "gp2"
+	}
+	storagePrice, ok := p.RDS.StorageGBMonth[storageType]
+	if !ok {
+		return nil, fmt.Errorf("no RDS price for storage type %q", storageType)
+	}
+	size := numberValue(v["allocated_storage"])
+	items = append(items, monthly(r.Address, storageType+" storage", size*multiplier, "GB", storagePrice))
+
+	iops := numberValue(v["iops"])
+	switch storageType {
+	case "gp3":
+		if extra := iops - p.RDS.GP3BaselineIOPS; extra > 0 {
+			items = append(items, monthly(r.Address, "gp3 provisioned IOPS", extra*multiplier, "IOPS", p.RDS.GP3IOPSMonth))
+		}
+		if extra := numberValue(v["storage_throughput"]) - p.RDS.GP3BaselineThroughputMBps; extra > 0 {
+			items = append(items, monthly(r.Address, "gp3 provisioned throughput", extra*multiplier, "MBps", p.RDS.GP3ThroughputMBpsMonth))
+		}
+	case "io1":
+		items = append(items, monthly(r.Address, "io1 provisioned IOPS", iops*multiplier, "IOPS", p.RDS.IO1IOPSMonth))
+	}
+
+	return items, nil
+}
+
+func (p *PriceTable) ec2Instance(r *tfjson.StateResource) ([]LineItem, error) {
+	v := r.AttributeValues
+	instanceType := stringValue(v["instance_type"])
+
+	hourly, ok := p.EC2.InstanceHourly[instanceType]
+	if !ok {
+		return nil, fmt.Errorf("no EC2 price for instance type %q", instanceType)
+	}
+	items := []LineItem{p.hourly(r.Address, instanceType+" instance", 1, "instance", hourly)}
+
+	for _, device := range objectList(v["root_block_device"]) {
+		volume, err := p.ebsVolume(r.Address, "root volume", map[string]interface{}{
+			"type":       device["volume_type"],
+			"size":       device["volume_size"],
+			"iops":       device["iops"],
+			"throughput": device["throughput"],
+		})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, volume...)
+	}
+
+	return items, nil
+}
+
+// ebsVolume prices an EBS volume from aws_ebs_volume style attributes.
+func (p *PriceTable) ebsVolume(address, label string, v map[string]interface{}) ([]LineItem, error) {
+	volumeType := stringValue(v["type"])
+	if volumeType == "" {
+		volumeType = "gp3"
+	}
+	price, ok := p.EBS.VolumeGBMonth[volumeType]
+	if !ok {
+		return nil, fmt.Errorf("no EBS price for volume type %q", volumeType)
+	}
+
+	items := []LineItem{
+		monthly(address, fmt.Sprintf("%s %s", volumeType, label), numberValue(v["size"]), "GB", price),
+	}
+
+	iops := numberValue(v["iops"])
+	switch volumeType {
+	case "gp3":
+		if extra := iops - p.EBS.GP3BaselineIOPS; extra > 0 {
+			items = append(items, monthly(address, label+" gp3 IOPS", extra, "IOPS", p.EBS.GP3IOPSMonth))
+		}
+		if extra := numberValue(v["throughput"]) - p.EBS.GP3BaselineThroughputMBps; extra > 0 {
+			items = append(items, monthly(address, label+" gp3 throughput", extra, "MBps", p.EBS.GP3ThroughputMBpsMonth))
+		}
+	case "io1", "io2":
+		items = append(items, monthly(address, label+" provisioned IOPS", iops, "IOPS", p.EBS.ProvisionedIOPSMonth))
+	}
+
+	return items, nil
+}
+
+func (p *PriceTable) loadBalancer(r *tfjson.StateResource, usage Usage) []LineItem {
+	lbType := stringValue(r.AttributeValues["load_balancer_type"])
+	if lbType != "" && lbType != "application" {
+		return nil
+	}
+
+	lcus := usage.ALBCapacityUnits
+	if lcus == 0 {
+		lcus = 1
+	}
+
+	return []LineItem{
+		p.hourly(r.Address, "application load balancer", 1, "ALB", p.ALB.Hourly),
+		p.hourly(r.Address, "load balancer capacity units", lcus, "LCU", p.ALB.LCUHourly),
+	}
+}
+
+func (p *PriceTable) natGateway(r *tfjson.StateResource, usage Usage) []LineItem {
+	items := []LineItem{p.hourly(r.Address, "NAT gateway", 1, "gateway", p.NATGateway.Hourly)}
+	if usage.NATProcessedGB > 0 {
+		items = append(items, monthly(r.Address, "NAT data processed", usage.NATProcessedGB, "GB", p.NATGateway.DataProcessedGB))
+	}
+	return items
+}
+
+// vpcEndpoint prices the network interfaces of an interface endpoint; gateway
+// endpoints have no hourly charge. The subnet IDs are unknown at plan time, so
+// an endpoint without them is assumed to use every private subnet of the
+// module.
+func (p *PriceTable) vpcEndpoint(r *tfjson.StateResource, privateSubnets int, usage Usage) []LineItem {
+	v := r.AttributeValues
+	if stringValue(v["vpc_endpoint_type"]) != "Interface" {
+		return nil
+	}
+
+	enis := float64(len(listValue(v["subnet_ids"])))
+	if enis == 0 {
+		enis = float64(privateSubnets)
+	}
+
+	items := []LineItem{p.hourly(r.Address, "interface endpoint ENIs", enis, "ENI", p.VPCEndpoint.InterfaceENIHourly)}
+	if usage.EndpointProcessedGB > 0 {
+		items = append(items, monthly(r.Address, "endpoint data processed", usage.EndpointProcessedGB, "GB", p.VPCEndpoint.DataProcessedGB))
+	}
+	return items
+}
+
+// webACL prices a WAF web ACL and its rules. Each managed rule group counts as
+// one rule.
+func (p *PriceTable) webACL(r *tfjson.StateResource, usage Usage) []LineItem {
+	rules := float64(len(listValue(r.AttributeValues["rule"])))
+
+	items := []LineItem{
+		monthly(r.Address, "WAF web ACL", 1, "web ACL", p.WAF.WebACLMonth),
+		monthly(r.Address, "WAF rules", rules, "rule", p.WAF.RuleMonth),
+	}
+	if usage.WAFRequestsMillion > 0 {
+		items = append(items, LineItem{
+			Address:   r.Address,
+			Component: "WAF requests",
+			Quantity:  usage.WAFRequestsMillion,
+			Unit:      "million requests",
+			UnitPrice: p.WAF.RequestsMillion,
+			Monthly:   usage.WAFRequestsMillion * p.WAF.RequestsMillion,
+		})
+	}
+	return items
+}
+
+// logGroup prices the data ingested into and stored by a log group.
+func (p *PriceTable) logGroup(r *tfjson.StateResource, usage Usage) []LineItem {
+	var items []LineItem
+	if usage.LogsIngestedGB > 0 {
+		items = append(items, LineItem{
+			Address:   r.Address,
+			Component: "log data ingested",
+			Quantity:  usage.LogsIngestedGB,
+			Unit:      "GB",
+			UnitPrice: p.CloudWatch.LogsIngestGB,
+			Monthly:   usage.LogsIngestedGB * p.CloudWatch.LogsIngestGB,
+		})
+	}
+	return append(items, storage(r.Address, "log data stored", usage.LogsStoredGB, p.CloudWatch.LogsStoredGBMonth)...)
+}
+
+// fargateService prices the desired task count of a Fargate service. The
+// task definition ARN is unknown at plan time, so the service is matched to
+// the module's only task definition.
+func (p *PriceTable) fargateService(r *tfjson.StateResource, taskDefinitions []*tfjson.StateResource) ([]LineItem, error) {
+	v := r.AttributeValues
+	if launchType := stringValue(v["launch_type"]); launchType != "" && launchType != "FARGATE" {
+		return nil, nil
+	}
+	if len(taskDefinitions) != 1 {
+		return nil, fmt.Errorf("cannot match service to one of %d task definitions", len(taskDefinitions))
+	}
+
+	td := taskDefinitions[0].AttributeValues
+	tasks := numberValue(v["desired_count"])
+	vcpu := numberValue(td["cpu"]) / 1024
+	memoryGB := numberValue(td["memory"]) / 1024
+
+	return []LineItem{
+		p.hourly(r.Address, "Fargate vCPU", tasks*vcpu, "vCPU", p.Fargate.VCPUHourly),
+		p.hourly(r.Address, "Fargate memory", tasks*memoryGB, "GB", p.Fargate.GBHourly),
+	}, nil
+}
+
+// hourly returns a line item for quantity units billed per hour.
+func (p *PriceTable) hourly(address, component string, quantity float64, unit string, price float64) LineItem {
+	return LineItem{
+		Address:   address,
+		Component: component,
+		Quantity:  quantity,
+		Unit:      unit + "-hours",
+		UnitPrice: price,
+		Monthly:   quantity * price * p.HoursPerMonth,
+	}
+}
+
+// monthly returns a line item for quantity units billed per month.
+func monthly(address, component string, quantity float64, unit string, price float64) LineItem {
+	return LineItem{
+		Address:   address,
+		Component: component,
+		Quantity:  quantity,
+		Unit:      unit + "-months",
+		UnitPrice: price,
+		Monthly:   quantity * price,
+	}
+}
+
+// storage returns a line item for gb of data stored per month, or none if no
+// storage is assumed.
+func storage(address, component string, gb, price float64) []LineItem {
+	if gb <= 0 {
+		return nil
+	}
+	return []LineItem{monthly(address, component, gb, "GB", price)}
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func boolValue(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// numberValue converts plan numbers, which may be encoded as JSON numbers or
+// strings (e.g. task definition cpu), to float64. Unknown values yield 0.
+func numberValue(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int:
+		return float64(n)
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	default:
+		return 0
+	}
+}
+
+func listValue(v interface{}) []interface{} {
+	list, _ := v.([]interface{})
+	return list
+}
+
+func objectList(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	var out []map[string]interface{}
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,220 @@
+package cost
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT records assertion failures without failing the running test
+type recordingT struct {
+	failed bool
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
+
+func loadFixture(t *testing.T, name string) Estimate {
+	t.Helper()
+
+	prices, err := LoadPriceTable("us-east-1")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	require.NoError(t, err)
+
+	plan, err := ParsePlanJSON(data)
+	require.NoError(t, err)
+
+	est, err := prices.EstimatePlan(name, "test", plan, Usage{})
+	require.NoError(t, err)
+	return est
+}
+
+// TestLoadPriceTable verifies that the checked-in price table covers the
+// classes and types used by the environments
+func TestLoadPriceTable(t *testing.T) {
+	t.Parallel()
+
+	prices, err := LoadPriceTable("us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "USD", prices.Currency)
+	assert.Equal(t, 730.0, prices.HoursPerMonth)
+
+	for _, class := range []string{"db.t3.micro", "db.t3.medium"} {
+		assert.Contains(t, prices.RDS.InstanceHourly["postgres"], class)
+	}
+	for _, instanceType := range []string{"t3.medium", "t3.large"} {
+		assert.Contains(t, prices.EC2.InstanceHourly, instanceType)
+	}
+
+	_, err = LoadPriceTable("eu-west-1")
+	assert.Error(t, err)
+}
+
+// TestEstimatePlanFixtures verifies the monthly estimate of recorded plans
+func TestEstimatePlanFixtures(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		fixture string
+		monthly float64
+	}{
+		// 0.018 * 730 + 20 GB * 0.115
+		{fixture: "staging-rds", monthly: 15.44},
+		// 0.072 * 2 * 730 + 50 GB * 2 * 0.115
+		{fixture: "production-rds", monthly: 116.62},
+		// NAT gateway 0.045 * 730 + EIP 0.005 * 730
+		{fixture: "staging-vpc", monthly: 36.50},
+		// ALB (0.0225 + 1 LCU * 0.008) * 730 + 2 tasks * (0.5 vCPU * 0.04048 + 1 GB * 0.004445) * 730
+		// + web ACL 5 + 5 rules * 1 + alarm 0.1; EFS storage is usage
+		{fixture: "production-ecs", monthly: 68.4051},
+		// 2 interface endpoints * 2 private subnets * 0.01 * 730; the gateway
+		// endpoint is free and S3 storage is usage
+		{fixture: "production-vpc-endpoints", monthly: 29.20},
+		// t3.large 0.0832 * 730 + root 50 GB * 0.08 + data 200 GB * 0.08
+		// + 1000 IOPS * 0.005 + 125 MBps * 0.04 + EIP 0.005 * 730
+		{fixture: "production-ec2-splunk", monthly: 94.386},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.fixture, func(t *testing.T) {
+			t.Parallel()
+
+			est := loadFixture(t, tc.fixture)
+			assert.InDelta(t, tc.monthly, est.MonthlyTotal(), 0.001)
+		})
+	}
+}
+
+// TestEstimatePlanLineItems verifies the individual components of an estimate
+func TestEstimatePlanLineItems(t *testing.T) {
+	t.Parallel()
+
+	est := loadFixture(t, "production-ec2-splunk")
+
+	components := map[string]float64{}
+	for _, item := range est.Items {
+		components[item.Component] += item.Monthly
+	}
+
+	assert.InDelta(t, 60.736, components["t3.large instance"], 0.001)
+	assert.InDelta(t, 4.0, components["gp3 root volume"], 0.001)
+	assert.InDelta(t, 16.0, components["gp3 volume"], 0.001)
+	assert.InDelta(t, 5.0, components["volume gp3 IOPS"], 0.001)
+	assert.InDelta(t, 5.0, components["volume gp3 throughput"], 0.001)
+	assert.InDelta(t, 3.65, components["public IPv4 address"], 0.001)
+}
+
+// TestEstimatePlanUsage verifies that usage assumptions are priced
+func TestEstimatePlanUsage(t *testing.T) {
+	t.Parallel()
+
+	prices, err := LoadPriceTable("us-east-1")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "staging-vpc.json"))
+	require.NoError(t, err)
+	plan, err := ParsePlanJSON(data)
+	require.NoError(t, err)
+
+	est, err := prices.EstimatePlan("vpc", "staging", plan, Usage{NATProcessedGB: 100})
+	require.NoError(t, err)
+	assert.InDelta(t, 36.50+4.50, est.MonthlyTotal(), 0.001)
+
+	data, err = os.ReadFile(filepath.Join("testdata", "staging-ecs.json"))
+	require.NoError(t, err)
+	plan, err = ParsePlanJSON(data)
+	require.NoError(t, err)
+
+	// 2 GB ingested * 0.50 + 10 GB stored * 0.03 per log group
+	est, err = prices.EstimatePlan("ecs", "staging", plan, Usage{LogsIngestedGB: 2, LogsStoredGB: 10})
+	require.NoError(t, err)
+	assert.InDelta(t, 1.00+0.30, est.MonthlyTotal(), 0.001)
+
+	data, err = os.ReadFile(filepath.Join("testdata", "production-vpc-endpoints.json"))
+	require.NoError(t, err)
+	plan, err = ParsePlanJSON(data)
+	require.NoError(t, err)
+
+	// 100 GB of flow logs * 0.023
+	est, err = prices.EstimatePlan("vpc", "production", plan, Usage{S3StorageGB: 100})
+	require.NoError(t, err)
+	assert.InDelta(t, 29.20+2.30, est.MonthlyTotal(), 0.001)
+
+	data, err = os.ReadFile(filepath.Join("testdata", "production-ecs.json"))
+	require.NoError(t, err)
+	plan, err = ParsePlanJSON(data)
+	require.NoError(t, err)
+
+	// 10 GB EFS * 0.30 + 2 million WAF requests * 0.60
+	est, err = prices.EstimatePlan("ecs", "production", plan, Usage{EFSStorageGB: 10, WAFRequestsMillion: 2})
+	require.NoError(t, err)
+	assert.InDelta(t, 68.4051+3.00+1.20, est.MonthlyTotal(), 0.001)
+}
+
+// TestEstimatePlanUnknownClass verifies that unpriced classes fail loudly
+func TestEstimatePlanUnknownClass(t *testing.T) {
+	t.Parallel()
+
+	prices, err := LoadPriceTable("us-east-1")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "staging-rds.json"))
+	require.NoError(t, err)
+	data = bytes.Replace(data, []byte("db.t3.micro"), []byte("db.x2g.16xlarge"), 1)
+
+	plan, err := ParsePlanJSON(data)
+	require.NoError(t, err)
+
+	_, err = prices.EstimatePlan("rds", "staging", plan, Usage{})
+	assert.ErrorContains(t, err, "db.x2g.16xlarge")
+}
+
+// TestEstimatePlanUnpricedType verifies that resource types that are neither
+// priced nor unmetered fail loudly
+func TestEstimatePlanUnpricedType(t *testing.T) {
+	t.Parallel()
+
+	prices, err := LoadPriceTable("us-east-1")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "staging-vpc.json"))
+	require.NoError(t, err)
+	data = bytes.Replace(data, []byte(`"type": "aws_vpc"`), []byte(`"type": "aws_route53_zone"`), 1)
+
+	plan, err := ParsePlanJSON(data)
+	require.NoError(t, err)
+
+	_, err = prices.EstimatePlan("vpc", "staging", plan, Usage{})
+	assert.ErrorContains(t, err, `no price for resource type "aws_route53_zone"`)
+}
+
+// TestCheckBudget verifies budget assertions and the summary table
+func TestCheckBudget(t *testing.T) {
+	t.Parallel()
+
+	staging := loadFixture(t, "staging-rds")
+	staging.Environment = "staging"
+	production := loadFixture(t, "production-rds")
+	production.Environment = "production"
+
+	assert.NoError(t, staging.CheckBudget(20))
+	assert.ErrorContains(t, production.CheckBudget(100), "costs 116.62 USD/month, budget is 100.00")
+
+	assert.True(t, AssertUnderBudget(t, staging, 20))
+	recorder := &recordingT{}
+	assert.False(t, AssertUnderBudget(recorder, production, 100))
+	assert.True(t, recorder.failed)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteTable(&buf, []Estimate{staging, production}))
+	assert.Contains(t, buf.String(), "116.62")
+	assert.Contains(t, buf.String(), "(total)")
+}
@@ -0,0 +1,47 @@
+package cost
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// Totals returns the monthly total per environment.
+func Totals(estimates []Estimate) map[string]float64 {
+	totals := map[string]float64{}
+	for _, e := range estimates {
+		totals[e.Environment] += e.MonthlyTotal()
+	}
+	return totals
+}
+
+// WriteTable writes a per module and environment summary followed by the
+// environment totals.
+func WriteTable(w io.Writer, estimates []Estimate) error {
+	sorted := append([]Estimate{}, estimates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Environment != sorted[j].Environment {
+			return sorted[i].Environment < sorted[j].Environment
+		}
+		return sorted[i].Module < sorted[j].Module
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "ENVIRONMENT\tMODULE\tMONTHLY\t")
+	for _, e := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t\n", e.Environment, e.Module, e.MonthlyTotal())
+	}
+
+	totals := Totals(estimates)
+	envs := make([]string, 0, len(totals))
+	for env := range totals {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		fmt.Fprintf(tw, "%s\t(total)\t%.2f\t\n", env, totals[env])
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/cost"
+)
+
+// environmentModules lists the modules deployed to every environment, in
+// dependency order
+var environmentModules = []string{"vpc", "rds", "secrets-manager", "ec2-splunk", "ecs"}
+
+// monthlyBudgets are the maximum monthly on-demand estimates per environment.
+// Raise them deliberately when an environment is meant to grow. Production
+// runs about 430 with a NAT gateway per AZ, five interface endpoints in two
+// AZs and the WAF.
+var monthlyBudgets = map[string]float64{
+	"staging":    150,
+	"production": 450,
+}
+
+// TestCostEnvironmentBudgets estimates each environment from module plans and
+// fails if it exceeds its monthly budget
+func TestCostEnvironmentBudgets(t *testing.T) {
+	t.Parallel()
+
+	prices, err := cost.LoadPriceTable(testRegion)
+	require.NoError(t, err)
+
+	totals := map[string]float64{}
+	for _, environment := range []string{"staging", "production"} {
+		var estimates []cost.Estimate
+
+		for _, module := range environmentModules {
+			plan := planModule(t, module, environment, environmentInputs(t, environment, module))
+
+			est, err := prices.EstimatePlan(module, environment, &plan.RawPlan, cost.Usage{})
+			require.NoError(t, err)
+			estimates = append(estimates, est)
+		}
+
+		require.NoError(t, cost.WriteTable(os.Stdout, estimates))
+
+		total := cost.Estimate{Module: "all", Environment: environment, Currency: prices.Currency}
+		for _, est := range estimates {
+			total.Items = append(total.Items, est.Items...)
+		}
+		cost.AssertUnderBudget(t, total, monthlyBudgets[environment])
+		totals[environment] = total.MonthlyTotal()
+	}
+
+	assert.Less(t, totals["staging"], totals["production"], "staging should cost less than production")
+}
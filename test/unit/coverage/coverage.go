@@ -0,0 +1,293 @@
+// Package coverage measures which module variables and conditional resources
+// the plan-based module tests exercise.
+//
+// Tests record the variables they plan a module with and the resource
+// instances in the resulting plan (see WriteRecord). Analyze compares the
+// records with the module configuration and reports:
+//
+//   - variables that no test set to a value other than their default
+//   - count and for_each branches that no test took, i.e. resources that were
+//     never planned with instances or never planned without any
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// EnvDir is the environment variable naming the directory tests write their
+// records to. Recording is disabled when it is unset.
+const EnvDir = "MODULE_COVERAGE_DIR"
+
+// Record is what a single test planned for a module.
+type Record struct {
+	Test      string                 `json:"test"`
+	Module    string                 `json:"module"`
+	Vars      map[string]interface{} `json:"vars"`
+	Instances []string               `json:"instances"`
+}
+
+// Instances returns the sorted addresses of every resource instance in the
+// planned values of plan.
+func Instances(plan *tfjson.Plan) []string {
+	if plan == nil || plan.PlannedValues == nil || plan.PlannedValues.RootModule == nil {
+		return nil
+	}
+
+	var addresses []string
+	var walk func(m *tfjson.StateModule)
+	walk = func(m *tfjson.StateModule) {
+		for _, r := range m.Resources {
+			addresses = append(addresses, r.Address)
+		}
+		for _, child := range m.ChildModules {
+			walk(child)
+		}
+	}
+	walk(plan.PlannedValues.RootModule)
+
+	sort.Strings(addresses)
+	return addresses
+}
+
+// WriteRecord writes rec to a new file in dir, creating dir if needed.
+// Concurrent tests never overwrite each other's records.
+func WriteRecord(dir string, rec Record) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, rec.Module+"-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadRecords reads every record written to dir.
+func ReadRecords(dir string) ([]Record, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	records := make([]Record, 0, len(files))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Branch is one side of a count or for_each meta-argument.
+type Branch struct {
+	Resource   string `json:"resource"`
+	Argument   string `json:"argument"`
+	Expression string `json:"expression"`
+
+	// Instances is true for the branch where the resource has at least one
+	// instance and false for the branch where it has none.
+	Instances bool `json:"instances"`
+}
+
+func (b Branch) String() string {
+	side := "without instances"
+	if b.Instances {
+		side = "with instances"
+	}
+	return fmt.Sprintf("%s %s (%s = %s)", b.Resource, side, b.Argument, b.Expression)
+}
+
+// ModuleCoverage is the coverage of a single module.
+type ModuleCoverage struct {
+	Module  string `json:"module"`
+	Records int    `json:"records"`
+
+	Variables          int      `json:"variables"`
+	CoveredVariables   int      `json:"covered_variables"`
+	UncoveredVariables []string `json:"uncovered_variables"`
+
+	Branches          int      `json:"branches"`
+	CoveredBranches   int      `json:"covered_branches"`
+	UncoveredBranches []Branch `json:"uncovered_branches"`
+}
+
+// Percent returns the share of covered variables and branches.
+func (m ModuleCoverage) Percent() float64 {
+	return percent(m.CoveredVariables+m.CoveredBranches, m.Variables+m.Branches)
+}
+
+// Report is the coverage of every analyzed module.
+type Report struct {
+	Modules []ModuleCoverage `json:"modules"`
+}
+
+// Percent returns the share of covered variables and branches over all
+// modules.
+func (r Report) Percent() float64 {
+	covered, total := 0, 0
+	for _, m := range r.Modules {
+		covered += m.CoveredVariables + m.CoveredBranches
+		total += m.Variables + m.Branches
+	}
+	return percent(covered, total)
+}
+
+// BelowThreshold returns the modules whose coverage is below threshold percent.
+func (r Report) BelowThreshold(threshold float64) []ModuleCoverage {
+	var below []ModuleCoverage
+	for _, m := range r.Modules {
+		if m.Percent() < threshold {
+			below = append(below, m)
+		}
+	}
+	return below
+}
+
+// Analyze computes the coverage of each named module under modulesDir from
+// records. Records for other modules are ignored.
+func Analyze(modulesDir string, modules []string, records []Record) (Report, error) {
+	var report Report
+	for _, name := range modules {
+		mod, err := tfmodule.Load(filepath.Join(modulesDir, name))
+		if err != nil {
+			return Report{}, err
+		}
+
+		var own []Record
+		for _, rec := range records {
+			if rec.Module == name {
+				own = append(own, rec)
+			}
+		}
+
+		report.Modules = append(report.Modules, analyzeModule(name, mod, own))
+	}
+	return report, nil
+}
+
+func analyzeModule(name string, mod *tfmodule.Module, records []Record) ModuleCoverage {
+	cov := ModuleCoverage{Module: name, Records: len(records), UncoveredVariables: []string{}, UncoveredBranches: []Branch{}}
+
+	for _, v := range mod.Variables {
+		cov.Variables++
+		if variableCovered(v, records) {
+			cov.CoveredVariables++
+		} else {
+			cov.UncoveredVariables = append(cov.UncoveredVariables, v.Name)
+		}
+	}
+
+	for _, r := range mod.Resources {
+		argument, expr := "count", r.Count
+		if expr == nil {
+			argument, expr = "for_each", r.ForEach
+		}
+		if expr == nil {
+			continue
+		}
+
+		with, without := instanceBranches(r.Address(), records)
+		for _, taken := range []struct {
+			instances bool
+			covered   bool
+		}{{true, with}, {false, without}} {
+			cov.Branches++
+			if taken.covered {
+				cov.CoveredBranches++
+				continue
+			}
+			cov.UncoveredBranches = append(cov.UncoveredBranches, Branch{
+				Resource:   r.Address(),
+				Argument:   argument,
+				Expression: mod.Source(expr.Range()),
+				Instances:  taken.instances,
+			})
+		}
+	}
+
+	sort.Strings(cov.UncoveredVariables)
+	return cov
+}
+
+// variableCovered reports whether any record sets v to a non-default value.
+// Required variables are covered by any record that sets them.
+func variableCovered(v tfmodule.Variable, records []Record) bool {
+	for _, rec := range records {
+		value, ok := rec.Vars[v.Name]
+		if !ok {
+			continue
+		}
+		if !v.HasDefault || !reflect.DeepEqual(normalize(value), v.Default) {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceBranches reports whether any record planned the resource at address
+// with at least one instance, and whether any planned it without instances.
+func instanceBranches(address string, records []Record) (with, without bool) {
+	for _, rec := range records {
+		found := false
+		for _, instance := range rec.Instances {
+			if instance == address || strings.HasPrefix(instance, address+"[") {
+				found = true
+				break
+			}
+		}
+		if found {
+			with = true
+		} else {
+			without = true
+		}
+	}
+	return with, without
+}
+
+// normalize converts value to the generic form produced by encoding/json so
+// it can be compared with a decoded default.
+func normalize(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return value
+	}
+	return out
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
@@ -0,0 +1,133 @@
+package coverage
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnalyzeFixture tests variable and branch coverage of a fixture module
+func TestAnalyzeFixture(t *testing.T) {
+	t.Parallel()
+
+	records := []Record{
+		{
+			Test:   "TestDefaults",
+			Module: "simple",
+			Vars: map[string]interface{}{
+				"name":       "gogs",
+				"password":   "secret",
+				"enable_nat": true,
+				"cidrs":      []string{"10.0.1.0/24", "10.0.2.0/24"},
+			},
+			Instances: []string{"aws_nat_gateway.main[0]", "aws_subnet.public[0]", "aws_subnet.public[1]"},
+		},
+		{
+			Test:      "TestNoNat",
+			Module:    "simple",
+			Vars:      map[string]interface{}{"name": "gogs", "enable_nat": false},
+			Instances: []string{"aws_subnet.public[0]", "aws_subnet.public[1]"},
+		},
+		{
+			Test:      "TestOtherModule",
+			Module:    "other",
+			Vars:      map[string]interface{}{"cidrs": []string{}},
+			Instances: []string{},
+		},
+	}
+
+	report, err := Analyze("testdata/modules", []string{"simple"}, records)
+	require.NoError(t, err)
+	require.Len(t, report.Modules, 1)
+
+	m := report.Modules[0]
+	assert.Equal(t, 2, m.Records)
+
+	// cidrs is only set to its default, key_name never
+	assert.Equal(t, 5, m.Variables)
+	assert.Equal(t, []string{"cidrs", "key_name"}, m.UncoveredVariables)
+
+	assert.Equal(t, 6, m.Branches)
+	assert.Equal(t, 4, m.CoveredBranches)
+	assert.Equal(t, []Branch{
+		{Resource: "aws_subnet.public", Argument: "count", Expression: "length(var.cidrs)", Instances: false},
+		{Resource: "aws_secretsmanager_secret.custom", Argument: "for_each", Expression: "{ for k, v in var.custom : k => v }", Instances: true},
+	}, m.UncoveredBranches)
+
+	assert.InDelta(t, 100*7.0/11.0, m.Percent(), 0.01)
+	assert.Len(t, report.BelowThreshold(70), 1)
+	assert.Empty(t, report.BelowThreshold(60))
+}
+
+// TestRecordRoundTrip tests that written records are read back
+func TestRecordRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, test := range []string{"TestA", "TestB"} {
+		require.NoError(t, WriteRecord(dir, Record{
+			Test:      test,
+			Module:    "vpc",
+			Vars:      map[string]interface{}{"enable_nat_gateway": false},
+			Instances: []string{"aws_vpc.main"},
+		}))
+	}
+
+	records, err := ReadRecords(dir)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.ElementsMatch(t, []string{"TestA", "TestB"}, []string{records[0].Test, records[1].Test})
+	assert.Equal(t, false, records[0].Vars["enable_nat_gateway"])
+}
+
+// TestInstances tests that instances are collected from the planned values
+func TestInstances(t *testing.T) {
+	t.Parallel()
+
+	var plan tfjson.Plan
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"format_version": "1.0",
+		"planned_values": {
+			"root_module": {
+				"resources": [
+					{"address": "aws_subnet.public[1]", "mode": "managed", "type": "aws_subnet", "name": "public", "index": 1},
+					{"address": "aws_subnet.public[0]", "mode": "managed", "type": "aws_subnet", "name": "public", "index": 0},
+					{"address": "aws_vpc.main", "mode": "managed", "type": "aws_vpc", "name": "main"}
+				]
+			}
+		}
+	}`), &plan))
+
+	assert.Equal(t, []string{"aws_subnet.public[0]", "aws_subnet.public[1]", "aws_vpc.main"}, Instances(&plan))
+	assert.Nil(t, Instances(nil))
+}
+
+// TestWriteText tests the text report
+func TestWriteText(t *testing.T) {
+	t.Parallel()
+
+	report := Report{Modules: []ModuleCoverage{{
+		Module:             "vpc",
+		Records:            2,
+		Variables:          4,
+		CoveredVariables:   3,
+		UncoveredVariables: []string{"tags"},
+		Branches:           2,
+		CoveredBranches:    1,
+		UncoveredBranches: []Branch{
+			{Resource: "aws_nat_gateway.main", Argument: "count", Expression: "var.enable_nat_gateway ? 1 : 0"},
+		},
+	}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteText(&buf, report))
+
+	out := buf.String()
+	assert.Contains(t, out, "vpc                     2         3/4        1/2    66.7%")
+	assert.Contains(t, out, "    - tags\n")
+	assert.Contains(t, out, "    - aws_nat_gateway.main without instances (count = var.enable_nat_gateway ? 1 : 0)\n")
+}
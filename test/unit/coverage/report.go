@@ -0,0 +1,54 @@
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteJSON writes the report as indented JSON.
+func WriteJSON(w io.Writer, report Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// WriteText writes a summary table followed by the uncovered variables and
+// branches of each module.
+func WriteText(w io.Writer, report Report) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%-16s %8s %11s %10s %8s\n", "MODULE", "RECORDS", "VARIABLES", "BRANCHES", "TOTAL")
+	for _, m := range report.Modules {
+		fmt.Fprintf(&b, "%-16s %8d %11s %10s %7.1f%%\n",
+			m.Module, m.Records,
+			fmt.Sprintf("%d/%d", m.CoveredVariables, m.Variables),
+			fmt.Sprintf("%d/%d", m.CoveredBranches, m.Branches),
+			m.Percent())
+	}
+	fmt.Fprintf(&b, "%-16s %8s %11s %10s %7.1f%%\n", "total", "", "", "", report.Percent())
+
+	for _, m := range report.Modules {
+		if len(m.UncoveredVariables) == 0 && len(m.UncoveredBranches) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s\n", m.Module)
+		if len(m.UncoveredVariables) > 0 {
+			b.WriteString("  variables never set to a non-default value:\n")
+			for _, name := range m.UncoveredVariables {
+				fmt.Fprintf(&b, "    - %s\n", name)
+			}
+		}
+		if len(m.UncoveredBranches) > 0 {
+			b.WriteString("  branches never taken:\n")
+			for _, branch := range m.UncoveredBranches {
+				fmt.Fprintf(&b, "    - %s\n", branch)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
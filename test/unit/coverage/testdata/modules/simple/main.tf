@@ -0,0 +1,52 @@
+variable "name" {
+  description = "Name prefix"
+  type        = string
+}
+
+variable "enable_nat" {
+  type    = bool
+  default = true
+}
+
+variable "cidrs" {
+  type    = list(string)
+  default = ["10.0.1.0/24", "10.0.2.0/24"]
+}
+
+variable "key_name" {
+  type    = string
+  default = null
+}
+
+variable "password" {
+  type      = string
+  sensitive = true
+}
+
+data "aws_caller_identity" "current" {}
+
+resource "aws_subnet" "public" {
+  count      = length(var.cidrs)
+  cidr_block = var.cidrs[count.index]
+}
+
+resource "aws_nat_gateway" "main" {
+  count = var.enable_nat ? 1 : 0
+}
+
+resource "aws_secretsmanager_secret" "custom" {
+  for_each = {
+    for k, v in var.custom :
+    k => v
+  }
+  name = "${var.name}-${each.key}"
+}
+
+output "password" {
+  value     = var.password
+  sensitive = true
+}
+
+output "subnet_ids" {
+  value = aws_subnet.public[*].id
+}
@@ -0,0 +1,341 @@
+// Package drift detects out-of-band changes in deployed Terragrunt stacks.
+//
+// Each environments/<region>/<env>/<module> directory is planned in
+// refresh-only mode with -detailed-exitcode, and the resulting JSON plan is
+// parsed for the resource_drift section. Parsing is kept separate from command
+// execution so it can be exercised offline against recorded plan fixtures.
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sensitiveValue replaces any attribute value that the plan marks as sensitive.
+const sensitiveValue = "(sensitive)"
+
+// unknownValue replaces any attribute value that is only known after apply.
+const unknownValue = "(known after apply)"
+
+// Target identifies a single Terragrunt stack under environments/.
+type Target struct {
+	Region      string `json:"region"`
+	Environment string `json:"environment"`
+	Module      string `json:"module"`
+	Dir         string `json:"dir"`
+}
+
+// Name returns the target as "<region>/<environment>/<module>".
+func (t Target) Name() string {
+	return t.Region + "/" + t.Environment + "/" + t.Module
+}
+
+// AttributeChange is a single drifted attribute of a resource.
+type AttributeChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// ResourceDrift describes a resource whose real state differs from the last
+// known state.
+type ResourceDrift struct {
+	Address    string            `json:"address"`
+	Type       string            `json:"type"`
+	Name       string            `json:"name"`
+	Actions    []string          `json:"actions"`
+	Attributes []AttributeChange `json:"attributes"`
+}
+
+// Discover returns every Terragrunt stack below root/environments, sorted by
+// region, environment and module. If environments is not empty only the named
+// environments are returned.
+func Discover(root string, environments ...string) ([]Target, error) {
+	matches, err := filepath.Glob(filepath.Join(root, "environments", "*", "*", "*", "terragrunt.hcl"))
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, env := range environments {
+		wanted[env] = true
+	}
+
+	var targets []Target
+	for _, match := range matches {
+		dir := filepath.Dir(match)
+		module := filepath.Base(dir)
+		env := filepath.Base(filepath.Dir(dir))
+		region := filepath.Base(filepath.Dir(filepath.Dir(dir)))
+
+		if len(wanted) > 0 && !wanted[env] {
+			continue
+		}
+
+		targets = append(targets, Target{
+			Region:      region,
+			Environment: env,
+			Module:      module,
+			Dir:         dir,
+		})
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Name() < targets[j].Name()
+	})
+
+	return targets, nil
+}
+
+// planJSON is the subset of the Terraform JSON plan format used for drift
+// detection.
+type planJSON struct {
+	FormatVersion   string             `json:"format_version"`
+	ResourceDrift   []resourceChangeJS `json:"resource_drift"`
+	ResourceChanges []resourceChangeJS `json:"resource_changes"`
+}
+
+type resourceChangeJS struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Change  struct {
+		Actions         []string    `json:"actions"`
+		Before          interface{} `json:"before"`
+		After           interface{} `json:"after"`
+		AfterUnknown    interface{} `json:"after_unknown"`
+		BeforeSensitive interface{} `json:"before_sensitive"`
+		AfterSensitive  interface{} `json:"after_sensitive"`
+	} `json:"change"`
+}
+
+// ParsePlanFile reads a JSON plan from disk and returns the drifted resources.
+func ParsePlanFile(path string) ([]ResourceDrift, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlan(data)
+}
+
+// ParsePlan returns the drifted managed resources recorded in a JSON plan, as
+// produced by `terraform show -json` for a refresh-only plan. Sensitive values
+// are masked in the returned attribute changes.
+func ParsePlan(data []byte) ([]ResourceDrift, error) {
+	plan, err := parsePlanJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return resourceDrift(plan.ResourceDrift), nil
+}
+
+// ParseChanges returns the managed resources a JSON plan would create, update
+// or replace, with the attributes that change. Values only known after apply
+// are shown as "(known after apply)". A second plan right after apply should
+// return nothing.
+func ParseChanges(data []byte) ([]ResourceDrift, error) {
+	plan, err := parsePlanJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []resourceChangeJS
+	for _, rc := range plan.ResourceChanges {
+		if isNoOp(rc.Change.Actions) {
+			continue
+		}
+		rc.Change.After = markUnknown(rc.Change.After, rc.Change.AfterUnknown)
+		changes = append(changes, rc)
+	}
+	return resourceDrift(changes), nil
+}
+
+func parsePlanJSON(data []byte) (planJSON, error) {
+	var plan planJSON
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return plan, fmt.Errorf("parsing plan JSON: %w", err)
+	}
+	if plan.FormatVersion == "" {
+		return plan, fmt.Errorf("parsing plan JSON: missing format_version")
+	}
+	return plan, nil
+}
+
+// resourceDrift converts changes of managed resources to ResourceDrift values
+// sorted by address.
+func resourceDrift(changes []resourceChangeJS) []ResourceDrift {
+	var drifted []ResourceDrift
+	for _, rc := range changes {
+		if rc.Mode == "data" {
+			continue
+		}
+
+		before := maskSensitive(rc.Change.Before, rc.Change.BeforeSensitive)
+		after := maskSensitive(rc.Change.After, rc.Change.AfterSensitive)
+
+		var attrs []AttributeChange
+		diffValues("", before, after, &attrs)
+		sort.Slice(attrs, func(i, j int) bool {
+			return attrs[i].Path < attrs[j].Path
+		})
+
+		drifted = append(drifted, ResourceDrift{
+			Address:    rc.Address,
+			Type:       rc.Type,
+			Name:       rc.Name,
+			Actions:    rc.Change.Actions,
+			Attributes: attrs,
+		})
+	}
+
+	sort.Slice(drifted, func(i, j int) bool {
+		return drifted[i].Address < drifted[j].Address
+	})
+
+	return drifted
+}
+
+func isNoOp(actions []string) bool {
+	for _, action := range actions {
+		if action != "no-op" && action != "read" {
+			return false
+		}
+	}
+	return true
+}
+
+// markUnknown returns a copy of value where every leaf marked true in the
+// matching after_unknown structure is replaced with unknownValue.
+func markUnknown(value, unknown interface{}) interface{} {
+	switch u := unknown.(type) {
+	case bool:
+		if u {
+			return unknownValue
+		}
+		return value
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		out := make(map[string]interface{}, len(v)+len(u))
+		for k, item := range v {
+			out[k] = item
+		}
+		for k, item := range u {
+			out[k] = markUnknown(v[k], item)
+		}
+		return out
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			if i < len(u) {
+				out[i] = markUnknown(item, u[i])
+			} else {
+				out[i] = item
+			}
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// maskSensitive returns a copy of value where every leaf marked true in the
+// matching sensitive structure is replaced with sensitiveValue.
+func maskSensitive(value, sensitive interface{}) interface{} {
+	switch s := sensitive.(type) {
+	case bool:
+		if s && value != nil {
+			return sensitiveValue
+		}
+		return value
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = maskSensitive(item, s[k])
+		}
+		return out
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			if i < len(s) {
+				out[i] = maskSensitive(item, s[i])
+			} else {
+				out[i] = item
+			}
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// diffValues walks before and after in parallel and appends one
+// AttributeChange per differing leaf. Objects are descended into by key and
+// lists by index; anything else is compared as a whole.
+func diffValues(path string, before, after interface{}, out *[]AttributeChange) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		keys := map[string]bool{}
+		for k := range beforeMap {
+			keys[k] = true
+		}
+		for k := range afterMap {
+			keys[k] = true
+		}
+		for k := range keys {
+			diffValues(joinPath(path, k), beforeMap[k], afterMap[k], out)
+		}
+		return
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList && len(beforeList) == len(afterList) {
+		for i := range beforeList {
+			diffValues(path+"["+strconv.Itoa(i)+"]", beforeList[i], afterList[i], out)
+		}
+		return
+	}
+
+	*out = append(*out, AttributeChange{
+		Path:   path,
+		Before: before,
+		After:  after,
+	})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	if strings.ContainsAny(key, ".[]") {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	return path + "." + key
+}
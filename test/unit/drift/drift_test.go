@@ -0,0 +1,231 @@
+package drift
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParsePlanDrifted verifies that drifted managed resources and their
+// attributes are extracted from a recorded refresh-only plan
+func TestParsePlanDrifted(t *testing.T) {
+	t.Parallel()
+
+	resources, err := ParsePlanFile(filepath.Join("testdata", "staging-vpc-drifted.json"))
+	require.NoError(t, err)
+
+	// Data sources are refreshed on every plan and never count as drift
+	require.Len(t, resources, 2)
+
+	assert.Equal(t, "aws_route_table.private", resources[0].Address)
+	assert.Equal(t, []string{"delete"}, resources[0].Actions)
+
+	sg := resources[1]
+	assert.Equal(t, "aws_security_group.alb", sg.Address)
+	assert.Equal(t, "aws_security_group", sg.Type)
+	assert.Equal(t, "alb", sg.Name)
+	assert.Equal(t, []AttributeChange{
+		{
+			Path:   "ingress[0].cidr_blocks",
+			Before: []interface{}{"0.0.0.0/0"},
+			After:  []interface{}{"0.0.0.0/0", "203.0.113.10/32"},
+		},
+		{
+			Path:   "tags.Owner",
+			Before: nil,
+			After:  "console-user",
+		},
+	}, sg.Attributes)
+}
+
+// TestParsePlanMasksSensitiveValues verifies that sensitive attributes never
+// leak into the drift report
+func TestParsePlanMasksSensitiveValues(t *testing.T) {
+	t.Parallel()
+
+	resources, err := ParsePlanFile(filepath.Join("testdata", "production-rds-sensitive.json"))
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+
+	// Both sides are masked, so the password change is invisible
+	assert.Equal(t, []AttributeChange{
+		{Path: "instance_class", Before: "db.t3.medium", After: "db.t3.large"},
+	}, resources[0].Attributes)
+}
+
+// TestParsePlanClean verifies that a plan without resource_drift reports nothing
+func TestParsePlanClean(t *testing.T) {
+	t.Parallel()
+
+	resources, err := ParsePlanFile(filepath.Join("testdata", "production-ecs-clean.json"))
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+}
+
+// TestParsePlanInvalid verifies that non-plan input is rejected
+func TestParsePlanInvalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{name: "NotJSON", data: "Error: No configuration files"},
+		{name: "MissingFormatVersion", data: `{"resource_drift": []}`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParsePlan([]byte(tc.data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestDiscoverEnvironments verifies that every stack in the repository is found
+func TestDiscoverEnvironments(t *testing.T) {
+	t.Parallel()
+
+	modules := []string{"ec2-splunk", "ecs", "rds", "secrets-manager", "vpc"}
+
+	targets, err := Discover("../../..")
+	require.NoError(t, err)
+	require.Len(t, targets, 2*len(modules))
+
+	staging, err := Discover("../../..", "staging")
+	require.NoError(t, err)
+	require.Len(t, staging, len(modules))
+
+	for i, target := range staging {
+		assert.Equal(t, "us-east-1", target.Region)
+		assert.Equal(t, "staging", target.Environment)
+		assert.Equal(t, modules[i], target.Module)
+		assert.FileExists(t, filepath.Join(target.Dir, "terragrunt.hcl"))
+	}
+}
+
+// TestReports verifies the JSON, JUnit and Markdown renderings of a report
+func TestReports(t *testing.T) {
+	t.Parallel()
+
+	drifted, err := ParsePlanFile(filepath.Join("testdata", "staging-vpc-drifted.json"))
+	require.NoError(t, err)
+
+	report := Report{
+		GeneratedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Results: []Result{
+			{
+				Target:    Target{Region: "us-east-1", Environment: "staging", Module: "vpc"},
+				Drifted:   true,
+				Resources: drifted,
+				Duration:  1500 * time.Millisecond,
+			},
+			{
+				Target: Target{Region: "us-east-1", Environment: "staging", Module: "ecs"},
+			},
+			{
+				Target: Target{Region: "us-east-1", Environment: "production", Module: "rds"},
+				Error:  "plan us-east-1/production/rds: exit status 1",
+			},
+		},
+	}
+
+	assert.Equal(t, 1, report.DriftedCount())
+	assert.Equal(t, 1, report.ErrorCount())
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteJSON(&buf, report))
+		assert.Contains(t, buf.String(), `"address": "aws_security_group.alb"`)
+		assert.Contains(t, buf.String(), `"path": "tags.Owner"`)
+	})
+
+	t.Run("JUnit", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteJUnit(&buf, report))
+
+		var suites junitTestSuites
+		require.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+		assert.Equal(t, 3, suites.Tests)
+		assert.Equal(t, 1, suites.Failures)
+		assert.Equal(t, 1, suites.Errors)
+		require.Len(t, suites.Suites, 2)
+
+		staging := suites.Suites[0]
+		assert.Equal(t, "us-east-1/staging", staging.Name)
+		require.Len(t, staging.Cases, 2)
+		require.NotNil(t, staging.Cases[0].Failure)
+		assert.Equal(t, "2 resource(s) drifted", staging.Cases[0].Failure.Message)
+		assert.Contains(t, staging.Cases[0].Failure.Body, "tags.Owner: null -> console-user")
+		assert.Equal(t, "1.500", staging.Cases[0].Time)
+		assert.Nil(t, staging.Cases[1].Failure)
+
+		production := suites.Suites[1]
+		require.Len(t, production.Cases, 1)
+		require.NotNil(t, production.Cases[0].Error)
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteMarkdown(&buf, report))
+
+		md := buf.String()
+		assert.Contains(t, md, "| us-east-1 | staging | vpc | ⚠️ drifted | 2 |")
+		assert.Contains(t, md, "| us-east-1 | staging | ecs | ✅ in sync | 0 |")
+		assert.Contains(t, md, "| us-east-1 | production | rds | ❌ error | 0 |")
+		assert.Contains(t, md, "### `aws_security_group.alb`")
+		assert.Contains(t, md, "| `tags.Owner` | `null` | `console-user` |")
+	})
+}
+
+// TestParseChangesSecondPlan verifies that pending changes, including values
+// only known after apply, are extracted from a recorded plan
+func TestParseChangesSecondPlan(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "staging-rds-second-plan.json"))
+	require.NoError(t, err)
+
+	changes, err := ParseChanges(data)
+	require.NoError(t, err)
+
+	// No-op resources and data source reads are not changes
+	require.Len(t, changes, 2)
+
+	assert.Equal(t, "aws_db_instance.main", changes[0].Address)
+	assert.Equal(t, []string{"update"}, changes[0].Actions)
+	assert.Equal(t, []AttributeChange{
+		{
+			Path:   "final_snapshot_identifier",
+			Before: "gogs-fork-staging-final-snapshot-2026-10-18-0912",
+			After:  "(known after apply)",
+		},
+	}, changes[0].Attributes)
+
+	assert.Equal(t, "aws_security_group.rds", changes[1].Address)
+	assert.Equal(t, []AttributeChange{
+		{Path: "tags.Owner", Before: nil, After: "platform"},
+	}, changes[1].Attributes)
+}
+
+// TestParseChangesIgnoresDrift verifies that a refresh-only plan has no
+// pending changes
+func TestParseChangesIgnoresDrift(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "staging-vpc-drifted.json"))
+	require.NoError(t, err)
+
+	changes, err := ParseChanges(data)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
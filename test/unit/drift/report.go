@@ -0,0 +1,183 @@
+package drift
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteJSON writes the report as indented JSON.
+func WriteJSON(w io.Writer, report Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML with one test suite per
+// environment and one test case per module. Drift is reported as a failure and
+// plan errors as errors, so CI systems can surface them separately.
+func WriteJUnit(w io.Writer, report Report) error {
+	suites := junitTestSuites{Name: "drift"}
+	index := map[string]int{}
+
+	for _, res := range report.Results {
+		suiteName := res.Region + "/" + res.Environment
+		i, ok := index[suiteName]
+		if !ok {
+			i = len(suites.Suites)
+			index[suiteName] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: suiteName})
+		}
+		suite := &suites.Suites[i]
+
+		tc := junitTestCase{
+			Name:      res.Module,
+			ClassName: "drift." + res.Environment,
+			Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+		}
+
+		switch {
+		case res.Error != "":
+			tc.Error = &junitMessage{Message: "drift check failed", Body: res.Error}
+			suite.Errors++
+			suites.Errors++
+		case res.Drifted:
+			tc.Failure = &junitMessage{
+				Message: fmt.Sprintf("%d resource(s) drifted", len(res.Resources)),
+				Body:    describeResources(res.Resources),
+			}
+			suite.Failures++
+			suites.Failures++
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		suites.Tests++
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteMarkdown writes a human-readable summary followed by a detail section
+// for every drifted target.
+func WriteMarkdown(w io.Writer, report Report) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Drift Report\n\n")
+	fmt.Fprintf(&b, "Generated at %s.\n\n", report.GeneratedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(&b, "| Region | Environment | Module | Status | Drifted Resources |\n")
+	fmt.Fprintf(&b, "|--------|-------------|--------|--------|-------------------|\n")
+
+	for _, res := range report.Results {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %d |\n",
+			res.Region, res.Environment, res.Module, status(res), len(res.Resources))
+	}
+
+	for _, res := range report.Results {
+		if res.Error == "" && !res.Drifted {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n## %s\n\n", res.Name())
+		if res.Error != "" {
+			fmt.Fprintf(&b, "```text\n%s\n```\n", strings.TrimSpace(res.Error))
+			continue
+		}
+
+		for _, rd := range res.Resources {
+			fmt.Fprintf(&b, "### `%s`\n\n", rd.Address)
+			fmt.Fprintf(&b, "| Attribute | Recorded | Actual |\n")
+			fmt.Fprintf(&b, "|-----------|----------|--------|\n")
+			for _, attr := range rd.Attributes {
+				fmt.Fprintf(&b, "| `%s` | %s | %s |\n",
+					attr.Path, markdownValue(attr.Before), markdownValue(attr.After))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func status(res Result) string {
+	switch {
+	case res.Error != "":
+		return "❌ error"
+	case res.Drifted:
+		return "⚠️ drifted"
+	default:
+		return "✅ in sync"
+	}
+}
+
+// describeResources renders drifted resources as plain text for JUnit bodies.
+func describeResources(resources []ResourceDrift) string {
+	var b strings.Builder
+	for _, rd := range resources {
+		fmt.Fprintf(&b, "%s (%s)\n", rd.Address, strings.Join(rd.Actions, ", "))
+		for _, attr := range rd.Attributes {
+			fmt.Fprintf(&b, "  %s: %s -> %s\n", attr.Path, formatValue(attr.Before), formatValue(attr.After))
+		}
+	}
+	return b.String()
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func markdownValue(v interface{}) string {
+	return "`" + strings.ReplaceAll(formatValue(v), "|", "\\|") + "`"
+}
@@ -0,0 +1,147 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Exit codes returned by `plan -detailed-exitcode`.
+const (
+	exitCodeNoChanges = 0
+	exitCodeChanges   = 2
+)
+
+// Result is the drift status of a single target.
+type Result struct {
+	Target
+	Drifted   bool            `json:"drifted"`
+	Resources []ResourceDrift `json:"resources"`
+	Error     string          `json:"error,omitempty"`
+	Duration  time.Duration   `json:"duration_ns"`
+}
+
+// Report aggregates the results for every checked target.
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Results     []Result  `json:"results"`
+}
+
+// DriftedCount returns the number of targets with drift.
+func (r Report) DriftedCount() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Drifted {
+			n++
+		}
+	}
+	return n
+}
+
+// ErrorCount returns the number of targets that could not be checked.
+func (r Report) ErrorCount() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Runner executes refresh-only plans with Terragrunt.
+type Runner struct {
+	// Binary is the Terragrunt executable. Defaults to "terragrunt".
+	Binary string
+
+	// Log receives the command output. Defaults to io.Discard.
+	Log io.Writer
+}
+
+// Check runs a refresh-only plan for target and returns its drift result.
+func (r *Runner) Check(ctx context.Context, target Target) Result {
+	start := time.Now()
+	result := Result{Target: target}
+
+	resources, drifted, err := r.check(ctx, target)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Drifted = drifted
+	result.Resources = resources
+	result.Duration = time.Since(start)
+
+	return result
+}
+
+func (r *Runner) check(ctx context.Context, target Target) ([]ResourceDrift, bool, error) {
+	planFile, err := os.CreateTemp("", "drift-*.tfplan")
+	if err != nil {
+		return nil, false, err
+	}
+	planFile.Close()
+	defer os.Remove(planFile.Name())
+
+	planPath, err := filepath.Abs(planFile.Name())
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, code, err := r.run(ctx, target.Dir,
+		"plan", "-refresh-only", "-detailed-exitcode", "-input=false", "-lock=false", "-out="+planPath)
+	if err != nil && code != exitCodeChanges {
+		return nil, false, fmt.Errorf("plan %s: %w", target.Name(), err)
+	}
+	if code == exitCodeNoChanges {
+		return nil, false, nil
+	}
+
+	out, _, err := r.run(ctx, target.Dir, "show", "-json", planPath)
+	if err != nil {
+		return nil, true, fmt.Errorf("show %s: %w", target.Name(), err)
+	}
+
+	resources, err := ParsePlan(out)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", target.Name(), err)
+	}
+
+	return resources, len(resources) > 0, nil
+}
+
+// run executes the Terragrunt binary in dir and returns stdout and the exit
+// code. Stderr is copied to the runner log.
+func (r *Runner) run(ctx context.Context, dir string, args ...string) ([]byte, int, error) {
+	binary := r.Binary
+	if binary == "" {
+		binary = "terragrunt"
+	}
+	log := r.Log
+	if log == nil {
+		log = io.Discard
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, append(args, "--terragrunt-non-interactive")...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+	cmd.Stdout = &stdout
+	cmd.Stderr = log
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.Bytes(), exitErr.ExitCode(), err
+	}
+	if err != nil {
+		return nil, -1, err
+	}
+	return stdout.Bytes(), exitCodeNoChanges, nil
+}
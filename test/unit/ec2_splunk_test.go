@@ -1,10 +1,14 @@
 package test
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
 )
 
 // TestEc2SplunkModuleVariablesValidation validates that the EC2-Splunk module has required variables
@@ -26,12 +30,12 @@ func TestEc2SplunkModuleVariablesValidation(t *testing.T) {
 			"data_volume_size":      100,
 			"data_volume_type":      "gp3",
 			"kms_key_id":            nil,
-			"splunk_admin_password": "SplunkAdmin123!",
-			"splunk_hec_token":      "12345678-1234-1234-1234-123456789012",
+			"splunk_admin_password": testSecrets.SplunkPassword(),
+			"splunk_hec_token":      testSecrets.HECToken(),
 			"splunk_version":        "9.1.1",
 			"allowed_cidr":          []string{"10.0.0.0/8"},
 			"ssh_cidr":              []string{"10.0.0.0/8"},
-			"ssh_public_key":        "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ... test-key",
+			"ssh_public_key":        testPublicKey(t),
 			"associate_public_ip":   true,
 			"secrets_manager_arn":   "",
 			"tags": map[string]string{
@@ -102,12 +106,12 @@ func TestEc2SplunkModuleInstanceTypes(t *testing.T) {
 					"data_volume_size":      tc.dataVolumeSize,
 					"data_volume_type":      "gp3",
 					"kms_key_id":            nil,
-					"splunk_admin_password": "SplunkAdmin123!",
-					"splunk_hec_token":      "12345678-1234-1234-1234-123456789012",
+					"splunk_admin_password": testSecrets.SplunkPassword(),
+					"splunk_hec_token":      testSecrets.HECToken(),
 					"splunk_version":        "9.1.1",
 					"allowed_cidr":          []string{"10.0.0.0/8"},
 					"ssh_cidr":              []string{"10.0.0.0/8"},
-					"ssh_public_key":        "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQtest",
+					"ssh_public_key":        testPublicKey(t),
 					"associate_public_ip":   false,
 					"secrets_manager_arn":   "",
 					"tags":                  map[string]string{},
@@ -147,12 +151,12 @@ func TestEc2SplunkModuleVolumeTypes(t *testing.T) {
 					"data_volume_size":      100,
 					"data_volume_type":      volumeType,
 					"kms_key_id":            nil,
-					"splunk_admin_password": "SplunkAdmin123!",
-					"splunk_hec_token":      "12345678-1234-1234-1234-123456789012",
+					"splunk_admin_password": testSecrets.SplunkPassword(),
+					"splunk_hec_token":      testSecrets.HECToken(),
 					"splunk_version":        "9.1.1",
 					"allowed_cidr":          []string{"10.0.0.0/8"},
 					"ssh_cidr":              []string{"10.0.0.0/8"},
-					"ssh_public_key":        "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQtest",
+					"ssh_public_key":        testPublicKey(t),
 					"associate_public_ip":   false,
 					"secrets_manager_arn":   "",
 					"tags":                  map[string]string{},
@@ -216,12 +220,12 @@ func TestEc2SplunkModuleNetworkConfiguration(t *testing.T) {
 					"data_volume_size":      100,
 					"data_volume_type":      "gp3",
 					"kms_key_id":            nil,
-					"splunk_admin_password": "SplunkAdmin123!",
-					"splunk_hec_token":      "12345678-1234-1234-1234-123456789012",
+					"splunk_admin_password": testSecrets.SplunkPassword(),
+					"splunk_hec_token":      testSecrets.HECToken(),
 					"splunk_version":        "9.1.1",
 					"allowed_cidr":          tc.allowedCIDR,
 					"ssh_cidr":              tc.sshCIDR,
-					"ssh_public_key":        "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQtest",
+					"ssh_public_key":        testPublicKey(t),
 					"associate_public_ip":   tc.associatePublicIP,
 					"secrets_manager_arn":   "",
 					"tags":                  map[string]string{},
@@ -261,12 +265,12 @@ func TestEc2SplunkModuleSplunkVersions(t *testing.T) {
 					"data_volume_size":      100,
 					"data_volume_type":      "gp3",
 					"kms_key_id":            nil,
-					"splunk_admin_password": "SplunkAdmin123!",
-					"splunk_hec_token":      "12345678-1234-1234-1234-123456789012",
+					"splunk_admin_password": testSecrets.SplunkPassword(),
+					"splunk_hec_token":      testSecrets.HECToken(),
 					"splunk_version":        version,
 					"allowed_cidr":          []string{"10.0.0.0/8"},
 					"ssh_cidr":              []string{"10.0.0.0/8"},
-					"ssh_public_key":        "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQtest",
+					"ssh_public_key":        testPublicKey(t),
 					"associate_public_ip":   false,
 					"secrets_manager_arn":   "",
 					"tags":                  map[string]string{},
@@ -280,3 +284,30 @@ func TestEc2SplunkModuleSplunkVersions(t *testing.T) {
 		})
 	}
 }
+
+// TestEc2SplunkModuleHECClients tests that the HEC port admits the HEC client
+// security group, so that senders such as ECS can be deployed after Splunk
+func TestEc2SplunkModuleHECClients(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ec2-splunk"))
+	require.NoError(t, err)
+
+	_, ok := mod.Resource("aws_security_group.hec_clients")
+	require.True(t, ok, "aws_security_group.hec_clients not found")
+
+	splunk, ok := mod.Resource("aws_security_group.splunk")
+	require.True(t, ok)
+
+	var references []string
+	for _, arg := range splunk.Arguments() {
+		if arg.Path != "ingress.security_groups" {
+			continue
+		}
+		for _, traversal := range arg.Expr.Variables() {
+			references = append(references, mod.Source(traversal.SourceRange()))
+		}
+	}
+	assert.Contains(t, references, "aws_security_group.hec_clients.id")
+	assert.Contains(t, references, "var.ecs_security_group_ids")
+}
@@ -1,10 +1,17 @@
 package test
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
 )
 
 // TestEcsModuleVariablesValidation validates that the ECS module has required variables
@@ -237,3 +244,1643 @@ func TestEcsModuleDockerImageFormats(t *testing.T) {
 		})
 	}
 }
+
+// ecsTestCertificateARN is a well-formed ACM certificate ARN for plans
+const ecsTestCertificateARN = "arn:aws:acm:us-east-1:123456789012:certificate/0b5c2d1e-8f3a-4c6b-9d7e-1a2b3c4d5e6f"
+
+// ecsListenerInputs returns the staging ECS inputs with the listener
+// variables of a case
+func ecsListenerInputs(t *testing.T, vars map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	inputs := environmentInputs(t, "staging", "ecs")
+	for k, v := range vars {
+		inputs[k] = v
+	}
+	return inputs
+}
+
+// TestEcsModuleHTTPSConditions tests the certificate and TLS policy
+// validations without running terraform
+func TestEcsModuleHTTPSConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	for _, vars := range []map[string]interface{}{
+		{},
+		{"acm_certificate_arn": ecsTestCertificateARN},
+		{"acm_certificate_arn": ecsTestCertificateARN, "ssl_policy": "ELBSecurityPolicy-TLS13-1-3-2021-06", "redirect_http_to_https": false},
+	} {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, vars))
+		require.NoError(t, err)
+		assert.Empty(t, failures, "%v", vars)
+	}
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{
+			name:    "CertificateName",
+			vars:    map[string]interface{}{"acm_certificate_arn": "gogs.example.com"},
+			subject: "var.acm_certificate_arn",
+		},
+		{
+			name:    "IAMServerCertificate",
+			vars:    map[string]interface{}{"acm_certificate_arn": "arn:aws:iam::123456789012:server-certificate/gogs"},
+			subject: "var.acm_certificate_arn",
+		},
+		{
+			name:    "OpenSSLCipherPolicy",
+			vars:    map[string]interface{}{"ssl_policy": "TLSv1.2"},
+			subject: "var.ssl_policy",
+		},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, tc.vars))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// TestEcsModuleListeners tests the listener protocols, the HTTP redirect, the
+// TLS policy and the ALB ingress ports with and without a certificate
+func TestEcsModuleListeners(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		vars      map[string]interface{}
+		https     bool
+		redirect  bool
+		sslPolicy string
+	}{
+		{
+			name: "HTTPOnly",
+			vars: map[string]interface{}{},
+		},
+		{
+			name:      "RedirectToHTTPS",
+			vars:      map[string]interface{}{"acm_certificate_arn": ecsTestCertificateARN},
+			https:     true,
+			redirect:  true,
+			sslPolicy: "ELBSecurityPolicy-TLS13-1-2-2021-06",
+		},
+		{
+			name: "HTTPAndHTTPS",
+			vars: map[string]interface{}{
+				"acm_certificate_arn":    ecsTestCertificateARN,
+				"ssl_policy":             "ELBSecurityPolicy-TLS13-1-3-2021-06",
+				"redirect_http_to_https": false,
+			},
+			https:     true,
+			sslPolicy: "ELBSecurityPolicy-TLS13-1-3-2021-06",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, tc.vars))
+
+			http := plan.ResourcePlannedValuesMap["aws_lb_listener.http[0]"]
+			require.NotNil(t, http, "aws_lb_listener.http[0] is not planned")
+			assert.Equal(t, "HTTP", http.AttributeValues["protocol"])
+			assert.EqualValues(t, 80, http.AttributeValues["port"])
+
+			actions, ok := http.AttributeValues["default_action"].([]interface{})
+			require.True(t, ok && len(actions) == 1, "expected one default action")
+			action := actions[0].(map[string]interface{})
+			redirects, _ := action["redirect"].([]interface{})
+			if tc.redirect {
+				assert.Equal(t, "redirect", action["type"])
+				require.Len(t, redirects, 1)
+				redirect := redirects[0].(map[string]interface{})
+				assert.Equal(t, "HTTP_301", redirect["status_code"])
+				assert.Equal(t, "HTTPS", redirect["protocol"])
+				assert.Equal(t, "443", redirect["port"])
+				assert.Nil(t, action["target_group_arn"])
+			} else {
+				assert.Equal(t, "forward", action["type"])
+				assert.Empty(t, redirects)
+			}
+
+			https := plan.ResourcePlannedValuesMap["aws_lb_listener.https[0]"]
+			assert.Equal(t, tc.https, https != nil, "HTTPS listener")
+			if https != nil {
+				assert.Equal(t, "HTTPS", https.AttributeValues["protocol"])
+				assert.EqualValues(t, 443, https.AttributeValues["port"])
+				assert.Equal(t, tc.sslPolicy, https.AttributeValues["ssl_policy"])
+				assert.Equal(t, ecsTestCertificateARN, https.AttributeValues["certificate_arn"])
+			}
+
+			sg := plan.ResourcePlannedValuesMap["aws_security_group.alb"]
+			require.NotNil(t, sg, "aws_security_group.alb is not planned")
+			ingress, ok := sg.AttributeValues["ingress"].([]interface{})
+			require.True(t, ok, "expected ingress rules")
+			var ports []float64
+			for _, rule := range ingress {
+				ports = append(ports, rule.(map[string]interface{})["from_port"].(float64))
+			}
+			if tc.https {
+				assert.ElementsMatch(t, []float64{80, 443}, ports)
+			} else {
+				assert.Equal(t, []float64{80}, ports)
+			}
+		})
+	}
+}
+
+// ecsScalingPolicies has a scaling policy of every kind
+var ecsScalingPolicies = []map[string]interface{}{
+	{"name": "cpu", "type": "cpu", "target_value": 60},
+	{"name": "memory", "type": "memory", "target_value": 75, "scale_in_cooldown": 600},
+	{"name": "requests", "type": "requests", "target_value": 800, "disable_scale_in": true},
+	{
+		"name": "queue",
+		"type": "step",
+		"metric": map[string]interface{}{
+			"name":                "PendingWebhooks",
+			"namespace":           "Gogs",
+			"statistic":           "Maximum",
+			"dimensions":          map[string]string{"Environment": "staging"},
+			"comparison_operator": "GreaterThanOrEqualToThreshold",
+			"threshold":           100,
+		},
+		"steps": []map[string]interface{}{
+			{"lower_bound": 0, "upper_bound": 50, "scaling_adjustment": 1},
+			{"lower_bound": 50, "scaling_adjustment": 3},
+		},
+	},
+}
+
+// ecsScheduledActions raises the capacity for office hours
+var ecsScheduledActions = []map[string]interface{}{
+	{"name": "office-hours", "schedule": "cron(0 8 ? * MON-FRI *)", "timezone": "Europe/Madrid", "min_capacity": 2, "max_capacity": 6},
+	{"name": "after-hours", "schedule": "cron(0 20 ? * MON-FRI *)", "timezone": "Europe/Madrid", "min_capacity": 1},
+}
+
+// TestEcsModuleScalingPolicyConditions tests the scaling policy and scheduled
+// action validations without running terraform
+func TestEcsModuleScalingPolicyConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	failures, err := mod.CheckConditions(ecsListenerInputs(t, map[string]interface{}{
+		"scaling_policies":  ecsScalingPolicies,
+		"scheduled_actions": ecsScheduledActions,
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	step := func(change func(policy map[string]interface{})) []map[string]interface{} {
+		policy := map[string]interface{}{}
+		for k, v := range ecsScalingPolicies[3] {
+			policy[k] = v
+		}
+		change(policy)
+		return []map[string]interface{}{policy}
+	}
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{
+			name:    "UnknownType",
+			vars:    map[string]interface{}{"scaling_policies": []map[string]interface{}{{"name": "network", "type": "network", "target_value": 10}}},
+			subject: "var.scaling_policies",
+		},
+		{
+			name:    "DuplicateName",
+			vars:    map[string]interface{}{"scaling_policies": []map[string]interface{}{{"name": "cpu", "type": "cpu"}, {"name": "cpu", "type": "memory", "target_value": 75}}},
+			subject: "var.scaling_policies",
+		},
+		{
+			name:    "MemoryWithoutTarget",
+			vars:    map[string]interface{}{"scaling_policies": []map[string]interface{}{{"name": "memory", "type": "memory"}}},
+			subject: "var.scaling_policies",
+		},
+		{
+			name:    "StepWithoutSteps",
+			vars:    map[string]interface{}{"scaling_policies": step(func(p map[string]interface{}) { delete(p, "steps") })},
+			subject: "var.scaling_policies",
+		},
+		{
+			name: "StepComparison",
+			vars: map[string]interface{}{"scaling_policies": step(func(p map[string]interface{}) {
+				p["metric"] = map[string]interface{}{"name": "PendingWebhooks", "namespace": "Gogs", "comparison_operator": "Above", "threshold": 100}
+			})},
+			subject: "var.scaling_policies",
+		},
+		{
+			name:    "StepAdjustmentType",
+			vars:    map[string]interface{}{"scaling_policies": step(func(p map[string]interface{}) { p["adjustment_type"] = "ChangeInTasks" })},
+			subject: "var.scaling_policies",
+		},
+		{
+			name:    "BareCronSchedule",
+			vars:    map[string]interface{}{"scheduled_actions": []map[string]interface{}{{"name": "office-hours", "schedule": "0 8 * * MON-FRI", "min_capacity": 2}}},
+			subject: "var.scheduled_actions",
+		},
+		{
+			name:    "ScheduleWithoutCapacity",
+			vars:    map[string]interface{}{"scheduled_actions": []map[string]interface{}{{"name": "office-hours", "schedule": "cron(0 8 ? * MON-FRI *)"}}},
+			subject: "var.scheduled_actions",
+		},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, tc.vars))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// TestEcsModuleScalingPolicies tests the planned policy, alarm and scheduled
+// action of every kind, and that ALBRequestCountPerTarget is labelled with the
+// module's own load balancer and target group
+func TestEcsModuleScalingPolicies(t *testing.T) {
+	t.Parallel()
+
+	plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{
+		"scaling_policies":  ecsScalingPolicies,
+		"scheduled_actions": ecsScheduledActions,
+	}))
+
+	targetTracking := []struct {
+		name             string
+		metricType       string
+		targetValue      float64
+		scaleInCooldown  float64
+		scaleOutCooldown float64
+		disableScaleIn   bool
+	}{
+		{"cpu", "ECSServiceAverageCPUUtilization", 60, 300, 60, false},
+		{"memory", "ECSServiceAverageMemoryUtilization", 75, 600, 60, false},
+		{"requests", "ALBRequestCountPerTarget", 800, 300, 60, true},
+	}
+
+	assert.ElementsMatch(t, []string{
+		`aws_appautoscaling_policy.step["queue"]`,
+		`aws_appautoscaling_policy.target_tracking["cpu"]`,
+		`aws_appautoscaling_policy.target_tracking["memory"]`,
+		`aws_appautoscaling_policy.target_tracking["requests"]`,
+	}, resourceAddresses(plan, "aws_appautoscaling_policy"))
+
+	for _, tc := range targetTracking {
+		address := fmt.Sprintf("aws_appautoscaling_policy.target_tracking[%q]", tc.name)
+		policy := plan.ResourcePlannedValuesMap[address]
+		require.NotNil(t, policy, "%s is not planned", address)
+		assert.Equal(t, fmt.Sprintf("%s-staging-%s-autoscaling", testProjectName, tc.name), policy.AttributeValues["name"])
+		assert.Equal(t, "TargetTrackingScaling", policy.AttributeValues["policy_type"])
+
+		configs := policy.AttributeValues["target_tracking_scaling_policy_configuration"].([]interface{})
+		require.Len(t, configs, 1)
+		config := configs[0].(map[string]interface{})
+		assert.EqualValues(t, tc.targetValue, config["target_value"], tc.name)
+		assert.EqualValues(t, tc.scaleInCooldown, config["scale_in_cooldown"], tc.name)
+		assert.EqualValues(t, tc.scaleOutCooldown, config["scale_out_cooldown"], tc.name)
+		assert.Equal(t, tc.disableScaleIn, config["disable_scale_in"], tc.name)
+
+		specs := config["predefined_metric_specification"].([]interface{})
+		require.Len(t, specs, 1)
+		spec := specs[0].(map[string]interface{})
+		assert.Equal(t, tc.metricType, spec["predefined_metric_type"], tc.name)
+		if tc.metricType != "ALBRequestCountPerTarget" {
+			assert.Nil(t, spec["resource_label"], tc.name)
+		}
+	}
+
+	label := configReferences(t, plan, "aws_appautoscaling_policy.target_tracking", "target_tracking_scaling_policy_configuration.predefined_metric_specification.resource_label")
+	assert.Contains(t, label, "aws_lb.main")
+	assert.Contains(t, label, "aws_lb_target_group.main")
+
+	step := plan.ResourcePlannedValuesMap[`aws_appautoscaling_policy.step["queue"]`]
+	require.NotNil(t, step, "step scaling policy is not planned")
+	assert.Equal(t, "StepScaling", step.AttributeValues["policy_type"])
+	configs := step.AttributeValues["step_scaling_policy_configuration"].([]interface{})
+	require.Len(t, configs, 1)
+	config := configs[0].(map[string]interface{})
+	assert.Equal(t, "ChangeInCapacity", config["adjustment_type"])
+	assert.Equal(t, "Maximum", config["metric_aggregation_type"])
+	adjustments := config["step_adjustment"].([]interface{})
+	require.Len(t, adjustments, 2)
+	var scaling []float64
+	for _, a := range adjustments {
+		scaling = append(scaling, a.(map[string]interface{})["scaling_adjustment"].(float64))
+	}
+	assert.ElementsMatch(t, []float64{1, 3}, scaling)
+
+	alarm := plan.ResourcePlannedValuesMap[`aws_cloudwatch_metric_alarm.step_scaling["queue"]`]
+	require.NotNil(t, alarm, "step scaling alarm is not planned")
+	assert.Equal(t, "PendingWebhooks", alarm.AttributeValues["metric_name"])
+	assert.Equal(t, "Gogs", alarm.AttributeValues["namespace"])
+	assert.Equal(t, "Maximum", alarm.AttributeValues["statistic"])
+	assert.EqualValues(t, 100, alarm.AttributeValues["threshold"])
+	assert.Equal(t, "GreaterThanOrEqualToThreshold", alarm.AttributeValues["comparison_operator"])
+	assert.Equal(t, map[string]interface{}{"Environment": "staging"}, alarm.AttributeValues["dimensions"])
+	assert.Contains(t, configReferences(t, plan, "aws_cloudwatch_metric_alarm.step_scaling", "alarm_actions"), "aws_appautoscaling_policy.step")
+
+	for _, tc := range ecsScheduledActions {
+		address := fmt.Sprintf("aws_appautoscaling_scheduled_action.ecs[%q]", tc["name"])
+		action := plan.ResourcePlannedValuesMap[address]
+		require.NotNil(t, action, "%s is not planned", address)
+		assert.Equal(t, tc["schedule"], action.AttributeValues["schedule"])
+		assert.Equal(t, tc["timezone"], action.AttributeValues["timezone"])
+
+		targets := action.AttributeValues["scalable_target_action"].([]interface{})
+		require.Len(t, targets, 1)
+		target := targets[0].(map[string]interface{})
+		assert.Equal(t, fmt.Sprint(tc["min_capacity"]), fmt.Sprint(target["min_capacity"]))
+		if capacity, ok := tc["max_capacity"]; ok {
+			assert.Equal(t, fmt.Sprint(capacity), fmt.Sprint(target["max_capacity"]))
+		}
+	}
+}
+
+// TestEcsModuleScalingDisabled tests that no policy, alarm or scheduled action
+// is planned without auto scaling
+func TestEcsModuleScalingDisabled(t *testing.T) {
+	t.Parallel()
+
+	plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{
+		"enable_autoscaling": false,
+		"scaling_policies":   ecsScalingPolicies,
+		"scheduled_actions":  ecsScheduledActions,
+		"scaling_windows":    []map[string]interface{}{},
+	}))
+
+	assert.Empty(t, resourceAddresses(plan, "aws_appautoscaling_target"))
+	assert.Empty(t, resourceAddresses(plan, "aws_appautoscaling_policy"))
+	assert.Empty(t, resourceAddresses(plan, "aws_cloudwatch_metric_alarm"))
+	assert.Empty(t, resourceAddresses(plan, "aws_appautoscaling_scheduled_action"))
+}
+
+// TestEcsModuleDeploymentConditions tests the deployment validations without
+// running terraform
+func TestEcsModuleDeploymentConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{"MinimumHealthyAbove100", map[string]interface{}{"deployment_minimum_healthy_percent": 150}, "var.deployment_minimum_healthy_percent"},
+		{"MaximumBelow100", map[string]interface{}{"deployment_maximum_percent": 50}, "var.deployment_maximum_percent"},
+		{"NegativeGracePeriod", map[string]interface{}{"health_check_grace_period_seconds": -1}, "var.health_check_grace_period_seconds"},
+		{"ZeroAlarmThreshold", map[string]interface{}{"deployment_5xx_alarm_threshold": 0}, "var.deployment_5xx_alarm_threshold"},
+		{"TestListenerOnHTTPPort", map[string]interface{}{"blue_green_test_listener_port": 80}, "var.blue_green_test_listener_port"},
+		{"TestListenerOpenToInternet", map[string]interface{}{"blue_green_test_listener_cidr_blocks": []string{"0.0.0.0/0"}}, "var.blue_green_test_listener_cidr_blocks"},
+		{"TestListenerNotACIDR", map[string]interface{}{"blue_green_test_listener_cidr_blocks": []string{"10.1.0.0"}}, "var.blue_green_test_listener_cidr_blocks"},
+		{"TerminationWaitAboveTwoDays", map[string]interface{}{"blue_green_termination_wait_minutes": 2881}, "var.blue_green_termination_wait_minutes"},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, tc.vars))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// TestEcsModuleDeploymentConfiguration tests the rolling deployment settings
+// of the staging service and the CodeDeploy rollback settings of the
+// production blue/green service, including the 5XX alarm of production
+func TestEcsModuleDeploymentConfiguration(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		environment string
+		service     string
+		alarm       bool
+	}{
+		{"staging", "aws_ecs_service.main[0]", false},
+		{"production", "aws_ecs_service.blue_green[0]", true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.environment, func(t *testing.T) {
+			t.Parallel()
+
+			plan := planModule(t, "ecs", tc.environment, environmentInputs(t, tc.environment, "ecs"))
+
+			service := plan.ResourcePlannedValuesMap[tc.service]
+			require.NotNil(t, service, "%s is not planned", tc.service)
+			assert.EqualValues(t, 60, service.AttributeValues["health_check_grace_period_seconds"])
+			assert.Equal(t, true, service.AttributeValues["wait_for_steady_state"])
+
+			alarmName := fmt.Sprintf("%s-%s-target-5xx", testProjectName, tc.environment)
+			alarm := plan.ResourcePlannedValuesMap["aws_cloudwatch_metric_alarm.deployment_5xx[0]"]
+			if !tc.alarm {
+				assert.EqualValues(t, 50, service.AttributeValues["deployment_minimum_healthy_percent"])
+				assert.EqualValues(t, 200, service.AttributeValues["deployment_maximum_percent"])
+
+				breakers := service.AttributeValues["deployment_circuit_breaker"].([]interface{})
+				require.Len(t, breakers, 1)
+				breaker := breakers[0].(map[string]interface{})
+				assert.Equal(t, true, breaker["enable"])
+				assert.Equal(t, true, breaker["rollback"])
+
+				alarms, _ := service.AttributeValues["alarms"].([]interface{})
+				assert.Empty(t, alarms)
+				assert.Nil(t, alarm)
+				return
+			}
+
+			// CodeDeploy services roll back through the deployment group
+			breakers, _ := service.AttributeValues["deployment_circuit_breaker"].([]interface{})
+			assert.Empty(t, breakers)
+
+			group := plan.ResourcePlannedValuesMap["aws_codedeploy_deployment_group.main[0]"]
+			require.NotNil(t, group, "deployment group is not planned")
+			rollbacks := group.AttributeValues["auto_rollback_configuration"].([]interface{})
+			require.Len(t, rollbacks, 1)
+			rollback := rollbacks[0].(map[string]interface{})
+			assert.Equal(t, true, rollback["enabled"])
+			assert.ElementsMatch(t, []interface{}{"DEPLOYMENT_FAILURE", "DEPLOYMENT_STOP_ON_ALARM"}, rollback["events"])
+
+			alarms := group.AttributeValues["alarm_configuration"].([]interface{})
+			require.Len(t, alarms, 1)
+			config := alarms[0].(map[string]interface{})
+			assert.Equal(t, []interface{}{alarmName}, config["alarms"])
+			assert.Equal(t, true, config["enabled"])
+
+			require.NotNil(t, alarm, "deployment 5XX alarm is not planned")
+			assert.Equal(t, alarmName, alarm.AttributeValues["alarm_name"])
+			assert.Equal(t, "HTTPCode_Target_5XX_Count", alarm.AttributeValues["metric_name"])
+			assert.EqualValues(t, 10, alarm.AttributeValues["threshold"])
+			dimensions := configReferences(t, plan, "aws_cloudwatch_metric_alarm.deployment_5xx", "dimensions")
+			assert.Contains(t, dimensions, "aws_lb.main.arn_suffix")
+			assert.NotContains(t, dimensions, "aws_lb_target_group.main.arn_suffix")
+		})
+	}
+}
+
+// TestEcsModuleBlueGreenLifecycle tests that terraform leaves the blue/green
+// service and listeners to CodeDeploy after creation, without running
+// terraform
+func TestEcsModuleBlueGreenLifecycle(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	ignored := map[string][]string{
+		"aws_ecs_service.blue_green": {"task_definition", "load_balancer", "network_configuration", "desired_count"},
+		"aws_lb_listener.blue_green": {"default_action"},
+	}
+	for address, paths := range ignored {
+		resource, ok := mod.Resource(address)
+		require.True(t, ok, "%s not found", address)
+		for _, path := range paths {
+			assert.True(t, resource.Ignores(path), "%s does not ignore %s", address, path)
+		}
+	}
+
+	// The rolling service is deployed by terraform
+	service, ok := mod.Resource("aws_ecs_service.main")
+	require.True(t, ok)
+	assert.False(t, service.Ignores("task_definition"))
+}
+
+// TestEcsModuleBlueGreen tests the target groups, the listener wiring, the
+// deployment group and the deployment controller of blue/green mode, with and
+// without a certificate
+func TestEcsModuleBlueGreen(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		vars     map[string]interface{}
+		protocol string
+		port     float64
+		http     bool
+		// testCIDRs may reach the test listener; it is closed without them
+		testCIDRs []interface{}
+	}{
+		{
+			name:     "HTTP",
+			vars:     map[string]interface{}{"enable_blue_green": true},
+			protocol: "HTTP",
+			port:     80,
+		},
+		{
+			name:     "HTTPS",
+			vars:     map[string]interface{}{"enable_blue_green": true, "acm_certificate_arn": ecsTestCertificateARN, "redirect_http_to_https": false},
+			protocol: "HTTPS",
+			port:     443,
+			http:     true,
+		},
+		{
+			name:      "TestListenerFromVPC",
+			vars:      map[string]interface{}{"enable_blue_green": true, "blue_green_test_listener_cidr_blocks": []string{"10.0.0.0/16"}},
+			protocol:  "HTTP",
+			port:      80,
+			testCIDRs: []interface{}{"10.0.0.0/16"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, tc.vars))
+
+			assert.ElementsMatch(t, []string{"aws_lb_target_group.main", "aws_lb_target_group.green[0]"},
+				resourceAddresses(plan, "aws_lb_target_group"))
+			green := plan.ResourcePlannedValuesMap["aws_lb_target_group.green[0]"]
+			require.NotNil(t, green, "green target group is not planned")
+			assert.Equal(t, testProjectName+"-staging-tg-green", green.AttributeValues["name"])
+
+			listeners := map[string]float64{"production": tc.port, "test": 8443}
+			for name, port := range listeners {
+				address := `aws_lb_listener.blue_green["` + name + `"]`
+				listener := plan.ResourcePlannedValuesMap[address]
+				require.NotNil(t, listener, "%s is not planned", address)
+				assert.EqualValues(t, port, listener.AttributeValues["port"], address)
+				assert.Equal(t, tc.protocol, listener.AttributeValues["protocol"], address)
+			}
+			assert.Contains(t, configReferences(t, plan, "aws_lb_listener.blue_green", "default_action.target_group_arn"), "aws_lb_target_group.main.arn")
+			assert.Nil(t, plan.ResourcePlannedValuesMap["aws_lb_listener.https[0]"])
+
+			// The production ingress CIDRs never reach the test listener
+			sg := plan.ResourcePlannedValuesMap["aws_security_group.alb"]
+			require.NotNil(t, sg, "aws_security_group.alb is not planned")
+			var testCIDRs []interface{}
+			for _, rule := range sg.AttributeValues["ingress"].([]interface{}) {
+				if rule := rule.(map[string]interface{}); rule["from_port"] == float64(8443) {
+					testCIDRs = rule["cidr_blocks"].([]interface{})
+				}
+			}
+			assert.Equal(t, tc.testCIDRs, testCIDRs)
+
+			// Port 80 always redirects once HTTPS is served
+			http := plan.ResourcePlannedValuesMap["aws_lb_listener.http[0]"]
+			if tc.http {
+				require.NotNil(t, http, "aws_lb_listener.http[0] is not planned")
+				actions := http.AttributeValues["default_action"].([]interface{})
+				assert.Equal(t, "redirect", actions[0].(map[string]interface{})["type"])
+			} else {
+				assert.Nil(t, http)
+			}
+
+			assert.Nil(t, plan.ResourcePlannedValuesMap["aws_ecs_service.main[0]"])
+			service := plan.ResourcePlannedValuesMap["aws_ecs_service.blue_green[0]"]
+			require.NotNil(t, service, "blue/green service is not planned")
+			assert.Equal(t, testProjectName+"-staging-service-bg", service.AttributeValues["name"])
+			controllers := service.AttributeValues["deployment_controller"].([]interface{})
+			require.Len(t, controllers, 1)
+			assert.Equal(t, "CODE_DEPLOY", controllers[0].(map[string]interface{})["type"])
+
+			group := plan.ResourcePlannedValuesMap["aws_codedeploy_deployment_group.main[0]"]
+			require.NotNil(t, group, "deployment group is not planned")
+			styles := group.AttributeValues["deployment_style"].([]interface{})
+			require.Len(t, styles, 1)
+			assert.Equal(t, "BLUE_GREEN", styles[0].(map[string]interface{})["deployment_type"])
+			assert.Equal(t, "WITH_TRAFFIC_CONTROL", styles[0].(map[string]interface{})["deployment_option"])
+
+			infos := group.AttributeValues["load_balancer_info"].([]interface{})
+			require.Len(t, infos, 1)
+			pairs := infos[0].(map[string]interface{})["target_group_pair_info"].([]interface{})
+			require.Len(t, pairs, 1)
+			var names []interface{}
+			for _, tg := range pairs[0].(map[string]interface{})["target_group"].([]interface{}) {
+				names = append(names, tg.(map[string]interface{})["name"])
+			}
+			assert.ElementsMatch(t, []interface{}{testProjectName + "-staging-tg", testProjectName + "-staging-tg-green"}, names)
+		})
+	}
+}
+
+// TestEcsModuleBlueGreenMigration tests the switch of a rolling stack to
+// blue/green in MODULES.md against LocalStack: once the production listener is
+// moved and the rolling service removed from the state, enabling blue/green
+// keeps the listeners and starts the blue/green service next to the rolling
+// one
+func TestEcsModuleBlueGreenMigration(t *testing.T) {
+	t.Parallel()
+	if os.Getenv("LOCALSTACK_ENDPOINT") == "" {
+		t.Skip("LOCALSTACK_ENDPOINT is not set")
+	}
+
+	vpc := applyOptions(t, moduleOptions(t, "vpc", defaultTags("staging"), environmentInputs(t, "staging", "vpc")))
+	defer terraform.Destroy(t, vpc)
+	terraform.InitAndApply(t, vpc)
+
+	vars := ecsListenerInputs(t, dependencyInputs("ecs", map[string]map[string]interface{}{"vpc": terraform.OutputAll(t, vpc)}))
+	vars["task_security_group_ids"] = []string{}
+	options := moduleOptions(t, "ecs", defaultTags("staging"), vars)
+	apply := applyOptions(t, options)
+	defer terraform.Destroy(t, apply)
+	terraform.InitAndApply(t, apply)
+	rolling := terraform.Output(t, apply, "service_name")
+
+	const production = `aws_lb_listener.blue_green["production"]`
+	terraform.RunTerraformCommand(t, options, "state", "mv", "aws_lb_listener.http[0]", production)
+	terraform.RunTerraformCommand(t, options, "state", "rm", "aws_ecs_service.main[0]")
+
+	// Hand the rolling stack back to terraform to destroy it
+	defer func() {
+		terraform.RunTerraformCommand(t, options, "state", "mv", production, "aws_lb_listener.http[0]")
+		args := append([]string{"import", "-input=false"}, terraform.FormatTerraformVarsAsArgs(apply.Vars)...)
+		terraform.RunTerraformCommand(t, apply, append(args, "aws_ecs_service.main[0]", testProjectName+"-staging-cluster/"+rolling)...)
+	}()
+
+	options.Vars["enable_blue_green"] = true
+	plan := terraformPlan(t, options)
+
+	for address, change := range plan.ResourceChangesMap {
+		if change.Type == "aws_lb_listener" || change.Type == "aws_ecs_service" {
+			assert.False(t, change.Change.Actions.Delete() || change.Change.Actions.Replace(), "%s is destroyed", address)
+		}
+	}
+	listener := plan.ResourceChangesMap[production]
+	require.NotNil(t, listener, "%s is not planned", production)
+	assert.False(t, listener.Change.Actions.Create(), "%s is created", production)
+
+	service := plan.ResourcePlannedValuesMap["aws_ecs_service.blue_green[0]"]
+	require.NotNil(t, service, "blue/green service is not planned")
+	assert.NotEqual(t, rolling, service.AttributeValues["name"])
+}
+
+// ecsSidecarInputs returns the staging ECS inputs with an SSH server for git
+// over SSH and a FireLens log router that the application waits for. change
+// edits the SSH sidecar.
+func ecsSidecarInputs(t *testing.T, change func(ssh map[string]interface{})) map[string]interface{} {
+	t.Helper()
+
+	ssh := map[string]interface{}{
+		"name":          "ssh",
+		"image":         "gogs/sshd:latest",
+		"essential":     true,
+		"port_mappings": []map[string]interface{}{{"container_port": 2222}},
+		"depends_on":    []map[string]interface{}{{"container_name": "gogs-app", "condition": "HEALTHY"}},
+	}
+	change(ssh)
+
+	return ecsListenerInputs(t, map[string]interface{}{
+		"sidecars": []map[string]interface{}{
+			ssh,
+			{
+				"name":      "log-router",
+				"image":     "public.ecr.aws/aws-observability/aws-for-fluent-bit:stable",
+				"essential": true,
+				"firelens":  map[string]interface{}{"type": "fluentbit"},
+			},
+		},
+		"container_depends_on": []map[string]interface{}{{"container_name": "log-router"}},
+		"log_driver":           "awslogs",
+	})
+}
+
+// TestEcsModuleSidecarConditions tests the sidecar validations and the
+// container name, port and dependency preconditions without running terraform
+func TestEcsModuleSidecarConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	failures, err := mod.CheckConditions(ecsSidecarInputs(t, func(map[string]interface{}) {}))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	// The same port is allowed once per protocol
+	failures, err = mod.CheckConditions(ecsSidecarInputs(t, func(ssh map[string]interface{}) {
+		ssh["port_mappings"] = []map[string]interface{}{{"container_port": 8080, "protocol": "udp"}}
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	invalid := []struct {
+		name    string
+		change  func(ssh map[string]interface{})
+		subject string
+	}{
+		{"NameOfApplication", func(ssh map[string]interface{}) { ssh["name"] = "gogs-app" }, "aws_ecs_task_definition.main"},
+		{"DuplicateName", func(ssh map[string]interface{}) { ssh["name"] = "log-router" }, "var.sidecars"},
+		{"InvalidName", func(ssh map[string]interface{}) { ssh["name"] = "ssh server" }, "var.sidecars"},
+		{"PortOfApplication", func(ssh map[string]interface{}) {
+			ssh["port_mappings"] = []map[string]interface{}{{"container_port": 8080}}
+		}, "aws_ecs_task_definition.main"},
+		{"PortOutOfRange", func(ssh map[string]interface{}) {
+			ssh["port_mappings"] = []map[string]interface{}{{"container_port": 70000}}
+		}, "var.sidecars"},
+		{"UnknownDependency", func(ssh map[string]interface{}) {
+			ssh["depends_on"] = []map[string]interface{}{{"container_name": "sshd-keys"}}
+		}, "aws_ecs_task_definition.main"},
+		{"InvalidCondition", func(ssh map[string]interface{}) {
+			ssh["depends_on"] = []map[string]interface{}{{"container_name": "gogs-app", "condition": "RUNNING"}}
+		}, "var.sidecars"},
+		{"SelfDependency", func(ssh map[string]interface{}) {
+			ssh["depends_on"] = []map[string]interface{}{{"container_name": "ssh"}}
+		}, "var.sidecars"},
+		{"SecondLogRouter", func(ssh map[string]interface{}) {
+			ssh["firelens"] = map[string]interface{}{"type": "fluentd"}
+		}, "var.sidecars"},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsSidecarInputs(t, tc.change))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// ecsContainerDefinitions plans the staging ECS module with vars and returns
+// the container names in order and the containers by name
+func ecsContainerDefinitions(t *testing.T, vars map[string]interface{}) ([]string, map[string]map[string]interface{}) {
+	t.Helper()
+
+	plan := planModule(t, "ecs", "staging", vars)
+
+	task := plan.ResourcePlannedValuesMap["aws_ecs_task_definition.main"]
+	require.NotNil(t, task, "aws_ecs_task_definition.main is not planned")
+	var containers []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(task.AttributeValues["container_definitions"].(string)), &containers))
+
+	var names []string
+	byName := map[string]map[string]interface{}{}
+	for _, container := range containers {
+		name := container["name"].(string)
+		names = append(names, name)
+		byName[name] = container
+	}
+	return names, byName
+}
+
+// TestEcsModuleContainerDefinitions tests the order, dependencies, ports and
+// log configuration of the containers in the task definition
+func TestEcsModuleContainerDefinitions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ApplicationOnly", func(t *testing.T) {
+		t.Parallel()
+
+		names, containers := ecsContainerDefinitions(t, ecsListenerInputs(t, map[string]interface{}{"log_driver": "awslogs"}))
+		assert.Equal(t, []string{"gogs-app"}, names)
+		assert.Nil(t, containers["gogs-app"]["dependsOn"])
+	})
+
+	t.Run("Sidecars", func(t *testing.T) {
+		t.Parallel()
+
+		names, containers := ecsContainerDefinitions(t, ecsSidecarInputs(t, func(map[string]interface{}) {}))
+		assert.Equal(t, []string{"gogs-app", "ssh", "log-router"}, names)
+
+		dependsOn := map[string][]interface{}{
+			"gogs-app":   {map[string]interface{}{"containerName": "log-router", "condition": "START"}},
+			"ssh":        {map[string]interface{}{"containerName": "gogs-app", "condition": "HEALTHY"}},
+			"log-router": nil,
+		}
+		ports := map[string]string{}
+		for name, want := range dependsOn {
+			container := containers[name]
+			require.NotNil(t, container, "%s is not defined", name)
+			got, _ := container["dependsOn"].([]interface{})
+			assert.Equal(t, want, got, name)
+
+			mappings, _ := container["portMappings"].([]interface{})
+			for _, m := range mappings {
+				mapping := m.(map[string]interface{})
+				port := fmt.Sprintf("%v/%v", mapping["containerPort"], mapping["protocol"])
+				assert.NotContains(t, ports, port, "%s maps %s of %s", name, port, ports[port])
+				ports[port] = name
+			}
+		}
+		assert.Equal(t, map[string]string{"8080/tcp": "gogs-app", "2222/tcp": "ssh"}, ports)
+
+		firelens, ok := containers["log-router"]["firelensConfiguration"].(map[string]interface{})
+		require.True(t, ok, "log-router has no firelensConfiguration")
+		assert.Equal(t, "fluentbit", firelens["type"])
+		assert.Nil(t, containers["ssh"]["firelensConfiguration"])
+
+		for name, prefix := range map[string]string{"gogs-app": "ecs", "ssh": "ssh", "log-router": "log-router"} {
+			logs := containers[name]["logConfiguration"].(map[string]interface{})
+			assert.Equal(t, "awslogs", logs["logDriver"], name)
+			assert.Equal(t, prefix, logs["options"].(map[string]interface{})["awslogs-stream-prefix"], name)
+		}
+	})
+}
+
+// TestEcsModuleSplunkLogConditions tests the log driver and Splunk routing
+// validations and preconditions without running terraform
+func TestEcsModuleSplunkLogConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	routing := func(endpoint, secret string) map[string]interface{} {
+		return map[string]interface{}{"hec_endpoint": endpoint, "hec_token_secret_arn": secret}
+	}
+	const secret = "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-splunk"
+	router := map[string]interface{}{"name": "fluentd", "image": "fluent/fluentd:latest", "firelens": map[string]interface{}{"type": "fluentd"}}
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{"UnknownDriver", map[string]interface{}{"log_driver": "syslog"}, "var.log_driver"},
+		{"SplunkWithoutRouting", map[string]interface{}{"splunk_log_routing": nil}, "aws_ecs_task_definition.main"},
+		{"EndpointWithoutPort", map[string]interface{}{"splunk_log_routing": routing("https://10.0.1.10", secret)}, "var.splunk_log_routing"},
+		{"TokenNotASecret", map[string]interface{}{"splunk_log_routing": routing("https://10.0.1.10:8088", "arn:aws:ssm:us-east-1:123456789:parameter/hec")}, "var.splunk_log_routing"},
+		{"SecondRouter", map[string]interface{}{"sidecars": []map[string]interface{}{router}}, "aws_ecs_task_definition.main"},
+		{"RouterName", map[string]interface{}{"sidecars": []map[string]interface{}{{"name": "log-router", "image": "busybox:latest"}}}, "aws_ecs_task_definition.main"},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, tc.vars))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+
+	// The router is added to the sidecars of the module
+	failures, err := mod.CheckConditions(ecsListenerInputs(t, map[string]interface{}{"sidecars": []map[string]interface{}{{"name": "ssh", "image": "gogs/sshd:latest"}}}))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	// Without the splunk driver the routing is not needed
+	failures, err = mod.CheckConditions(ecsListenerInputs(t, map[string]interface{}{"log_driver": "awslogs", "splunk_log_routing": nil, "sidecars": []map[string]interface{}{router}}))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+}
+
+// TestEcsModuleSplunkLogRouting tests the FireLens log router, the Splunk
+// output of the application container and the access to the HEC token
+func TestEcsModuleSplunkLogRouting(t *testing.T) {
+	t.Parallel()
+
+	const secret = "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-splunk"
+
+	names, containers := ecsContainerDefinitions(t, ecsListenerInputs(t, map[string]interface{}{}))
+	assert.Equal(t, []string{"gogs-app", "log-router"}, names)
+
+	router := containers["log-router"]
+	assert.Equal(t, true, router["essential"])
+	firelens, ok := router["firelensConfiguration"].(map[string]interface{})
+	require.True(t, ok, "log-router has no firelensConfiguration")
+	assert.Equal(t, "fluentbit", firelens["type"])
+	// The router logs to CloudWatch, as it cannot route its own logs
+	assert.Equal(t, "awslogs", router["logConfiguration"].(map[string]interface{})["logDriver"])
+
+	app := containers["gogs-app"]
+	assert.Equal(t, []interface{}{map[string]interface{}{"containerName": "log-router", "condition": "START"}}, app["dependsOn"])
+
+	logs := app["logConfiguration"].(map[string]interface{})
+	assert.Equal(t, "awsfirelens", logs["logDriver"])
+	assert.Equal(t, map[string]interface{}{
+		"Name":         "splunk",
+		"Host":         "10.0.1.10",
+		"Port":         "8088",
+		"TLS":          "On",
+		"TLS.Verify":   "Off",
+		"event_source": testProjectName + "-staging",
+	}, logs["options"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "splunk_token", "valueFrom": secret + ":hec_token::"}}, logs["secretOptions"])
+
+	// The execution role reads the token when it starts the tasks
+	plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{"secrets_manager_arns": []string{}}))
+	policy := plan.ResourcePlannedValuesMap["aws_iam_role_policy.ecs_secrets_policy"]
+	require.NotNil(t, policy, "aws_iam_role_policy.ecs_secrets_policy is not planned")
+	var document struct {
+		Statement []struct {
+			Action   []string
+			Resource []string
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(policy.AttributeValues["policy"].(string)), &document))
+	require.Len(t, document.Statement, 1)
+	assert.Equal(t, []string{"secretsmanager:GetSecretValue"}, document.Statement[0].Action)
+	assert.Equal(t, []string{secret}, document.Statement[0].Resource)
+}
+
+// TestEcsModuleEFSConditions tests the EFS storage validations without
+// running terraform
+func TestEcsModuleEFSConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	storage := func(change func(efs map[string]interface{})) map[string]interface{} {
+		efs := map[string]interface{}{"container_path": "/data"}
+		change(efs)
+		return map[string]interface{}{"efs_storage": efs}
+	}
+
+	failures, err := mod.CheckConditions(ecsListenerInputs(t, storage(func(map[string]interface{}) {})))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	invalid := []struct {
+		name   string
+		change func(efs map[string]interface{})
+	}{
+		{"RelativeContainerPath", func(efs map[string]interface{}) { efs["container_path"] = "data" }},
+		{"RelativeRootDirectory", func(efs map[string]interface{}) { efs["root_directory"] = "gogs" }},
+		{"NegativeUID", func(efs map[string]interface{}) { efs["posix_user"] = map[string]interface{}{"uid": -1, "gid": 1000} }},
+		{"SymbolicPermissions", func(efs map[string]interface{}) { efs["permissions"] = "rwxr-xr-x" }},
+		{"ProvisionedThroughput", func(efs map[string]interface{}) { efs["throughput_mode"] = "provisioned" }},
+		{"UnknownTransition", func(efs map[string]interface{}) { efs["transition_to_ia"] = "AFTER_2_DAYS" }},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, storage(tc.change)))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, "var.efs_storage", tc.name)
+	}
+}
+
+// TestEcsModuleEFSStorage tests the mount target of each private subnet, the
+// access point, the task definition volume with its IAM authorization and the
+// mount point of the application container
+func TestEcsModuleEFSStorage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		iam  bool
+	}{
+		{"IAMAuthorization", true},
+		{"NetworkOnly", false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			vars := ecsListenerInputs(t, map[string]interface{}{
+				"efs_storage": map[string]interface{}{
+					"container_path":    "/data",
+					"posix_user":        map[string]interface{}{"uid": 1000, "gid": 1000},
+					"iam_authorization": tc.iam,
+				},
+			})
+			plan := planModule(t, "ecs", "staging", vars)
+
+			subnets := vars["private_subnet_ids"].([]string)
+			require.Len(t, resourceAddresses(plan, "aws_efs_mount_target"), len(subnets))
+			for i, subnet := range subnets {
+				address := fmt.Sprintf("aws_efs_mount_target.main[%d]", i)
+				target := plan.ResourcePlannedValuesMap[address]
+				require.NotNil(t, target, "%s is not planned", address)
+				assert.Equal(t, subnet, target.AttributeValues["subnet_id"])
+			}
+			assert.Contains(t, configReferences(t, plan, "aws_security_group.efs", "ingress.security_groups"), "aws_security_group.ecs_tasks.id")
+
+			fs := plan.ResourcePlannedValuesMap["aws_efs_file_system.main[0]"]
+			require.NotNil(t, fs, "aws_efs_file_system.main[0] is not planned")
+			assert.Equal(t, true, fs.AttributeValues["encrypted"])
+
+			accessPoint := plan.ResourcePlannedValuesMap["aws_efs_access_point.main[0]"]
+			require.NotNil(t, accessPoint, "aws_efs_access_point.main[0] is not planned")
+			users := accessPoint.AttributeValues["posix_user"].([]interface{})
+			require.Len(t, users, 1)
+			assert.EqualValues(t, 1000, users[0].(map[string]interface{})["uid"])
+			roots := accessPoint.AttributeValues["root_directory"].([]interface{})
+			require.Len(t, roots, 1)
+			assert.Equal(t, "/gogs", roots[0].(map[string]interface{})["path"])
+
+			task := plan.ResourcePlannedValuesMap["aws_ecs_task_definition.main"]
+			require.NotNil(t, task, "aws_ecs_task_definition.main is not planned")
+			volumes := task.AttributeValues["volume"].([]interface{})
+			require.Len(t, volumes, 1)
+			volume := volumes[0].(map[string]interface{})
+			assert.Equal(t, "efs", volume["name"])
+			configs := volume["efs_volume_configuration"].([]interface{})
+			require.Len(t, configs, 1)
+			config := configs[0].(map[string]interface{})
+			assert.Equal(t, "ENABLED", config["transit_encryption"])
+			authorizations := config["authorization_config"].([]interface{})
+			require.Len(t, authorizations, 1)
+			want := map[bool]string{true: "ENABLED", false: "DISABLED"}[tc.iam]
+			assert.Equal(t, want, authorizations[0].(map[string]interface{})["iam"])
+
+			policy := plan.ResourcePlannedValuesMap["aws_iam_role_policy.ecs_task_efs[0]"]
+			if tc.iam {
+				require.NotNil(t, policy, "task role has no EFS policy")
+			} else {
+				assert.Nil(t, policy)
+			}
+
+			var containers []map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(task.AttributeValues["container_definitions"].(string)), &containers))
+			assert.Equal(t, []interface{}{map[string]interface{}{"sourceVolume": "efs", "containerPath": "/data", "readOnly": false}}, containers[0]["mountPoints"])
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{"efs_storage": nil}))
+		assert.Empty(t, resourceAddresses(plan, "aws_efs_file_system"))
+		assert.Empty(t, resourceAddresses(plan, "aws_efs_mount_target"))
+		volumes, _ := plan.ResourcePlannedValuesMap["aws_ecs_task_definition.main"].AttributeValues["volume"].([]interface{})
+		assert.Empty(t, volumes)
+	})
+}
+
+// TestEcsModuleExecConditions tests the ECS Exec and task role policy
+// validations without running terraform
+func TestEcsModuleExecConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	statement := func(change func(statement map[string]interface{})) map[string]interface{} {
+		s := map[string]interface{}{"actions": []string{"s3:GetObject"}, "resources": []string{"arn:aws:s3:::gogs-avatars/*"}}
+		change(s)
+		return map[string]interface{}{"task_role_policy_statements": []map[string]interface{}{s}}
+	}
+
+	failures, err := mod.CheckConditions(ecsListenerInputs(t, statement(func(s map[string]interface{}) { s["sid"] = "ReadAvatars" })))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{"LowercaseEffect", statement(func(s map[string]interface{}) { s["effect"] = "allow" }), "var.task_role_policy_statements"},
+		{"NoActions", statement(func(s map[string]interface{}) { s["actions"] = []string{} }), "var.task_role_policy_statements"},
+		{"NoResources", statement(func(s map[string]interface{}) { s["resources"] = []string{} }), "var.task_role_policy_statements"},
+		{"SidWithHyphen", statement(func(s map[string]interface{}) { s["sid"] = "read-avatars" }), "var.task_role_policy_statements"},
+		{"KeyAlias", map[string]interface{}{"execute_command_kms_key_arn": "alias/gogs-exec"}, "var.execute_command_kms_key_arn"},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, tc.vars))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// TestEcsModuleTaskRolePolicy tests the task role policy with and without
+// ECS Exec, and the exec configuration of the cluster and services
+func TestEcsModuleTaskRolePolicy(t *testing.T) {
+	t.Parallel()
+
+	const execKey = "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	appStatements := []map[string]interface{}{
+		{
+			"sid":       "ReadAvatars",
+			"actions":   []string{"s3:GetObject"},
+			"resources": []string{"arn:aws:s3:::gogs-avatars/*"},
+			"conditions": []map[string]interface{}{
+				{"test": "StringEquals", "variable": "s3:ExistingObjectTag/public", "values": []string{"true"}},
+				{"test": "StringEquals", "variable": "aws:ResourceAccount", "values": []string{"123456789012"}},
+				{"test": "Bool", "variable": "aws:SecureTransport", "values": []string{"true"}},
+			},
+		},
+		{
+			"effect":    "Deny",
+			"actions":   []string{"s3:DeleteObject"},
+			"resources": []string{"*"},
+		},
+	}
+	appPolicy := []interface{}{
+		map[string]interface{}{
+			"Sid":      "ReadAvatars",
+			"Effect":   "Allow",
+			"Action":   []interface{}{"s3:GetObject"},
+			"Resource": []interface{}{"arn:aws:s3:::gogs-avatars/*"},
+			"Condition": map[string]interface{}{
+				"StringEquals": map[string]interface{}{
+					"s3:ExistingObjectTag/public": []interface{}{"true"},
+					"aws:ResourceAccount":         []interface{}{"123456789012"},
+				},
+				"Bool": map[string]interface{}{"aws:SecureTransport": []interface{}{"true"}},
+			},
+		},
+		map[string]interface{}{
+			"Effect":   "Deny",
+			"Action":   []interface{}{"s3:DeleteObject"},
+			"Resource": []interface{}{"*"},
+		},
+	}
+
+	// taskRolePolicy returns the statements of the planned task role policy
+	taskRolePolicy := func(t *testing.T, plan *terraform.PlanStruct) []interface{} {
+		policy := plan.ResourcePlannedValuesMap["aws_iam_role_policy.ecs_task[0]"]
+		require.NotNil(t, policy, "aws_iam_role_policy.ecs_task[0] is not planned")
+		document, ok := policy.AttributeValues["policy"].(string)
+		require.True(t, ok, "task role policy is unknown until apply")
+		var decoded struct{ Statement []interface{} }
+		require.NoError(t, json.Unmarshal([]byte(document), &decoded))
+		return decoded.Statement
+	}
+
+	t.Run("AppStatements", func(t *testing.T) {
+		t.Parallel()
+
+		plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{
+			"enable_execute_command":      false,
+			"task_role_policy_statements": appStatements,
+		}))
+		assert.Equal(t, appPolicy, taskRolePolicy(t, plan))
+
+		assert.Equal(t, false, plan.ResourcePlannedValuesMap["aws_ecs_service.main[0]"].AttributeValues["enable_execute_command"])
+		configurations, _ := plan.ResourcePlannedValuesMap["aws_ecs_cluster.main"].AttributeValues["configuration"].([]interface{})
+		assert.Empty(t, configurations)
+		assert.Empty(t, resourceAddresses(plan, "aws_kms_key"))
+		assert.Nil(t, plan.ResourcePlannedValuesMap["aws_cloudwatch_log_group.exec[0]"])
+	})
+
+	t.Run("ExecWithCallerKey", func(t *testing.T) {
+		t.Parallel()
+
+		vars := environmentInputs(t, "production", "ecs")
+		vars["enable_execute_command"] = true
+		vars["execute_command_kms_key_arn"] = execKey
+		vars["task_role_policy_statements"] = appStatements
+		plan := planModule(t, "ecs", "production", vars)
+
+		statements := taskRolePolicy(t, plan)
+		require.Len(t, statements, 6)
+		// The exec statements come first
+		assert.Equal(t, appPolicy, statements[4:])
+
+		bySid := map[string]map[string]interface{}{}
+		for _, s := range statements[:4] {
+			statement := s.(map[string]interface{})
+			assert.Equal(t, "Allow", statement["Effect"])
+			assert.NotContains(t, statement, "Condition")
+			bySid[statement["Sid"].(string)] = statement
+		}
+		assert.Equal(t, []interface{}{
+			"ssmmessages:CreateControlChannel",
+			"ssmmessages:CreateDataChannel",
+			"ssmmessages:OpenControlChannel",
+			"ssmmessages:OpenDataChannel",
+		}, bySid["ExecSessionChannels"]["Action"])
+		assert.Equal(t, []interface{}{"kms:Decrypt"}, bySid["ExecSessionDecrypt"]["Action"])
+		assert.Equal(t, []interface{}{execKey}, bySid["ExecSessionDecrypt"]["Resource"])
+		assert.Equal(t, []interface{}{"logs:DescribeLogGroups"}, bySid["ExecSessionLogGroups"]["Action"])
+		assert.Equal(t, []interface{}{"logs:CreateLogStream", "logs:DescribeLogStreams", "logs:PutLogEvents"}, bySid["ExecSessionLogs"]["Action"])
+		resources := bySid["ExecSessionLogs"]["Resource"].([]interface{})
+		require.Len(t, resources, 1)
+		assert.Regexp(t, `^arn:aws:logs:us-east-1:[0-9]{12}:log-group:/ecs/`+testProjectName+`-production/exec:\*$`, resources[0])
+
+		// The caller's key is used and no key is created
+		assert.Empty(t, resourceAddresses(plan, "aws_kms_key"))
+		logGroup := plan.ResourcePlannedValuesMap["aws_cloudwatch_log_group.exec[0]"]
+		require.NotNil(t, logGroup, "aws_cloudwatch_log_group.exec[0] is not planned")
+		assert.Equal(t, "/ecs/"+testProjectName+"-production/exec", logGroup.AttributeValues["name"])
+		assert.Equal(t, execKey, logGroup.AttributeValues["kms_key_id"])
+
+		configurations := plan.ResourcePlannedValuesMap["aws_ecs_cluster.main"].AttributeValues["configuration"].([]interface{})
+		require.Len(t, configurations, 1)
+		exec := configurations[0].(map[string]interface{})["execute_command_configuration"].([]interface{})
+		require.Len(t, exec, 1)
+		config := exec[0].(map[string]interface{})
+		assert.Equal(t, execKey, config["kms_key_id"])
+		assert.Equal(t, "OVERRIDE", config["logging"])
+		logs := config["log_configuration"].([]interface{})
+		require.Len(t, logs, 1)
+		assert.Equal(t, "/ecs/"+testProjectName+"-production/exec", logs[0].(map[string]interface{})["cloud_watch_log_group_name"])
+		assert.Equal(t, true, logs[0].(map[string]interface{})["cloud_watch_encryption_enabled"])
+
+		assert.Equal(t, true, plan.ResourcePlannedValuesMap["aws_ecs_service.blue_green[0]"].AttributeValues["enable_execute_command"])
+	})
+
+	t.Run("ExecWithModuleKey", func(t *testing.T) {
+		t.Parallel()
+
+		plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{}))
+		assert.Equal(t, true, plan.ResourcePlannedValuesMap["aws_ecs_service.main[0]"].AttributeValues["enable_execute_command"])
+		assert.Equal(t, []string{"aws_kms_key.exec[0]"}, resourceAddresses(plan, "aws_kms_key"))
+		assert.Equal(t, []string{"aws_kms_alias.exec[0]"}, resourceAddresses(plan, "aws_kms_alias"))
+		assert.Contains(t, configReferences(t, plan, "aws_cloudwatch_log_group.exec", "kms_key_id"), "local.exec_kms_key_arn")
+		require.NotNil(t, plan.ResourcePlannedValuesMap["aws_iam_role_policy.ecs_task[0]"], "task role has no exec policy")
+	})
+
+	t.Run("NoStatements", func(t *testing.T) {
+		t.Parallel()
+
+		plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{"enable_execute_command": false}))
+		assert.Nil(t, plan.ResourcePlannedValuesMap["aws_iam_role_policy.ecs_task[0]"])
+	})
+}
+
+// TestEcsModuleWAFConditions tests the WAF validations without running
+// terraform
+func TestEcsModuleWAFConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	waf := func(change func(waf map[string]interface{})) map[string]interface{} {
+		w := map[string]interface{}{
+			"rate_limits":          []map[string]interface{}{{"name": "login", "limit": 100, "path_prefix": "/user/login"}},
+			"allowed_ip_addresses": []string{"203.0.113.0/24"},
+			"logging":              map[string]interface{}{"destination": "s3", "s3_bucket_arn": "arn:aws:s3:::aws-waf-logs-gogs-fork"},
+		}
+		change(w)
+		return map[string]interface{}{"waf": w}
+	}
+	rate := func(change func(rule map[string]interface{})) func(map[string]interface{}) {
+		return func(w map[string]interface{}) {
+			rule := map[string]interface{}{"name": "login", "limit": 100}
+			change(rule)
+			w["rate_limits"] = []map[string]interface{}{rule}
+		}
+	}
+
+	failures, err := mod.CheckConditions(ecsListenerInputs(t, waf(func(map[string]interface{}) {})))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	invalid := []struct {
+		name   string
+		change func(waf map[string]interface{})
+	}{
+		{"UnknownRuleGroup", func(w map[string]interface{}) {
+			w["managed_rule_groups"] = []map[string]interface{}{{"name": "sql_injection"}}
+		}},
+		{"DuplicateRuleGroup", func(w map[string]interface{}) {
+			w["managed_rule_groups"] = []map[string]interface{}{{"name": "common"}, {"name": "common"}}
+		}},
+		{"DuplicateRateLimit", func(w map[string]interface{}) {
+			w["rate_limits"] = []map[string]interface{}{{"name": "login", "limit": 100}, {"name": "login", "limit": 200}}
+		}},
+		{"RateLimitName", rate(func(r map[string]interface{}) { r["name"] = "Login" })},
+		{"RateLimitTooLow", rate(func(r map[string]interface{}) { r["limit"] = 5 })},
+		{"EvaluationWindow", rate(func(r map[string]interface{}) { r["evaluation_window_sec"] = 30 })},
+		{"CaptchaAction", rate(func(r map[string]interface{}) { r["action"] = "captcha" })},
+		{"RelativePathPrefix", rate(func(r map[string]interface{}) { r["path_prefix"] = "user/login" })},
+		{"IPv6Address", func(w map[string]interface{}) { w["blocked_ip_addresses"] = []string{"2001:db8::/32"} }},
+		{"PlainAddress", func(w map[string]interface{}) { w["allowed_ip_addresses"] = []string{"203.0.113.7"} }},
+		{"KinesisLogging", func(w map[string]interface{}) { w["logging"] = map[string]interface{}{"destination": "firehose"} }},
+		{"S3BucketName", func(w map[string]interface{}) {
+			w["logging"] = map[string]interface{}{"destination": "s3", "s3_bucket_arn": "arn:aws:s3:::gogs-fork-waf-logs"}
+		}},
+		{"S3WithoutBucket", func(w map[string]interface{}) { w["logging"] = map[string]interface{}{"destination": "s3"} }},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, waf(tc.change)))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, "var.waf", tc.name)
+	}
+}
+
+// TestEcsModuleWAF tests the rule priorities and actions, the rate limits,
+// the managed rule groups, the logging destination and the association of the
+// web ACL with the ALB
+func TestEcsModuleWAF(t *testing.T) {
+	t.Parallel()
+
+	// wafRules returns the planned rules of the web ACL by name
+	wafRules := func(t *testing.T, plan *terraform.PlanStruct) map[string]map[string]interface{} {
+		acl := plan.ResourcePlannedValuesMap["aws_wafv2_web_acl.main[0]"]
+		require.NotNil(t, acl, "aws_wafv2_web_acl.main[0] is not planned")
+		assert.Equal(t, "REGIONAL", acl.AttributeValues["scope"])
+		assert.Contains(t, configReferences(t, plan, "aws_wafv2_web_acl_association.main", "resource_arn"), "aws_lb.main.arn")
+
+		rules := map[string]map[string]interface{}{}
+		for _, r := range acl.AttributeValues["rule"].([]interface{}) {
+			rule := r.(map[string]interface{})
+			rules[rule["name"].(string)] = rule
+		}
+		return rules
+	}
+	// first returns the only element of a nested block
+	first := func(t *testing.T, block map[string]interface{}, name string) map[string]interface{} {
+		list, _ := block[name].([]interface{})
+		require.Len(t, list, 1, name)
+		return list[0].(map[string]interface{})
+	}
+	// action returns the action of a rule
+	action := func(t *testing.T, rule map[string]interface{}) string {
+		var actions []string
+		for name, value := range first(t, rule, "action") {
+			if list, _ := value.([]interface{}); len(list) > 0 {
+				actions = append(actions, name)
+			}
+		}
+		require.Len(t, actions, 1, rule["name"])
+		return actions[0]
+	}
+
+	t.Run("CloudWatchLogs", func(t *testing.T) {
+		t.Parallel()
+
+		vars := ecsListenerInputs(t, map[string]interface{}{})
+		waf := vars["waf"].(map[string]interface{})
+		waf["allowed_ip_addresses"] = []string{"203.0.113.0/24"}
+		waf["blocked_ip_addresses"] = []string{"198.51.100.7/32"}
+		plan := planModule(t, "ecs", "staging", vars)
+
+		rules := wafRules(t, plan)
+		priorities := map[string]float64{}
+		for name, rule := range rules {
+			priorities[name] = rule["priority"].(float64)
+		}
+		assert.Equal(t, map[string]float64{
+			"blocked-ip-addresses": 0,
+			"allowed-ip-addresses": 1,
+			"rate-login":           10,
+			"rate-api":             11,
+			"aws-common":           20,
+			"aws-known-bad-inputs": 21,
+			"aws-ip-reputation":    22,
+		}, priorities)
+
+		assert.Equal(t, "allow", action(t, rules["allowed-ip-addresses"]))
+		assert.Equal(t, "block", action(t, rules["blocked-ip-addresses"]))
+		assert.Equal(t, []string{`aws_wafv2_ip_set.waf["allowed"]`, `aws_wafv2_ip_set.waf["blocked"]`}, resourceAddresses(plan, "aws_wafv2_ip_set"))
+		assert.Equal(t, []interface{}{"198.51.100.7/32"}, plan.ResourcePlannedValuesMap[`aws_wafv2_ip_set.waf["blocked"]`].AttributeValues["addresses"])
+
+		limits := map[string][2]interface{}{"rate-login": {float64(100), "/user/login"}, "rate-api": {float64(1000), "/api/"}}
+		for name, want := range limits {
+			assert.Equal(t, "block", action(t, rules[name]))
+			statement := first(t, first(t, rules[name], "statement"), "rate_based_statement")
+			assert.Equal(t, want[0], statement["limit"], name)
+			assert.Equal(t, float64(300), statement["evaluation_window_sec"], name)
+			assert.Equal(t, "IP", statement["aggregate_key_type"], name)
+			match := first(t, first(t, statement, "scope_down_statement"), "byte_match_statement")
+			assert.Equal(t, want[1], match["search_string"], name)
+			assert.Equal(t, "STARTS_WITH", match["positional_constraint"], name)
+		}
+
+		groups := map[string]string{
+			"aws-common":           "AWSManagedRulesCommonRuleSet",
+			"aws-known-bad-inputs": "AWSManagedRulesKnownBadInputsRuleSet",
+			"aws-ip-reputation":    "AWSManagedRulesAmazonIpReputationList",
+		}
+		for name, group := range groups {
+			first(t, first(t, rules[name], "override_action"), "none")
+			statement := first(t, first(t, rules[name], "statement"), "managed_rule_group_statement")
+			assert.Equal(t, "AWS", statement["vendor_name"], name)
+			assert.Equal(t, group, statement["name"], name)
+		}
+		// The common rule group only counts large bodies, so git pushes over
+		// HTTP are not blocked
+		override := first(t, first(t, first(t, rules["aws-common"], "statement"), "managed_rule_group_statement"), "rule_action_override")
+		assert.Equal(t, "SizeRestrictions_BODY", override["name"])
+		first(t, first(t, override, "action_to_use"), "count")
+
+		logGroup := plan.ResourcePlannedValuesMap["aws_cloudwatch_log_group.waf[0]"]
+		require.NotNil(t, logGroup, "aws_cloudwatch_log_group.waf[0] is not planned")
+		assert.Equal(t, "aws-waf-logs-"+testProjectName+"-staging", logGroup.AttributeValues["name"])
+		assert.Contains(t, configReferences(t, plan, "aws_wafv2_web_acl_logging_configuration.main", "log_destination_configs"), "aws_cloudwatch_log_group.waf")
+
+		logging := plan.ResourcePlannedValuesMap["aws_wafv2_web_acl_logging_configuration.main[0]"]
+		require.NotNil(t, logging, "aws_wafv2_web_acl_logging_configuration.main[0] is not planned")
+		var redacted []string
+		for _, field := range logging.AttributeValues["redacted_fields"].([]interface{}) {
+			redacted = append(redacted, first(t, field.(map[string]interface{}), "single_header")["name"].(string))
+		}
+		assert.ElementsMatch(t, []string{"authorization", "cookie"}, redacted)
+	})
+
+	t.Run("S3Logs", func(t *testing.T) {
+		t.Parallel()
+
+		const bucket = "arn:aws:s3:::aws-waf-logs-gogs-fork"
+		vars := environmentInputs(t, "production", "ecs")
+		vars["waf"] = map[string]interface{}{
+			"managed_rule_groups": []map[string]interface{}{{"name": "ip_reputation"}},
+			"rate_limits":         []map[string]interface{}{{"name": "all", "limit": 2000, "evaluation_window_sec": 60, "action": "count"}},
+			"logging":             map[string]interface{}{"destination": "s3", "s3_bucket_arn": bucket},
+		}
+		plan := planModule(t, "ecs", "production", vars)
+
+		rules := wafRules(t, plan)
+		require.Len(t, rules, 2)
+		assert.Equal(t, float64(10), rules["rate-all"]["priority"])
+		assert.Equal(t, float64(20), rules["aws-ip-reputation"]["priority"])
+		assert.Equal(t, "count", action(t, rules["rate-all"]))
+		statement := first(t, first(t, rules["rate-all"], "statement"), "rate_based_statement")
+		assert.Equal(t, float64(2000), statement["limit"])
+		assert.Equal(t, float64(60), statement["evaluation_window_sec"])
+		scopeDown, _ := statement["scope_down_statement"].([]interface{})
+		assert.Empty(t, scopeDown)
+		assert.Empty(t, resourceAddresses(plan, "aws_wafv2_ip_set"))
+
+		assert.Nil(t, plan.ResourcePlannedValuesMap["aws_cloudwatch_log_group.waf[0]"])
+		logging := plan.ResourcePlannedValuesMap["aws_wafv2_web_acl_logging_configuration.main[0]"]
+		require.NotNil(t, logging, "aws_wafv2_web_acl_logging_configuration.main[0] is not planned")
+		assert.Equal(t, []interface{}{bucket}, logging.AttributeValues["log_destination_configs"])
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{"waf": nil}))
+		assert.Empty(t, resourceAddresses(plan, "aws_wafv2_web_acl"))
+		assert.Empty(t, resourceAddresses(plan, "aws_wafv2_web_acl_association"))
+		assert.Empty(t, resourceAddresses(plan, "aws_wafv2_web_acl_logging_configuration"))
+	})
+}
+
+// TestEcsModuleAlbConditions tests the idle timeout and access log
+// validations without running terraform
+func TestEcsModuleAlbConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ecs"))
+	require.NoError(t, err)
+
+	failures, err := mod.CheckConditions(ecsListenerInputs(t, map[string]interface{}{
+		"alb_access_logs_bucket": "gogs-fork-shared-alb-logs",
+		"alb_access_logs_prefix": "gogs/staging",
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{"ZeroIdleTimeout", map[string]interface{}{"alb_idle_timeout": 0}, "var.alb_idle_timeout"},
+		{"IdleTimeoutTooLong", map[string]interface{}{"alb_idle_timeout": 4001}, "var.alb_idle_timeout"},
+		{"FractionalIdleTimeout", map[string]interface{}{"alb_idle_timeout": 60.5}, "var.alb_idle_timeout"},
+		{"BucketArn", map[string]interface{}{"alb_access_logs_bucket": "arn:aws:s3:::gogs-fork-alb-logs"}, "var.alb_access_logs_bucket"},
+		{"LeadingSlashPrefix", map[string]interface{}{"alb_access_logs_prefix": "/alb"}, "var.alb_access_logs_prefix"},
+		{"TrailingSlashPrefix", map[string]interface{}{"alb_access_logs_prefix": "alb/"}, "var.alb_access_logs_prefix"},
+		{"AWSLogsPrefix", map[string]interface{}{"alb_access_logs_prefix": "AWSLogs"}, "var.alb_access_logs_prefix"},
+		{"ZeroRetention", map[string]interface{}{"alb_access_logs_retention_in_days": 0}, "var.alb_access_logs_retention_in_days"},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(ecsListenerInputs(t, tc.vars))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// TestEcsModuleAlbAccessLogs tests the access logs of each environment, the
+// log delivery policy of the created bucket, the idle timeout and the default
+// deletion protection
+func TestEcsModuleAlbAccessLogs(t *testing.T) {
+	t.Parallel()
+
+	// Elastic Load Balancing account of us-east-1
+	const elbAccount = "arn:aws:iam::127311923021:root"
+
+	testCases := []struct {
+		environment        string
+		retention          float64
+		deletionProtection bool
+	}{
+		{"staging", 30, false},
+		{"production", 365, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.environment, func(t *testing.T) {
+			t.Parallel()
+
+			plan := planModule(t, "ecs", tc.environment, environmentInputs(t, tc.environment, "ecs"))
+			prefix := testProjectName + "-" + tc.environment
+
+			alb := plan.ResourcePlannedValuesMap["aws_lb.main"]
+			require.NotNil(t, alb, "aws_lb.main is not planned")
+			assert.Equal(t, float64(600), alb.AttributeValues["idle_timeout"])
+			assert.Equal(t, tc.deletionProtection, alb.AttributeValues["enable_deletion_protection"])
+
+			accessLogs := alb.AttributeValues["access_logs"].([]interface{})
+			require.Len(t, accessLogs, 1)
+			logs := accessLogs[0].(map[string]interface{})
+			assert.Equal(t, true, logs["enabled"])
+			assert.Equal(t, prefix, logs["prefix"])
+			bucketName, ok := logs["bucket"].(string)
+			require.True(t, ok, "access log bucket is unknown until apply")
+			assert.Regexp(t, `^`+prefix+`-alb-logs-[0-9]{12}$`, bucketName)
+
+			bucket := plan.ResourcePlannedValuesMap["aws_s3_bucket.alb_logs[0]"]
+			require.NotNil(t, bucket, "aws_s3_bucket.alb_logs[0] is not planned")
+			assert.Equal(t, bucketName, bucket.AttributeValues["bucket"])
+
+			lifecycle := plan.ResourcePlannedValuesMap["aws_s3_bucket_lifecycle_configuration.alb_logs[0]"]
+			require.NotNil(t, lifecycle, "aws_s3_bucket_lifecycle_configuration.alb_logs[0] is not planned")
+			rules := lifecycle.AttributeValues["rule"].([]interface{})
+			require.Len(t, rules, 1)
+			expiration := rules[0].(map[string]interface{})["expiration"].([]interface{})
+			require.Len(t, expiration, 1)
+			assert.Equal(t, tc.retention, expiration[0].(map[string]interface{})["days"])
+
+			policy := plan.ResourcePlannedValuesMap["aws_s3_bucket_policy.alb_logs[0]"]
+			require.NotNil(t, policy, "aws_s3_bucket_policy.alb_logs[0] is not planned")
+			var document struct {
+				Statement []struct {
+					Effect    string
+					Principal map[string]string
+					Action    string
+					Resource  string
+				}
+			}
+			require.NoError(t, json.Unmarshal([]byte(policy.AttributeValues["policy"].(string)), &document))
+			require.Len(t, document.Statement, 1)
+			statement := document.Statement[0]
+			assert.Equal(t, "Allow", statement.Effect)
+			assert.Equal(t, map[string]string{"AWS": elbAccount}, statement.Principal)
+			assert.Equal(t, "s3:PutObject", statement.Action)
+			assert.Regexp(t, `^arn:aws:s3:::`+bucketName+`/`+prefix+`/AWSLogs/[0-9]{12}/\*$`, statement.Resource)
+		})
+	}
+
+	t.Run("ExistingBucket", func(t *testing.T) {
+		t.Parallel()
+
+		vars := environmentInputs(t, "production", "ecs")
+		vars["alb_access_logs_bucket"] = "gogs-fork-shared-alb-logs"
+		vars["alb_access_logs_prefix"] = "gogs/production"
+		vars["enable_deletion_protection"] = false
+		plan := planModule(t, "ecs", "production", vars)
+
+		assert.Empty(t, resourceAddresses(plan, "aws_s3_bucket"))
+		assert.Empty(t, resourceAddresses(plan, "aws_s3_bucket_policy"))
+		alb := plan.ResourcePlannedValuesMap["aws_lb.main"]
+		assert.Equal(t, false, alb.AttributeValues["enable_deletion_protection"])
+		logs := alb.AttributeValues["access_logs"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "gogs-fork-shared-alb-logs", logs["bucket"])
+		assert.Equal(t, "gogs/production", logs["prefix"])
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		plan := planModule(t, "ecs", "staging", ecsListenerInputs(t, map[string]interface{}{
+			"enable_alb_access_logs": false,
+			"alb_idle_timeout":       60,
+		}))
+		assert.Empty(t, resourceAddresses(plan, "aws_s3_bucket"))
+		alb := plan.ResourcePlannedValuesMap["aws_lb.main"]
+		assert.Equal(t, float64(60), alb.AttributeValues["idle_timeout"])
+		accessLogs, _ := alb.AttributeValues["access_logs"].([]interface{})
+		for _, l := range accessLogs {
+			assert.Equal(t, false, l.(map[string]interface{})["enabled"])
+		}
+	})
+}
@@ -1,8 +1,12 @@
-module https://github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test
+module github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test
 
 go 1.21
 
 require (
 	github.com/gruntwork-io/terratest v0.46.7
+	github.com/hashicorp/hcl/v2 v2.16.2
+	github.com/hashicorp/terraform-json v0.13.0
 	github.com/stretchr/testify v1.8.4
+	github.com/zclconf/go-cty v1.12.1
+	golang.org/x/crypto v0.14.0
 )
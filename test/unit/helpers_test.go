@@ -0,0 +1,414 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/coverage"
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/secretgen"
+)
+
+const (
+	// repoRoot is the repository root relative to this package
+	repoRoot = "../.."
+
+	// testProjectName matches project_name in account.hcl
+	testProjectName = "gogs-fork"
+
+	// testRegion matches aws_region in environments/us-east-1/region.hcl
+	testRegion = "us-east-1"
+)
+
+// testSecrets generates the passwords, tokens and keys passed to the modules
+var testSecrets = secretgen.NewRandom()
+
+// localstackServices lists the AWS services the modules talk to. They are all
+// routed to LOCALSTACK_ENDPOINT when it is set.
+var localstackServices = []string{
+	"applicationautoscaling",
+	"cloudwatch",
+	"cloudwatchlogs",
+	"ec2",
+	"ecs",
+	"elbv2",
+	"iam",
+	"kms",
+	"rds",
+	"s3",
+	"secretsmanager",
+	"sts",
+}
+
+// defaultTags returns the provider default_tags generated by the root
+// terragrunt.hcl for an environment
+func defaultTags(environment string) map[string]string {
+	return map[string]string{
+		"Project":     testProjectName,
+		"Environment": environment,
+		"ManagedBy":   "Terraform",
+		"Repository":  "gogs-fork-infrastructure-aws",
+	}
+}
+
+// testPublicKey returns a freshly generated ed25519 public key for
+// ssh_public_key
+func testPublicKey(t *testing.T) string {
+	t.Helper()
+
+	key, err := testSecrets.ED25519PublicKey("terratest")
+	require.NoError(t, err)
+	return key
+}
+
+// providerConfig renders the provider block that the root terragrunt.hcl
+// generates. A nil tags map omits the default_tags block. When
+// LOCALSTACK_ENDPOINT is set the provider is pointed at that endpoint with
+// static test credentials.
+func providerConfig(tags map[string]string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "provider \"aws\" {\n")
+	fmt.Fprintf(&b, "  region = %q\n", testRegion)
+
+	if endpoint := os.Getenv("LOCALSTACK_ENDPOINT"); endpoint != "" {
+		b.WriteString("\n")
+		b.WriteString("  access_key                  = \"test\"\n")
+		b.WriteString("  secret_key                  = \"test\"\n")
+		b.WriteString("  skip_credentials_validation = true\n")
+		b.WriteString("  skip_metadata_api_check     = true\n")
+		b.WriteString("  skip_requesting_account_id  = true\n")
+		b.WriteString("  s3_use_path_style           = true\n\n")
+		b.WriteString("  endpoints {\n")
+		for _, service := range localstackServices {
+			fmt.Fprintf(&b, "    %s = %q\n", service, endpoint)
+		}
+		b.WriteString("  }\n")
+	}
+
+	if tags != nil {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("\n  default_tags {\n")
+		b.WriteString("    tags = {\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "      %s = %q\n", k, tags[k])
+		}
+		b.WriteString("    }\n")
+		b.WriteString("  }\n")
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// moduleOptions copies a module to a temporary folder, adds a provider
+// configuration with the given default tags and returns terraform options for it.
+func moduleOptions(t *testing.T, module string, tags map[string]string, vars map[string]interface{}) *terraform.Options {
+	t.Helper()
+
+	dir := test_structure.CopyTerraformFolderToTemp(t, repoRoot, filepath.Join("modules", module))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "provider.tf"), []byte(providerConfig(tags)), 0o644))
+
+	return terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: dir,
+		Vars:         vars,
+		PlanFilePath: filepath.Join(dir, "terraform.tfplan"),
+		NoColor:      true,
+	})
+}
+
+// applyOptions returns a copy of options without the plan file, so that apply
+// plans with the variables and show reads the state. terratest applies and
+// shows PlanFilePath when it is set.
+func applyOptions(t *testing.T, options *terraform.Options) *terraform.Options {
+	t.Helper()
+
+	apply, err := options.Clone()
+	require.NoError(t, err)
+	apply.PlanFilePath = ""
+	return apply
+}
+
+// planModule runs init, plan and show for a module with the provider
+// configuration of the given environment and returns the parsed plan
+func planModule(t *testing.T, module, environment string, vars map[string]interface{}) *terraform.PlanStruct {
+	t.Helper()
+
+	return terraformPlan(t, moduleOptions(t, module, defaultTags(environment), vars))
+}
+
+// terraformPlan runs init, plan and show with the given options and returns
+// the parsed plan. When MODULE_COVERAGE_DIR is set the variables and planned
+// instances are recorded for cmd/coverage.
+func terraformPlan(t *testing.T, options *terraform.Options) *terraform.PlanStruct {
+	t.Helper()
+
+	plan := terraform.InitAndPlanAndShowWithStruct(t, options)
+
+	if dir := os.Getenv(coverage.EnvDir); dir != "" {
+		require.NoError(t, coverage.WriteRecord(dir, coverage.Record{
+			Test:      t.Name(),
+			Module:    filepath.Base(options.TerraformDir),
+			Vars:      options.Vars,
+			Instances: coverage.Instances(&plan.RawPlan),
+		}))
+	}
+
+	return plan
+}
+
+// skipWithoutTerraform skips a test that cross-checks tfmodule against
+// terraform when neither terraform nor tofu, which terratest falls back to,
+// is installed
+func skipWithoutTerraform(t *testing.T) {
+	t.Helper()
+
+	for _, binary := range []string{"terraform", "tofu"} {
+		if _, err := exec.LookPath(binary); err == nil {
+			return
+		}
+	}
+	t.Skip("terraform is not installed")
+}
+
+// terraformRejects plans an initialised module with vars and reports whether
+// terraform rejected them with a variable validation or a precondition. Any
+// other plan error fails the test.
+func terraformRejects(t *testing.T, options *terraform.Options, vars map[string]interface{}) bool {
+	t.Helper()
+
+	plan, err := options.Clone()
+	require.NoError(t, err)
+	plan.Vars = vars
+	plan.PlanFilePath = ""
+
+	out, err := terraform.PlanE(t, plan)
+	if err == nil {
+		return false
+	}
+	require.Regexp(t, `Invalid value for variable|Resource precondition failed`, out)
+	return true
+}
+
+// resourceAddresses returns the sorted addresses of all planned resources
+// with the given type
+func resourceAddresses(plan *terraform.PlanStruct, resourceType string) []string {
+	var addresses []string
+	for address, resource := range plan.ResourcePlannedValuesMap {
+		if resource.Type == resourceType {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// environmentInputs returns the module variables set by the root terragrunt.hcl
+// and environments/us-east-1/<environment>/<module>/terragrunt.hcl, with
+// dependency outputs replaced by the mock_outputs declared there.
+// TestEnvironmentInputsMatchTerragrunt checks it against those files.
+func environmentInputs(t *testing.T, environment, module string) map[string]interface{} {
+	t.Helper()
+
+	production := environment == "production"
+	pick := func(staging, prod interface{}) interface{} {
+		if production {
+			return prod
+		}
+		return staging
+	}
+
+	vars := map[string]interface{}{
+		"project_name": testProjectName,
+		"environment":  environment,
+		"tags": map[string]string{
+			"Environment": environment,
+			"Project":     testProjectName,
+			"ManagedBy":   "Terraform",
+		},
+	}
+
+	var inputs map[string]interface{}
+	switch module {
+	case "vpc":
+		inputs = map[string]interface{}{
+			"vpc_cidr":             pick("10.0.0.0/16", "10.1.0.0/16"),
+			"public_subnet_cidrs":  pick([]string{"10.0.1.0/24", "10.0.2.0/24"}, []string{"10.1.1.0/24", "10.1.2.0/24"}),
+			"private_subnet_cidrs": pick([]string{"10.0.10.0/24", "10.0.11.0/24"}, []string{"10.1.10.0/24", "10.1.11.0/24"}),
+			"availability_zones":   []string{"us-east-1a", "us-east-1b"},
+			"nat_gateway_mode":     pick("single", "per_az"),
+			"gateway_endpoints":    []string{"s3"},
+
+			"flow_log_destination_type":  pick("cloud-watch-logs", "s3"),
+			"flow_log_retention_in_days": pick(7, 365),
+		}
+		if production {
+			inputs["interface_endpoints"] = []string{"secretsmanager", "ecr.api", "ecr.dkr", "logs", "kms"}
+			inputs["flow_log_file_format"] = "parquet"
+			inputs["flow_log_hive_compatible_partitions"] = true
+		}
+	case "ecs":
+		inputs = map[string]interface{}{
+			"aws_region":         testRegion,
+			"vpc_id":             "vpc-mock12345",
+			"public_subnet_ids":  []string{"subnet-mock1", "subnet-mock2"},
+			"private_subnet_ids": []string{"subnet-mock3", "subnet-mock4"},
+			"docker_image":       "nginx:latest",
+			"container_name":     "gogs-app",
+			"container_port":     8080,
+			"task_cpu":           pick(256, 512),
+			"task_memory":        pick(512, 1024),
+			"desired_count":      pick(1, 2),
+			"health_check_path":  "/health",
+			"environment_variables": []map[string]string{
+				{"name": "ENVIRONMENT", "value": environment},
+				{"name": "DB_HOST", "value": "mock-db.example.com"},
+				{"name": "DB_PORT", "value": "5432"},
+				{"name": "DB_NAME", "value": "gogsapp"},
+			},
+			"secrets": []map[string]string{
+				{"name": "DB_USERNAME", "valueFrom": "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-db:username::"},
+				{"name": "DB_PASSWORD", "valueFrom": "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-db:password::"},
+			},
+			"secrets_manager_arns":      []string{"arn:aws:secretsmanager:us-east-1:123456789:secret:mock"},
+			"enable_container_insights": true,
+			"log_retention_days":        pick(14, 90),
+			"enable_autoscaling":        true,
+			"min_capacity":              pick(1, 2),
+			"max_capacity":              pick(2, 10),
+			"cpu_target_value":          70,
+			"scaling_policies": pick(
+				[]map[string]interface{}{
+					{"name": "cpu", "type": "cpu"},
+					{"name": "requests", "type": "requests", "target_value": 500},
+				},
+				[]map[string]interface{}{
+					{"name": "cpu", "type": "cpu"},
+					{"name": "memory", "type": "memory", "target_value": 75},
+					{"name": "requests", "type": "requests", "target_value": 1000},
+				},
+			),
+			"wait_for_steady_state": true,
+			"log_driver":            "splunk",
+			"splunk_log_routing": map[string]interface{}{
+				"hec_endpoint":         "https://10.0.1.10:8088",
+				"hec_token_secret_arn": "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-splunk",
+			},
+			"task_security_group_ids": []string{"sg-mockhec"},
+			"efs_storage": map[string]interface{}{
+				"container_path": "/data",
+				"root_directory": "/gogs",
+				"posix_user":     map[string]interface{}{"uid": 1000, "gid": 1000},
+			},
+			"alb_idle_timeout":                  600,
+			"enable_alb_access_logs":            true,
+			"alb_access_logs_retention_in_days": pick(30, 365),
+			"waf": map[string]interface{}{
+				"rate_limits": []map[string]interface{}{
+					{"name": "login", "limit": 100, "path_prefix": "/user/login"},
+					{"name": "api", "limit": 1000, "path_prefix": "/api/"},
+				},
+				"logging": map[string]interface{}{"destination": "cloudwatch"},
+			},
+		}
+		if production {
+			inputs["deployment_minimum_healthy_percent"] = 100
+			inputs["deployment_5xx_alarm_threshold"] = 10
+			inputs["enable_blue_green"] = true
+			inputs["blue_green_termination_wait_minutes"] = 60
+			inputs["blue_green_test_listener_cidr_blocks"] = []string{"10.1.0.0/16"}
+			inputs["efs_storage"].(map[string]interface{})["transition_to_ia"] = "AFTER_30_DAYS"
+		} else {
+			inputs["enable_execute_command"] = true
+			inputs["scaling_windows"] = []map[string]interface{}{
+				{"name": "off-hours", "start": "cron(0 20 ? * MON-FRI *)", "end": "cron(0 7 ? * MON-FRI *)", "timezone": "UTC", "min_capacity": 0, "max_capacity": 0},
+			}
+		}
+	case "rds":
+		inputs = map[string]interface{}{
+			"vpc_id":                       "vpc-mock12345",
+			"private_subnet_ids":           []string{"subnet-mock1", "subnet-mock2"},
+			"allowed_security_groups":      []string{},
+			"engine":                       "postgres",
+			"engine_version":               "15.4",
+			"instance_class":               pick("db.t3.micro", "db.t3.medium"),
+			"db_name":                      "gogsapp",
+			"username":                     "admin",
+			"password":                     testSecrets.RDSPassword(),
+			"allocated_storage":            pick(20, 50),
+			"max_allocated_storage":        pick(50, 200),
+			"storage_type":                 "gp3",
+			"multi_az":                     production,
+			"backup_retention_period":      pick(7, 30),
+			"deletion_protection":          production,
+			"skip_final_snapshot":          !production,
+			"performance_insights_enabled": true,
+			"monitoring_interval":          60,
+			"auto_minor_version_upgrade":   true,
+		}
+		if production {
+			inputs["backup_window"] = "03:00-04:00"
+			inputs["maintenance_window"] = "Mon:04:00-Mon:05:00"
+		} else {
+			inputs["scheduled_stop"] = map[string]interface{}{
+				"stop":     "cron(0 20 ? * MON-FRI *)",
+				"start":    "cron(30 6 ? * MON-FRI *)",
+				"timezone": "UTC",
+			}
+		}
+	case "secrets-manager":
+		inputs = map[string]interface{}{
+			"db_username": "validation_user",
+			"db_password": testSecrets.RDSPassword(),
+			"db_host":     "mock-db.example.com",
+			"db_port":     5432,
+			"db_name":     "gogsapp",
+			"application_secrets": map[string]string{
+				"APP_SECRET_KEY": "validation_secret_CHANGE_IN_PRODUCTION",
+			},
+			"create_splunk_secret":    true,
+			"splunk_admin_password":   testSecrets.SplunkPassword(),
+			"splunk_hec_token":        testSecrets.HECToken(),
+			"create_dockerhub_secret": false,
+			"create_kms_key":          true,
+			"recovery_window_in_days": pick(7, 30),
+		}
+	case "ec2-splunk":
+		inputs = map[string]interface{}{
+			"vpc_id":               "vpc-mock12345",
+			"subnet_id":            "subnet-mock1",
+			"availability_zone":    "us-east-1a",
+			"instance_type":        pick("t3.medium", "t3.large"),
+			"ami_id":               "ami-0c7217cdde317cfec",
+			"root_volume_size":     pick(30, 50),
+			"data_volume_size":     pick(50, 200),
+			"data_volume_type":     "gp3",
+			"allowed_cidr_blocks":  []string{pick("0.0.0.0/0", "10.0.0.0/8").(string)},
+			"enable_ssh":           true,
+			"ssh_cidr_blocks":      []string{},
+			"secrets_manager_arns": []string{"arn:aws:secretsmanager:us-east-1:123456789:secret:mock"},
+			"create_elastic_ip":    true,
+		}
+	default:
+		t.Fatalf("unknown module %q", module)
+	}
+
+	for k, v := range inputs {
+		vars[k] = v
+	}
+	return vars
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/drift"
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// volatileFunctions return a different value on every plan
+var volatileFunctions = []string{"timestamp", "uuid"}
+
+// TestIdempotencyVolatileArguments fails when a resource argument calls a
+// volatile function and the argument is not covered by ignore_changes
+func TestIdempotencyVolatileArguments(t *testing.T) {
+	t.Parallel()
+
+	for _, module := range environmentModules {
+		mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", module))
+		require.NoError(t, err)
+
+		for _, call := range mod.FunctionCalls(volatileFunctions...) {
+			resource, _ := mod.Resource(call.Resource)
+			if resource.Ignores(call.Argument) {
+				continue
+			}
+
+			via := ""
+			if call.Local != "" {
+				via = " through local." + call.Local
+			}
+			t.Errorf("%s: %s argument %q calls %s()%s and changes on every plan; add it to lifecycle ignore_changes (%s)",
+				module, call.Resource, call.Argument, call.Function, via, call.Range)
+		}
+	}
+}
+
+// TestIdempotencySecondPlan applies every module with the staging inputs
+// against LocalStack and fails when a second plan is not empty. Modules are
+// applied in dependency order and destroyed in reverse order at the end.
+func TestIdempotencySecondPlan(t *testing.T) {
+	if os.Getenv("LOCALSTACK_ENDPOINT") == "" {
+		t.Skip("LOCALSTACK_ENDPOINT is not set")
+	}
+
+	const environment = "staging"
+	parent := t
+	outputs := map[string]map[string]interface{}{}
+
+	for _, module := range environmentModules {
+		module := module
+		t.Run(module, func(t *testing.T) {
+			vars := environmentInputs(t, environment, module)
+			for k, v := range dependencyInputs(module, outputs) {
+				vars[k] = v
+			}
+
+			options := moduleOptions(t, module, defaultTags(environment), vars)
+			apply := applyOptions(t, options)
+			parent.Cleanup(func() { terraform.Destroy(parent, apply) })
+
+			terraform.InitAndApply(t, apply)
+			outputs[module] = terraform.OutputAll(t, apply)
+
+			changes, err := drift.ParseChanges([]byte(terraform.InitAndPlanAndShow(t, options)))
+			require.NoError(t, err)
+			if len(changes) > 0 {
+				t.Errorf("second plan of %s is not empty, these attributes change on every plan:\n%s", module, describeChanges(changes))
+			}
+		})
+	}
+}
+
+// dependencyInputs replaces the mock dependency outputs of a module with the
+// outputs of the modules applied before it
+func dependencyInputs(module string, outputs map[string]map[string]interface{}) map[string]interface{} {
+	vpc, ok := outputs["vpc"]
+	if !ok {
+		return nil
+	}
+
+	switch module {
+	case "rds":
+		return map[string]interface{}{
+			"vpc_id":             vpc["vpc_id"],
+			"private_subnet_ids": vpc["private_subnet_ids"],
+		}
+	case "ecs":
+		// LocalStack tasks never reach a steady state behind the load
+		// balancer
+		inputs := map[string]interface{}{
+			"vpc_id":                vpc["vpc_id"],
+			"public_subnet_ids":     vpc["public_subnet_ids"],
+			"private_subnet_ids":    vpc["private_subnet_ids"],
+			"wait_for_steady_state": false,
+		}
+		if splunk, ok := outputs["ec2-splunk"]; ok {
+			routing := map[string]interface{}{
+				"hec_endpoint":         splunk["splunk_hec_private_endpoint"],
+				"hec_token_secret_arn": "arn:aws:secretsmanager:us-east-1:123456789:secret:mock-splunk",
+			}
+			if secrets, ok := outputs["secrets-manager"]; ok && secrets["splunk_secret_arn"] != nil {
+				routing["hec_token_secret_arn"] = secrets["splunk_secret_arn"]
+			}
+			inputs["splunk_log_routing"] = routing
+			inputs["task_security_group_ids"] = []interface{}{splunk["hec_client_security_group_id"]}
+		}
+		return inputs
+	case "ec2-splunk":
+		inputs := map[string]interface{}{"vpc_id": vpc["vpc_id"]}
+		if subnets, ok := vpc["private_subnet_ids"].([]interface{}); ok && len(subnets) > 0 {
+			inputs["subnet_id"] = subnets[0]
+		}
+		return inputs
+	default:
+		return nil
+	}
+}
+
+// describeChanges lists the changed attributes of each resource
+func describeChanges(changes []drift.ResourceDrift) string {
+	var b strings.Builder
+	for _, change := range changes {
+		fmt.Fprintf(&b, "  %s (%s)\n", change.Address, strings.Join(change.Actions, ", "))
+		for _, attr := range change.Attributes {
+			fmt.Fprintf(&b, "    %s: %v -> %v\n", attr.Path, attr.Before, attr.After)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/kmspolicy"
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// TestKmsKeyPolicyCreatedKey tests that the key created by the
+// secrets-manager module only grants key usage with the expected conditions
+func TestKmsKeyPolicyCreatedKey(t *testing.T) {
+	t.Parallel()
+
+	for _, environment := range []string{"staging", "production"} {
+		environment := environment
+		t.Run(environment, func(t *testing.T) {
+			t.Parallel()
+
+			vars := environmentInputs(t, environment, "secrets-manager")
+			vars["create_kms_key"] = true
+
+			plan := planModule(t, "secrets-manager", environment, vars)
+			keys, err := kmspolicy.Keys(&plan.RawPlan)
+			require.NoError(t, err)
+			require.Len(t, keys, 1)
+			require.True(t, keys[0].Known, "key policy is unknown until apply")
+
+			grants := kmspolicy.Grants(keys)
+			assert.Empty(t, kmspolicy.Findings(grants), "key policy grants without conditions:\n%s", kmspolicy.Report(kmspolicy.Findings(grants)))
+
+			principals := map[string]kmspolicy.Grant{}
+			for _, g := range grants {
+				principals[g.Principal] = g
+			}
+			require.Contains(t, principals, "Service:ecs-tasks.amazonaws.com")
+			ecs := principals["Service:ecs-tasks.amazonaws.com"]
+			assert.ElementsMatch(t, []string{"kms:Decrypt", "kms:GenerateDataKey"}, ecs.Actions)
+			assert.ElementsMatch(t, []string{kmspolicy.SourceAccount, kmspolicy.ViaService}, ecs.Conditions)
+
+			// Only the account root and ECS are granted access
+			assert.Len(t, principals, 2, kmspolicy.Report(grants))
+		})
+	}
+}
+
+// TestKmsKeyPolicyEcsExecKey tests that the ECS Exec key created by the ecs
+// module only lets CloudWatch Logs use it for the exec log group
+func TestKmsKeyPolicyEcsExecKey(t *testing.T) {
+	t.Parallel()
+
+	plan := planModule(t, "ecs", "staging", environmentInputs(t, "staging", "ecs"))
+	keys, err := kmspolicy.Keys(&plan.RawPlan)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "aws_kms_key.exec[0]", keys[0].Address)
+	require.True(t, keys[0].Known, "key policy is unknown until apply")
+
+	grants := kmspolicy.Grants(keys)
+	assert.Empty(t, kmspolicy.Findings(grants), "key policy grants without conditions:\n%s", kmspolicy.Report(kmspolicy.Findings(grants)))
+
+	principals := map[string]kmspolicy.Grant{}
+	for _, g := range grants {
+		principals[g.Principal] = g
+	}
+	require.Contains(t, principals, "Service:logs.us-east-1.amazonaws.com")
+	assert.Equal(t, []string{kmspolicy.EncryptionContext + "aws:logs:arn"}, principals["Service:logs.us-east-1.amazonaws.com"].Conditions)
+	assert.Len(t, principals, 2, kmspolicy.Report(grants))
+
+	var policy struct {
+		Statement []struct {
+			Condition map[string]map[string]string
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(plan.ResourcePlannedValuesMap["aws_kms_key.exec[0]"].AttributeValues["policy"].(string)), &policy))
+	require.Len(t, policy.Statement, 2)
+	assert.Regexp(t, `^arn:aws:logs:us-east-1:[0-9]{12}:log-group:/ecs/`+testProjectName+`-staging/exec$`, policy.Statement[1].Condition["ArnEquals"]["kms:EncryptionContext:aws:logs:arn"])
+}
+
+// TestKmsKeyPolicyCallerSuppliedKey tests that no key is created and every
+// secret uses the caller's key when create_kms_key is false
+func TestKmsKeyPolicyCallerSuppliedKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		kmsKeyID interface{}
+	}{
+		{"KeyArn", "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"},
+		{"AliasName", "alias/gogs-fork-shared-secrets"},
+		{"AliasArn", "arn:aws:kms:us-east-1:123456789012:alias/gogs-fork-shared-secrets"},
+		{"AwsManagedKey", nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			vars := environmentInputs(t, "staging", "secrets-manager")
+			vars["create_kms_key"] = false
+			vars["kms_key_id"] = tc.kmsKeyID
+
+			plan := planModule(t, "secrets-manager", "staging", vars)
+			keys, err := kmspolicy.Keys(&plan.RawPlan)
+			require.NoError(t, err)
+			assert.Empty(t, keys, "no KMS key should be created")
+			assert.Empty(t, resourceAddresses(plan, "aws_kms_alias"))
+
+			secrets := resourceAddresses(plan, "aws_secretsmanager_secret")
+			require.NotEmpty(t, secrets)
+			for _, address := range secrets {
+				assert.Equal(t, tc.kmsKeyID, plan.ResourcePlannedValuesMap[address].AttributeValues["kms_key_id"], address)
+			}
+		})
+	}
+}
+
+// TestKmsKeyIdValidation tests the kms_key_id formats accepted by the
+// secrets-manager module
+func TestKmsKeyIdValidation(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "secrets-manager"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		kmsKeyID interface{}
+		valid    bool
+	}{
+		{nil, true},
+		{"1234abcd-12ab-34cd-56ef-1234567890ab", true},
+		{"mrk-1234abcd12ab34cd56ef1234567890ab", true},
+		{"alias/gogs-fork/secrets", true},
+		{"arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab", true},
+		{"arn:aws-us-gov:kms:us-gov-west-1:123456789012:alias/secrets", true},
+		{"", false},
+		{"gogs-fork-secrets", false},
+		{"arn:aws:kms:us-east-1:123456789012:key/not-a-key", false},
+		{"arn:aws:iam::123456789012:role/secrets", false},
+	}
+
+	for _, tc := range testCases {
+		vars := environmentInputs(t, "staging", "secrets-manager")
+		vars["create_kms_key"] = false
+		vars["kms_key_id"] = tc.kmsKeyID
+
+		failures, err := mod.CheckConditions(vars)
+		require.NoError(t, err)
+		if tc.valid {
+			assert.Empty(t, failures, "%v", tc.kmsKeyID)
+		} else {
+			require.Len(t, failures, 1, "%v", tc.kmsKeyID)
+			assert.Equal(t, "var.kms_key_id", failures[0].Subject)
+		}
+	}
+}
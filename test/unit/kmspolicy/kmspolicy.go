@@ -0,0 +1,413 @@
+// Package kmspolicy analyzes the key policies of planned KMS keys.
+//
+// Each Allow statement is expanded into one grant per principal. A grant
+// lists the actions and condition keys of its statement and the condition
+// keys it should carry but does not:
+//
+//   - service principals need aws:SourceAccount or aws:SourceArn, so that
+//     the service cannot be used as a confused deputy by another account;
+//   - principals other than the key's account root that may use the key for
+//     cryptographic operations need kms:ViaService, so that the key is only
+//     usable through the AWS service it was created for;
+//   - the anonymous principal "*" needs kms:CallerAccount.
+//
+// The account root is exempt: its kms:* grant only delegates access to IAM
+// policies in that account, as in the default key policy. So are service
+// principals whose statement binds a kms:EncryptionContext: key, such as
+// CloudWatch Logs encrypting one log group: the service calls KMS itself, so
+// kms:ViaService is never set, and the context names the resource it may use
+// the key for.
+package kmspolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Condition keys reported as missing.
+const (
+	SourceAccount = "aws:SourceAccount"
+	SourceArn     = "aws:SourceArn"
+	ViaService    = "kms:ViaService"
+	CallerAccount = "kms:CallerAccount"
+
+	// EncryptionContext is the prefix of the encryption context condition
+	// keys.
+	EncryptionContext = "kms:EncryptionContext:"
+)
+
+// cryptoActions are the key usage actions that require kms:ViaService.
+var cryptoActions = []string{
+	"kms:Decrypt",
+	"kms:Encrypt",
+	"kms:GenerateDataKey",
+	"kms:GenerateDataKeyPair",
+	"kms:GenerateDataKeyPairWithoutPlaintext",
+	"kms:GenerateDataKeyWithoutPlaintext",
+	"kms:ReEncryptFrom",
+	"kms:ReEncryptTo",
+}
+
+var accountRoot = regexp.MustCompile(`^(arn:aws[a-z-]*:iam::[0-9]{12}:root|[0-9]{12})$`)
+
+// Policy is a parsed key policy document.
+type Policy struct {
+	Version    string
+	Statements []Statement
+}
+
+// Statement is a key policy statement. Single values and lists are both
+// decoded to slices.
+type Statement struct {
+	Sid    string
+	Effect string
+
+	// Principals maps the principal type ("AWS", "Service", "Federated")
+	// to its values. A policy principal of "*" is stored as {"*": ["*"]}.
+	Principals map[string][]string
+
+	Actions   []string
+	Resources []string
+
+	// Conditions maps each operator to its condition keys and values.
+	Conditions map[string]map[string][]string
+}
+
+// Parse decodes a key policy document.
+func Parse(data []byte) (Policy, error) {
+	var doc struct {
+		Version   string
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Policy{}, fmt.Errorf("parsing key policy: %w", err)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(doc.Statement, &raw); err != nil {
+		// A policy may hold a single statement object
+		raw = []json.RawMessage{doc.Statement}
+	}
+
+	policy := Policy{Version: doc.Version}
+	for i, r := range raw {
+		s, err := parseStatement(r)
+		if err != nil {
+			return Policy{}, fmt.Errorf("parsing key policy statement %d: %w", i, err)
+		}
+		policy.Statements = append(policy.Statements, s)
+	}
+	return policy, nil
+}
+
+func parseStatement(data json.RawMessage) (Statement, error) {
+	var raw struct {
+		Sid       string
+		Effect    string
+		Principal json.RawMessage
+		Action    json.RawMessage
+		Resource  json.RawMessage
+		Condition map[string]map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Statement{}, err
+	}
+
+	s := Statement{Sid: raw.Sid, Effect: raw.Effect, Principals: map[string][]string{}}
+
+	var wildcard string
+	if err := json.Unmarshal(raw.Principal, &wildcard); err == nil {
+		s.Principals[wildcard] = []string{wildcard}
+	} else if len(raw.Principal) > 0 {
+		var principals map[string]json.RawMessage
+		if err := json.Unmarshal(raw.Principal, &principals); err != nil {
+			return Statement{}, fmt.Errorf("principal: %w", err)
+		}
+		for kind, values := range principals {
+			list, err := stringList(values)
+			if err != nil {
+				return Statement{}, fmt.Errorf("principal %s: %w", kind, err)
+			}
+			s.Principals[kind] = list
+		}
+	}
+
+	var err error
+	if s.Actions, err = stringList(raw.Action); err != nil {
+		return Statement{}, fmt.Errorf("action: %w", err)
+	}
+	if s.Resources, err = stringList(raw.Resource); err != nil {
+		return Statement{}, fmt.Errorf("resource: %w", err)
+	}
+
+	for operator, keys := range raw.Condition {
+		for key, values := range keys {
+			list, err := stringList(values)
+			if err != nil {
+				return Statement{}, fmt.Errorf("condition %s %s: %w", operator, key, err)
+			}
+			if s.Conditions == nil {
+				s.Conditions = map[string]map[string][]string{}
+			}
+			if s.Conditions[operator] == nil {
+				s.Conditions[operator] = map[string][]string{}
+			}
+			s.Conditions[operator][key] = list
+		}
+	}
+
+	return s, nil
+}
+
+// stringList decodes a JSON string, number, bool or list of them.
+func stringList(data json.RawMessage) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		values = []interface{}{value}
+	}
+
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			list = append(list, v)
+		case float64, bool:
+			list = append(list, fmt.Sprint(v))
+		default:
+			return nil, fmt.Errorf("unexpected value %v", v)
+		}
+	}
+	return list, nil
+}
+
+// ConditionKeys returns the sorted condition keys of the statement.
+func (s Statement) ConditionKeys() []string {
+	var keys []string
+	for _, byKey := range s.Conditions {
+		for key := range byKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// HasCondition reports whether the statement has a condition on key, under
+// any operator. Condition keys are case-insensitive.
+func (s Statement) HasCondition(key string) bool {
+	for _, byKey := range s.Conditions {
+		for k := range byKey {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasEncryptionContext reports whether the statement has a condition on an
+// encryption context key.
+func (s Statement) hasEncryptionContext() bool {
+	for _, key := range s.ConditionKeys() {
+		if len(key) > len(EncryptionContext) && strings.EqualFold(key[:len(EncryptionContext)], EncryptionContext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the statement's actions cover action.
+func (s Statement) Allows(action string) bool {
+	for _, pattern := range s.Actions {
+		if matchAction(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAction matches an IAM action pattern, which may contain "*" and "?",
+// against action. Actions are case-insensitive.
+func matchAction(pattern, action string) bool {
+	expr := regexp.QuoteMeta(strings.ToLower(pattern))
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.MustCompile("^" + expr + "$").MatchString(strings.ToLower(action))
+}
+
+// Grant is an Allow statement as seen by one of its principals.
+type Grant struct {
+	Address string `json:"address,omitempty"`
+	Sid     string `json:"sid,omitempty"`
+
+	// Principal is "<type>:<value>", e.g. "Service:ecs-tasks.amazonaws.com".
+	Principal string `json:"principal"`
+
+	Actions    []string `json:"actions"`
+	Conditions []string `json:"conditions,omitempty"`
+
+	// Missing lists the condition keys the grant should carry but does not.
+	// Alternatives are joined with " or ".
+	Missing []string `json:"missing,omitempty"`
+}
+
+func (g Grant) String() string {
+	var b strings.Builder
+	if g.Address != "" {
+		fmt.Fprintf(&b, "%s: ", g.Address)
+	}
+	if g.Sid != "" {
+		fmt.Fprintf(&b, "statement %q ", g.Sid)
+	}
+	fmt.Fprintf(&b, "allows %s to %s", g.Principal, strings.Join(g.Actions, ", "))
+	if len(g.Missing) > 0 {
+		fmt.Fprintf(&b, " without %s", strings.Join(g.Missing, ", "))
+	}
+	return b.String()
+}
+
+// Analyze returns the grants of every Allow statement in policy, in statement
+// order and sorted by principal within a statement.
+func Analyze(policy Policy) []Grant {
+	var grants []Grant
+	for _, s := range policy.Statements {
+		if !strings.EqualFold(s.Effect, "Allow") {
+			continue
+		}
+
+		kinds := make([]string, 0, len(s.Principals))
+		for kind := range s.Principals {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+
+		for _, kind := range kinds {
+			values := append([]string(nil), s.Principals[kind]...)
+			sort.Strings(values)
+			for _, value := range values {
+				grants = append(grants, Grant{
+					Sid:        s.Sid,
+					Principal:  kind + ":" + value,
+					Actions:    s.Actions,
+					Conditions: s.ConditionKeys(),
+					Missing:    missing(s, kind, value),
+				})
+			}
+		}
+	}
+	return grants
+}
+
+// missing returns the condition keys a grant of s to the principal lacks.
+func missing(s Statement, kind, value string) []string {
+	if kind == "AWS" && accountRoot.MatchString(value) {
+		return nil
+	}
+	if kind == "Service" && s.hasEncryptionContext() {
+		return nil
+	}
+
+	var keys []string
+	if kind == "Service" && !s.HasCondition(SourceAccount) && !s.HasCondition(SourceArn) {
+		keys = append(keys, SourceAccount+" or "+SourceArn)
+	}
+	if value == "*" && !s.HasCondition(CallerAccount) {
+		keys = append(keys, CallerAccount)
+	}
+	if !s.HasCondition(ViaService) {
+		for _, action := range cryptoActions {
+			if s.Allows(action) {
+				keys = append(keys, ViaService)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// Key is a KMS key planned for creation or update.
+type Key struct {
+	Address string
+
+	// Known is false when the policy is only known after apply.
+	Known  bool
+	Policy Policy
+}
+
+// Keys returns the aws_kms_key resources created or updated by plan, sorted
+// by address.
+func Keys(plan *tfjson.Plan) ([]Key, error) {
+	var keys []Key
+	if plan == nil {
+		return keys, nil
+	}
+
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Type != "aws_kms_key" || rc.Change == nil || rc.Change.Actions.Delete() {
+			continue
+		}
+
+		key := Key{Address: rc.Address}
+		after, _ := rc.Change.After.(map[string]interface{})
+		if document, ok := after["policy"].(string); ok && document != "" {
+			policy, err := Parse([]byte(document))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rc.Address, err)
+			}
+			key.Known, key.Policy = true, policy
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Address < keys[j].Address })
+	return keys, nil
+}
+
+// Grants analyzes the policy of every key with a known policy and returns the
+// grants with their key address set.
+func Grants(keys []Key) []Grant {
+	var grants []Grant
+	for _, key := range keys {
+		if !key.Known {
+			continue
+		}
+		for _, g := range Analyze(key.Policy) {
+			g.Address = key.Address
+			grants = append(grants, g)
+		}
+	}
+	return grants
+}
+
+// Findings returns the grants with missing condition keys.
+func Findings(grants []Grant) []Grant {
+	var findings []Grant
+	for _, g := range grants {
+		if len(g.Missing) > 0 {
+			findings = append(findings, g)
+		}
+	}
+	return findings
+}
+
+// Report renders the grants one per line, or "" if there are none.
+func Report(grants []Grant) string {
+	lines := make([]string, 0, len(grants))
+	for _, g := range grants {
+		lines = append(lines, g.String())
+	}
+	return strings.Join(lines, "\n")
+}
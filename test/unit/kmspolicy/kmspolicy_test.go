@@ -0,0 +1,133 @@
+package kmspolicy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKeysFixture tests key policy extraction and analysis of a recorded plan
+func TestKeysFixture(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "secrets-kms-plan.json"))
+	require.NoError(t, err)
+
+	var plan tfjson.Plan
+	require.NoError(t, json.Unmarshal(data, &plan))
+
+	keys, err := Keys(&plan)
+	require.NoError(t, err)
+
+	// Deleted keys and other resource types are skipped
+	require.Len(t, keys, 2)
+	assert.Equal(t, "aws_kms_key.pending", keys[0].Address)
+	assert.False(t, keys[0].Known)
+	assert.Equal(t, "aws_kms_key.secrets[0]", keys[1].Address)
+	assert.True(t, keys[1].Known)
+
+	grants := Grants(keys)
+	assert.Equal(t, []Grant{
+		{
+			Address:   "aws_kms_key.secrets[0]",
+			Sid:       "Enable IAM User Permissions",
+			Principal: "AWS:arn:aws:iam::123456789012:root",
+			Actions:   []string{"kms:*"},
+		},
+		{
+			Address:   "aws_kms_key.secrets[0]",
+			Sid:       "Allow ECS to use the key",
+			Principal: "Service:ecs-tasks.amazonaws.com",
+			Actions:   []string{"kms:Decrypt", "kms:GenerateDataKey"},
+			Missing:   []string{"aws:SourceAccount or aws:SourceArn", "kms:ViaService"},
+		},
+	}, grants)
+
+	findings := Findings(grants)
+	require.Len(t, findings, 1)
+	assert.Equal(t,
+		`aws_kms_key.secrets[0]: statement "Allow ECS to use the key" allows Service:ecs-tasks.amazonaws.com to kms:Decrypt, kms:GenerateDataKey without aws:SourceAccount or aws:SourceArn, kms:ViaService`,
+		Report(findings))
+}
+
+// TestAnalyzeConditions tests which condition keys satisfy each principal type
+func TestAnalyzeConditions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		policy  string
+		missing [][]string
+	}{
+		{
+			name: "ServiceWithConditions",
+			policy: `{"Statement": [{"Effect": "Allow", "Principal": {"Service": "ecs-tasks.amazonaws.com"},
+				"Action": ["kms:Decrypt"], "Resource": "*",
+				"Condition": {"StringEquals": {"kms:viaservice": "secretsmanager.us-east-1.amazonaws.com"},
+					"ArnLike": {"aws:SourceArn": "arn:aws:ecs:us-east-1:123456789012:*"}}}]}`,
+			missing: [][]string{nil},
+		},
+		{
+			name: "ServiceBoundToEncryptionContext",
+			policy: `{"Statement": [{"Effect": "Allow", "Principal": {"Service": ["logs.us-east-1.amazonaws.com", "ecs-tasks.amazonaws.com"]},
+				"Action": ["kms:Encrypt*", "kms:Decrypt*", "kms:GenerateDataKey*"], "Resource": "*",
+				"Condition": {"ArnEquals": {"kms:EncryptionContext:aws:logs:arn": "arn:aws:logs:us-east-1:123456789012:log-group:/ecs/exec"}}},
+				{"Effect": "Allow", "Principal": {"Service": "logs.us-east-1.amazonaws.com"}, "Action": "kms:Encrypt", "Resource": "*",
+				"Condition": {"StringEquals": {"kms:EncryptionContextKeys": "aws:logs:arn"}}}]}`,
+			missing: [][]string{nil, nil, {"aws:SourceAccount or aws:SourceArn", "kms:ViaService"}},
+		},
+		{
+			name: "RoleWithWildcardAction",
+			policy: `{"Statement": {"Effect": "Allow", "Principal": {"AWS": ["arn:aws:iam::123456789012:role/app", "123456789012"]},
+				"Action": "kms:*", "Resource": "*"}}`,
+			missing: [][]string{nil, {"kms:ViaService"}},
+		},
+		{
+			name: "RoleWithoutCryptoActions",
+			policy: `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:role/admin"},
+				"Action": ["kms:Describe*", "kms:List*"], "Resource": "*"}]}`,
+			missing: [][]string{nil},
+		},
+		{
+			name: "AnyPrincipal",
+			policy: `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "kms:GenerateDataKey*", "Resource": "*"},
+				{"Effect": "Deny", "Principal": "*", "Action": "kms:*", "Resource": "*"}]}`,
+			missing: [][]string{{"kms:CallerAccount", "kms:ViaService"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			policy, err := Parse([]byte(tc.policy))
+			require.NoError(t, err)
+
+			grants := Analyze(policy)
+			require.Len(t, grants, len(tc.missing))
+			for i, g := range grants {
+				assert.Equal(t, tc.missing[i], g.Missing, g.Principal)
+			}
+		})
+	}
+}
+
+// TestParseInvalid tests that malformed policies are rejected
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []string{
+		`not json`,
+		`{"Statement": [{"Effect": "Allow", "Principal": {"AWS": {"nested": true}}}]}`,
+		`{"Statement": [{"Effect": "Allow", "Action": [["kms:Decrypt"]]}]}`,
+	} {
+		_, err := Parse([]byte(policy))
+		assert.Error(t, err, policy)
+	}
+}
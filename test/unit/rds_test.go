@@ -1,10 +1,14 @@
 package test
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
 )
 
 // TestRdsModuleVariablesValidation validates that the RDS module has required variables
@@ -29,7 +33,7 @@ func TestRdsModuleVariablesValidation(t *testing.T) {
 			"db_max_allocated_storage":  100,
 			"db_name":                   "testdb",
 			"db_username":               "admin",
-			"db_password":               "SecurePassword123!",
+			"db_password":               testSecrets.RDSPassword(),
 			"db_port":                   5432,
 			"multi_az":                  false,
 			"deletion_protection":       false,
@@ -101,7 +105,7 @@ func TestRdsModuleDatabaseEngines(t *testing.T) {
 					"db_max_allocated_storage":  100,
 					"db_name":                   "testdb",
 					"db_username":               "admin",
-					"db_password":               "SecurePassword123!",
+					"db_password":               testSecrets.RDSPassword(),
 					"db_port":                   5432,
 					"multi_az":                  false,
 					"deletion_protection":       false,
@@ -154,7 +158,7 @@ func TestRdsModuleInstanceClasses(t *testing.T) {
 					"db_max_allocated_storage":  100,
 					"db_name":                   "testdb",
 					"db_username":               "admin",
-					"db_password":               "SecurePassword123!",
+					"db_password":               testSecrets.RDSPassword(),
 					"db_port":                   5432,
 					"multi_az":                  false,
 					"deletion_protection":       false,
@@ -262,7 +266,7 @@ func TestRdsModuleStorageConfiguration(t *testing.T) {
 					"db_max_allocated_storage":  tc.maxAllocatedStorage,
 					"db_name":                   "testdb",
 					"db_username":               "admin",
-					"db_password":               "SecurePassword123!",
+					"db_password":               testSecrets.RDSPassword(),
 					"db_port":                   5432,
 					"multi_az":                  false,
 					"deletion_protection":       false,
@@ -280,3 +284,147 @@ func TestRdsModuleStorageConfiguration(t *testing.T) {
 		})
 	}
 }
+
+// rdsEngineCases lists the engine settings AWS accepts for each engine the
+// module supports
+var rdsEngineCases = []struct {
+	name              string
+	engine            string
+	engineVersion     string
+	port              int
+	family            string
+	logExports        []string
+	iamAuthentication bool
+}{
+	{
+		name:              "PostgreSQL15",
+		engine:            "postgres",
+		engineVersion:     "15.4",
+		port:              5432,
+		family:            "postgres15",
+		logExports:        []string{"postgresql", "upgrade"},
+		iamAuthentication: true,
+	},
+	{
+		name:              "PostgreSQL14",
+		engine:            "postgres",
+		engineVersion:     "14.9",
+		port:              5432,
+		family:            "postgres14",
+		logExports:        []string{"postgresql", "upgrade"},
+		iamAuthentication: true,
+	},
+	{
+		name:              "MySQL8",
+		engine:            "mysql",
+		engineVersion:     "8.0.35",
+		port:              3306,
+		family:            "mysql8.0",
+		logExports:        []string{"error", "general", "slowquery"},
+		iamAuthentication: true,
+	},
+	{
+		name:              "MariaDB10",
+		engine:            "mariadb",
+		engineVersion:     "10.11.6",
+		port:              3306,
+		family:            "mariadb10.11",
+		logExports:        []string{"error", "general", "slowquery"},
+		iamAuthentication: false,
+	},
+}
+
+// TestRdsModuleEnginePlans tests that each engine plans with the log
+// exports, port, parameter group family and IAM authentication of that engine
+func TestRdsModuleEnginePlans(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range rdsEngineCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			vars := environmentInputs(t, "staging", "rds")
+			vars["engine"] = tc.engine
+			vars["engine_version"] = tc.engineVersion
+
+			plan := planModule(t, "rds", "staging", vars)
+
+			instance := plan.ResourcePlannedValuesMap["aws_db_instance.main"]
+			require.NotNil(t, instance, "aws_db_instance.main is not planned")
+			assert.Equal(t, tc.engine, instance.AttributeValues["engine"])
+			assert.EqualValues(t, tc.port, instance.AttributeValues["port"])
+			assert.Equal(t, tc.iamAuthentication, instance.AttributeValues["iam_database_authentication_enabled"])
+			assert.ElementsMatch(t, tc.logExports, instance.AttributeValues["enabled_cloudwatch_logs_exports"])
+
+			params := plan.ResourcePlannedValuesMap["aws_db_parameter_group.main"]
+			require.NotNil(t, params, "aws_db_parameter_group.main is not planned")
+			assert.Equal(t, tc.family, params.AttributeValues["family"])
+
+			sg := plan.ResourcePlannedValuesMap["aws_security_group.rds"]
+			require.NotNil(t, sg, "aws_security_group.rds is not planned")
+			ingress, ok := sg.AttributeValues["ingress"].([]interface{})
+			require.True(t, ok && len(ingress) == 1, "expected one ingress rule")
+			rule := ingress[0].(map[string]interface{})
+			assert.EqualValues(t, tc.port, rule["from_port"])
+			assert.EqualValues(t, tc.port, rule["to_port"])
+		})
+	}
+}
+
+// TestRdsModuleEngineConditions tests the engine validation and
+// preconditions without running terraform
+func TestRdsModuleEngineConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "rds"))
+	require.NoError(t, err)
+
+	for _, tc := range rdsEngineCases {
+		vars := environmentInputs(t, "staging", "rds")
+		vars["engine"] = tc.engine
+		vars["engine_version"] = tc.engineVersion
+
+		failures, err := mod.CheckConditions(vars)
+		require.NoError(t, err)
+		assert.Empty(t, failures, tc.name)
+	}
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{
+			name:    "UnsupportedEngine",
+			vars:    map[string]interface{}{"engine": "oracle-ee"},
+			subject: "var.engine",
+		},
+		{
+			name:    "FamilyOfAnotherEngine",
+			vars:    map[string]interface{}{"engine": "mysql", "engine_version": "8.0.35", "db_parameter_group_family": "postgres15"},
+			subject: "aws_db_parameter_group.main",
+		},
+		{
+			name:    "LogExportOfAnotherEngine",
+			vars:    map[string]interface{}{"engine": "mariadb", "engine_version": "10.11.6", "enabled_cloudwatch_logs_exports": []string{"postgresql"}},
+			subject: "aws_db_instance.main",
+		},
+	}
+
+	for _, tc := range invalid {
+		vars := environmentInputs(t, "staging", "rds")
+		for k, v := range tc.vars {
+			vars[k] = v
+		}
+
+		failures, err := mod.CheckConditions(vars)
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
@@ -0,0 +1,214 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// scheduleInputs are the cost-saving schedule inputs of each module. They
+// must only be set for staging.
+var scheduleInputs = map[string]string{
+	"ecs": "scaling_windows",
+	"rds": "scheduled_stop",
+}
+
+// terragruntInputNames returns the names set in the inputs block of
+// environments/us-east-1/<environment>/<module>/terragrunt.hcl
+func terragruntInputNames(t *testing.T, environment, module string) []string {
+	t.Helper()
+
+	path := filepath.Join(repoRoot, "environments", testRegion, environment, module, "terragrunt.hcl")
+	src, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	require.False(t, diags.HasErrors(), "%s", diags)
+
+	inputs, ok := file.Body.(*hclsyntax.Body).Attributes["inputs"]
+	require.True(t, ok, "%s has no inputs", path)
+	object, ok := inputs.Expr.(*hclsyntax.ObjectConsExpr)
+	require.True(t, ok, "%s: inputs is not an object", path)
+
+	var names []string
+	for _, item := range object.Items {
+		name := hcl.ExprAsKeyword(item.KeyExpr)
+		require.NotEmpty(t, name, "%s: input key is not a name", item.KeyExpr.Range())
+		names = append(names, name)
+	}
+	return names
+}
+
+// TestSchedulesStagingOnly tests that only the staging terragrunt.hcl files,
+// and the inputs mirrored from them, set the cost-saving schedules
+func TestSchedulesStagingOnly(t *testing.T) {
+	t.Parallel()
+
+	for module, input := range scheduleInputs {
+		assert.Contains(t, terragruntInputNames(t, "staging", module), input, module)
+		assert.NotContains(t, terragruntInputNames(t, "production", module), input, module)
+
+		assert.NotEmpty(t, environmentInputs(t, "staging", module)[input], module)
+		assert.Empty(t, environmentInputs(t, "production", module)[input], module)
+	}
+}
+
+// TestScheduleConditions tests the scaling window and scheduled stop
+// validations without running terraform
+func TestScheduleConditions(t *testing.T) {
+	t.Parallel()
+
+	for module := range scheduleInputs {
+		mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", module))
+		require.NoError(t, err)
+
+		for _, environment := range []string{"staging", "production"} {
+			failures, err := mod.CheckConditions(environmentInputs(t, environment, module))
+			require.NoError(t, err)
+			assert.Empty(t, failures, "%s %s", module, environment)
+		}
+	}
+
+	window := func(change func(window map[string]interface{})) map[string]interface{} {
+		w := map[string]interface{}{"name": "off-hours", "start": "cron(0 20 ? * MON-FRI *)", "end": "cron(0 7 ? * MON-FRI *)", "min_capacity": 0, "max_capacity": 0}
+		change(w)
+		return map[string]interface{}{"scaling_windows": []map[string]interface{}{w}}
+	}
+
+	invalid := []struct {
+		name    string
+		module  string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{
+			name:    "WindowRateSchedule",
+			module:  "ecs",
+			vars:    window(func(w map[string]interface{}) { w["start"] = "rate(1 day)" }),
+			subject: "var.scaling_windows",
+		},
+		{
+			name:    "WindowCapacity",
+			module:  "ecs",
+			vars:    window(func(w map[string]interface{}) { w["min_capacity"] = 2; w["max_capacity"] = 1 }),
+			subject: "var.scaling_windows",
+		},
+		{
+			name:    "WindowName",
+			module:  "ecs",
+			vars:    window(func(w map[string]interface{}) { w["name"] = "Off Hours" }),
+			subject: "var.scaling_windows",
+		},
+		{
+			name:    "WindowWithoutAutoscaling",
+			module:  "ecs",
+			vars:    map[string]interface{}{"enable_autoscaling": false},
+			subject: "aws_appautoscaling_scheduled_action.ecs",
+		},
+		{
+			name:    "StopAtExpression",
+			module:  "rds",
+			vars:    map[string]interface{}{"scheduled_stop": map[string]interface{}{"stop": "at(2026-12-24T20:00:00)", "start": "cron(30 6 ? * MON-FRI *)"}},
+			subject: "var.scheduled_stop",
+		},
+	}
+
+	for _, tc := range invalid {
+		mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", tc.module))
+		require.NoError(t, err)
+
+		vars := environmentInputs(t, "staging", tc.module)
+		for k, v := range tc.vars {
+			vars[k] = v
+		}
+		failures, err := mod.CheckConditions(vars)
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// TestEcsModuleScalingWindows tests that the staging window scales the
+// service to zero and restores the module capacity, and that production plans
+// no scheduled action
+func TestEcsModuleScalingWindows(t *testing.T) {
+	t.Parallel()
+
+	plan := planModule(t, "ecs", "staging", environmentInputs(t, "staging", "ecs"))
+
+	expected := map[string][2]string{
+		`aws_appautoscaling_scheduled_action.ecs["off-hours-start"]`: {"0", "0"},
+		`aws_appautoscaling_scheduled_action.ecs["off-hours-end"]`:   {"1", "2"},
+	}
+	assert.ElementsMatch(t, []string{
+		`aws_appautoscaling_scheduled_action.ecs["off-hours-end"]`,
+		`aws_appautoscaling_scheduled_action.ecs["off-hours-start"]`,
+	}, resourceAddresses(plan, "aws_appautoscaling_scheduled_action"))
+
+	for address, capacity := range expected {
+		action := plan.ResourcePlannedValuesMap[address]
+		require.NotNil(t, action, "%s is not planned", address)
+		assert.Equal(t, "UTC", action.AttributeValues["timezone"])
+
+		targets := action.AttributeValues["scalable_target_action"].([]interface{})
+		require.Len(t, targets, 1)
+		target := targets[0].(map[string]interface{})
+		assert.Equal(t, capacity[0], fmt.Sprint(target["min_capacity"]), address)
+		assert.Equal(t, capacity[1], fmt.Sprint(target["max_capacity"]), address)
+	}
+
+	plan = planModule(t, "ecs", "production", environmentInputs(t, "production", "ecs"))
+	assert.Empty(t, resourceAddresses(plan, "aws_appautoscaling_scheduled_action"))
+}
+
+// TestRdsModuleScheduledStop tests the staging stop and start schedules and
+// their role, and that production plans neither
+func TestRdsModuleScheduledStop(t *testing.T) {
+	t.Parallel()
+
+	plan := planModule(t, "rds", "staging", environmentInputs(t, "staging", "rds"))
+
+	schedules := map[string]struct {
+		expression string
+		action     string
+	}{
+		"stop":  {"cron(0 20 ? * MON-FRI *)", "stopDBInstance"},
+		"start": {"cron(30 6 ? * MON-FRI *)", "startDBInstance"},
+	}
+	for name, want := range schedules {
+		address := `aws_scheduler_schedule.rds["` + name + `"]`
+		schedule := plan.ResourcePlannedValuesMap[address]
+		require.NotNil(t, schedule, "%s is not planned", address)
+		assert.Equal(t, want.expression, schedule.AttributeValues["schedule_expression"])
+		assert.Equal(t, "UTC", schedule.AttributeValues["schedule_expression_timezone"])
+
+		targets := schedule.AttributeValues["target"].([]interface{})
+		require.Len(t, targets, 1)
+		target := targets[0].(map[string]interface{})
+		assert.Equal(t, "arn:aws:scheduler:::aws-sdk:rds:"+want.action, target["arn"])
+
+		var input map[string]string
+		require.NoError(t, json.Unmarshal([]byte(target["input"].(string)), &input))
+		assert.Equal(t, map[string]string{"DbInstanceIdentifier": testProjectName + "-staging-db"}, input)
+	}
+	assert.Len(t, resourceAddresses(plan, "aws_scheduler_schedule"), 2)
+	assert.NotNil(t, plan.ResourcePlannedValuesMap["aws_iam_role.rds_scheduler[0]"])
+	assert.Contains(t, configReferences(t, plan, "aws_iam_role_policy.rds_scheduler", "policy"), "aws_db_instance.main.arn")
+
+	plan = planModule(t, "rds", "production", environmentInputs(t, "production", "rds"))
+	assert.Empty(t, resourceAddresses(plan, "aws_scheduler_schedule"))
+	assert.Nil(t, plan.ResourcePlannedValuesMap["aws_iam_role.rds_scheduler[0]"])
+}
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/secretgen"
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// secretInputIterations is the number of generated values checked per
+// property
+const secretInputIterations = 200
+
+// secretInputTerraformSamples is the number of generated values per property
+// that TestGeneratedSecretsTerraform plans with terraform
+const secretInputTerraformSamples = 3
+
+// checkSecretInput evaluates the conditions of a module with one variable set
+// and returns the subjects of the failures. The conditions are evaluated by
+// tfmodule, not by terraform; TestGeneratedSecretsTerraform plans a sample of
+// the values with terraform.
+func checkSecretInput(t *testing.T, mod *tfmodule.Module, vars map[string]interface{}, name string, value interface{}) []string {
+	t.Helper()
+
+	vars[name] = value
+	failures, err := mod.CheckConditions(vars)
+	require.NoError(t, err)
+
+	subjects := make([]string, 0, len(failures))
+	for _, f := range failures {
+		subjects = append(subjects, f.Subject)
+	}
+	return subjects
+}
+
+// TestGeneratedPasswordsAccepted tests that the modules accept every
+// generated password and reject passwords with a forbidden character
+func TestGeneratedPasswordsAccepted(t *testing.T) {
+	t.Parallel()
+
+	g := secretgen.NewRandom()
+	t.Logf("secretgen seed %d", g.Seed())
+
+	passwords := []struct {
+		module   string
+		variable string
+	}{
+		{"rds", "password"},
+		{"secrets-manager", "db_password"},
+	}
+
+	for _, p := range passwords {
+		mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", p.module))
+		require.NoError(t, err)
+		vars := environmentInputs(t, "staging", p.module)
+
+		for i := 0; i < secretInputIterations; i++ {
+			password := g.RDSPassword()
+			assert.Empty(t, checkSecretInput(t, mod, vars, p.variable, password), "%s rejects %s %q", p.module, p.variable, password)
+
+			invalid := g.InvalidRDSPassword()
+			assert.Equal(t, []string{"var." + p.variable}, checkSecretInput(t, mod, vars, p.variable, invalid), "%s accepts %s %q", p.module, p.variable, invalid)
+		}
+
+		for _, invalid := range []string{"aB3$aB3", strings.Repeat("aB3$", 11), "aB3$\taB3$", "aB3$éaB3$"} {
+			assert.Equal(t, []string{"var." + p.variable}, checkSecretInput(t, mod, vars, p.variable, invalid), "%s accepts %s %q", p.module, p.variable, invalid)
+		}
+	}
+}
+
+// TestGeneratedHECTokensAccepted tests that the secrets-manager module
+// accepts every generated HEC token and rejects tokens that are not UUIDs
+func TestGeneratedHECTokensAccepted(t *testing.T) {
+	t.Parallel()
+
+	g := secretgen.NewRandom()
+	t.Logf("secretgen seed %d", g.Seed())
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "secrets-manager"))
+	require.NoError(t, err)
+	vars := environmentInputs(t, "staging", "secrets-manager")
+
+	for i := 0; i < secretInputIterations; i++ {
+		token := g.HECToken()
+		assert.Empty(t, checkSecretInput(t, mod, vars, "splunk_hec_token", token), "rejects %q", token)
+
+		for _, invalid := range []string{
+			strings.ReplaceAll(token, "-", ""),
+			token[:len(token)-1],
+			token + "0",
+			"g" + token[1:],
+		} {
+			assert.Equal(t, []string{"var.splunk_hec_token"}, checkSecretInput(t, mod, vars, "splunk_hec_token", invalid), "accepts %q", invalid)
+		}
+	}
+
+	// No Splunk secret
+	assert.Empty(t, checkSecretInput(t, mod, vars, "splunk_hec_token", ""))
+}
+
+// TestGeneratedPublicKeysAccepted tests that the ec2-splunk module accepts
+// generated ed25519 and RSA keys and rejects malformed keys
+func TestGeneratedPublicKeysAccepted(t *testing.T) {
+	t.Parallel()
+
+	g := secretgen.NewRandom()
+	t.Logf("secretgen seed %d", g.Seed())
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "ec2-splunk"))
+	require.NoError(t, err)
+	vars := environmentInputs(t, "staging", "ec2-splunk")
+
+	var keys []string
+	for i := 0; i < secretInputIterations/4; i++ {
+		key, err := g.ED25519PublicKey("")
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	for _, bits := range []int{2048, 3072} {
+		key, err := g.RSAPublicKey(bits, "splunk@gogs-fork")
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		assert.Empty(t, checkSecretInput(t, mod, vars, "ssh_public_key", key), "rejects %q", key)
+
+		fields := strings.Fields(key)
+		for _, invalid := range []string{
+			fields[1],
+			"ssh-dss " + fields[1],
+			fields[0] + " " + fields[1][:len(fields[1])/2] + "!" + fields[1][len(fields[1])/2:],
+			fields[0] + " " + strings.TrimPrefix(fields[1], "AAAA"),
+			key + "\nssh-ed25519 second-line",
+		} {
+			assert.Equal(t, []string{"var.ssh_public_key"}, checkSecretInput(t, mod, vars, "ssh_public_key", invalid), "accepts %q", invalid)
+		}
+	}
+
+	// The key pair is optional
+	assert.Empty(t, checkSecretInput(t, mod, vars, "ssh_public_key", nil))
+}
+
+// TestGeneratedSecretsTerraform tests that terraform plan accepts a sample of
+// the generated passwords, tokens and keys and rejects malformed ones, so that
+// the tests above, which evaluate the modules with tfmodule, are checked
+// against terraform itself
+func TestGeneratedSecretsTerraform(t *testing.T) {
+	t.Parallel()
+	skipWithoutTerraform(t)
+
+	g := secretgen.NewRandom()
+	t.Logf("secretgen seed %d", g.Seed())
+
+	type sample struct {
+		module   string
+		variable string
+		value    string
+		valid    bool
+	}
+	var samples []sample
+	for i := 0; i < secretInputTerraformSamples; i++ {
+		key, err := g.ED25519PublicKey("")
+		require.NoError(t, err)
+
+		samples = append(samples,
+			sample{"rds", "password", g.RDSPassword(), true},
+			sample{"rds", "password", g.InvalidRDSPassword(), false},
+			sample{"secrets-manager", "db_password", g.RDSPassword(), true},
+			sample{"secrets-manager", "db_password", g.InvalidRDSPassword(), false},
+			sample{"secrets-manager", "splunk_hec_token", g.HECToken(), true},
+			sample{"secrets-manager", "splunk_hec_token", strings.ReplaceAll(g.HECToken(), "-", ""), false},
+			sample{"ec2-splunk", "ssh_public_key", key, true},
+			sample{"ec2-splunk", "ssh_public_key", strings.Fields(key)[1], false},
+		)
+	}
+
+	options := map[string]*terraform.Options{}
+	for _, s := range samples {
+		if options[s.module] == nil {
+			options[s.module] = moduleOptions(t, s.module, defaultTags("staging"), nil)
+			terraform.Init(t, options[s.module])
+		}
+
+		vars := environmentInputs(t, "staging", s.module)
+		vars[s.variable] = s.value
+		assert.Equal(t, !s.valid, terraformRejects(t, options[s.module], vars), "%s %s %q", s.module, s.variable, s.value)
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/secretschema"
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// secretsDependency is the name of the secrets-manager dependency in the ECS
+// terragrunt.hcl files
+const secretsDependency = "secrets_manager"
+
+// ecsSecretReferences returns the secret references of an environment's ECS
+// configuration and the secrets-manager outputs they can refer to
+func ecsSecretReferences(t *testing.T, environment string) ([]secretschema.Reference, map[string]string) {
+	t.Helper()
+
+	refs, err := secretschema.TerragruntReferences(filepath.Join(repoRoot, "environments", testRegion, environment, "ecs", "terragrunt.hcl"))
+	require.NoError(t, err)
+	require.NotEmpty(t, refs, "no secrets-manager references found")
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "secrets-manager"))
+	require.NoError(t, err)
+
+	return refs, secretschema.OutputSecrets(mod)
+}
+
+// TestSecretPayloadSchemas tests that every secret version planned by the
+// secrets-manager module matches the schema of its secret type
+func TestSecretPayloadSchemas(t *testing.T) {
+	t.Parallel()
+
+	vars := environmentInputs(t, "staging", "secrets-manager")
+	vars["create_dockerhub_secret"] = true
+	vars["dockerhub_username"] = "gogsbot"
+	vars["dockerhub_password"] = "dckr_pat_test"
+	vars["custom_secrets"] = map[string]interface{}{
+		"smtp": map[string]interface{}{
+			"description": "SMTP relay credentials",
+			"value":       map[string]string{"user": "mailer", "password": "smtp-test"},
+		},
+	}
+
+	plan := planModule(t, "secrets-manager", "staging", vars)
+	payloads := secretschema.Payloads(&plan.RawPlan)
+
+	var secrets []string
+	for _, p := range payloads {
+		secrets = append(secrets, p.Secret)
+	}
+	sort.Strings(secrets)
+	assert.Equal(t, []string{"application", "custom", "database", "dockerhub", "splunk"}, secrets)
+
+	problems := secretschema.CheckPayloads(payloads)
+	assert.Empty(t, problems, "secret payloads do not match their schema:\n%s", secretschema.Report(problems))
+}
+
+// TestSecretReferencesMatchSchemas tests offline that every ECS valueFrom
+// refers to a secrets-manager output and a JSON key of its secret schema
+func TestSecretReferencesMatchSchemas(t *testing.T) {
+	t.Parallel()
+
+	for _, environment := range []string{"staging", "production"} {
+		refs, outputs := ecsSecretReferences(t, environment)
+
+		problems := secretschema.CheckReferences(refs, secretsDependency, outputs)
+		assert.Empty(t, problems, "%s ECS secrets refer to unknown keys:\n%s", environment, secretschema.Report(problems))
+	}
+}
+
+// TestSecretReferencesExistInPayloads tests that every JSON key read by ECS
+// exists in the secret payload planned with the environment's inputs
+func TestSecretReferencesExistInPayloads(t *testing.T) {
+	t.Parallel()
+
+	for _, environment := range []string{"staging", "production"} {
+		environment := environment
+		t.Run(environment, func(t *testing.T) {
+			t.Parallel()
+
+			refs, outputs := ecsSecretReferences(t, environment)
+			plan := planModule(t, "secrets-manager", environment, environmentInputs(t, environment, "secrets-manager"))
+
+			problems := secretschema.CheckReferencePayloads(refs, secretsDependency, outputs, secretschema.Payloads(&plan.RawPlan))
+			assert.Empty(t, problems, "ECS secrets refer to missing keys:\n%s", secretschema.Report(problems))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Package secretgen generates random test credentials that satisfy the
+// constraints AWS and the modules put on them, so tests do not carry
+// hardcoded passwords, tokens or keys.
+//
+// Values are generated from a seeded source: a failing property test can be
+// reproduced from the seed it logs.
+package secretgen
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RDS master password constraints.
+const (
+	RDSPasswordMinLength = 8
+	RDSPasswordMaxLength = 41
+
+	// RDSPasswordForbidden lists the printable characters RDS rejects.
+	RDSPasswordForbidden = `/@" `
+)
+
+// rdsPasswordChars are the printable ASCII characters RDS accepts.
+var rdsPasswordChars = func() string {
+	var b strings.Builder
+	for c := byte('!'); c <= '~'; c++ {
+		if !strings.ContainsRune(RDSPasswordForbidden, rune(c)) {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}()
+
+// Generator produces test credentials from a seeded source. It is safe for
+// concurrent use, but values are only reproducible from the seed when it is
+// used by a single goroutine.
+type Generator struct {
+	seed int64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// New returns a generator for seed.
+func New(seed int64) *Generator {
+	return &Generator{seed: seed, rand: rand.New(rand.NewSource(seed))}
+}
+
+// NewRandom returns a generator seeded from the current time.
+func NewRandom() *Generator {
+	return New(time.Now().UnixNano())
+}
+
+// Seed returns the seed of the generator.
+func (g *Generator) Seed() int64 {
+	return g.seed
+}
+
+// Read fills p with random bytes, so the generator can be used as the
+// randomness source of key generation.
+func (g *Generator) Read(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rand.Read(p)
+}
+
+// RDSPassword returns a master password of random length that RDS accepts
+// for every engine the rds module supports. It always contains an upper and
+// lower case letter, a digit and a symbol.
+func (g *Generator) RDSPassword() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rdsPassword()
+}
+
+// SplunkPassword returns an admin password for Splunk, which requires at
+// least 8 characters. It uses the stricter RDS rules so the same value is
+// valid everywhere.
+func (g *Generator) SplunkPassword() string {
+	return g.RDSPassword()
+}
+
+func (g *Generator) rdsPassword() string {
+	length := RDSPasswordMinLength + g.rand.Intn(RDSPasswordMaxLength-RDSPasswordMinLength+1)
+
+	password := []byte{
+		g.pick("ABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+		g.pick("abcdefghijklmnopqrstuvwxyz"),
+		g.pick("0123456789"),
+		g.pick("!#$%&'()*+,-.:;<=>?[]^_`{|}~"),
+	}
+	for len(password) < length {
+		password = append(password, g.pick(rdsPasswordChars))
+	}
+	g.rand.Shuffle(len(password), func(i, j int) {
+		password[i], password[j] = password[j], password[i]
+	})
+	return string(password)
+}
+
+// InvalidRDSPassword returns a valid password with a random character
+// replaced by a forbidden one.
+func (g *Generator) InvalidRDSPassword() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	password := []byte(g.rdsPassword())
+	i := g.rand.Intn(len(password))
+	password[i] = g.pick(RDSPasswordForbidden)
+	return string(password)
+}
+
+// CheckRDSPassword returns an error describing why RDS would reject password.
+func CheckRDSPassword(password string) error {
+	if n := len(password); n < RDSPasswordMinLength || n > RDSPasswordMaxLength {
+		return fmt.Errorf("length %d is outside %d-%d", n, RDSPasswordMinLength, RDSPasswordMaxLength)
+	}
+	for _, c := range password {
+		if !strings.ContainsRune(rdsPasswordChars, c) {
+			return fmt.Errorf("character %q is not allowed", c)
+		}
+	}
+	return nil
+}
+
+// HECToken returns a random (version 4) UUID, the format of Splunk HTTP Event
+// Collector tokens.
+func (g *Generator) HECToken() string {
+	var u [16]byte
+	_, _ = g.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// ED25519PublicKey generates an ed25519 key pair and returns the public key in
+// authorized_keys format.
+func (g *Generator) ED25519PublicKey(comment string) (string, error) {
+	public, _, err := ed25519.GenerateKey(g)
+	if err != nil {
+		return "", err
+	}
+	return authorizedKey("ssh-ed25519", comment, []byte(public)), nil
+}
+
+// RSAPublicKey generates an RSA key pair of the given size and returns the
+// public key in authorized_keys format.
+func (g *Generator) RSAPublicKey(bits int, comment string) (string, error) {
+	key, err := rsa.GenerateKey(g, bits)
+	if err != nil {
+		return "", err
+	}
+	return authorizedKey("ssh-rsa", comment, mpint(big.NewInt(int64(key.E))), mpint(key.N)), nil
+}
+
+func (g *Generator) pick(chars string) byte {
+	return chars[g.rand.Intn(len(chars))]
+}
+
+// authorizedKey encodes an SSH public key blob (RFC 4253 section 6.6) as an
+// authorized_keys line.
+func authorizedKey(keyType, comment string, fields ...[]byte) string {
+	blob := sshString([]byte(keyType))
+	for _, f := range fields {
+		blob = append(blob, sshString(f)...)
+	}
+
+	line := keyType + " " + base64.StdEncoding.EncodeToString(blob)
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+func sshString(b []byte) []byte {
+	out := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(out, uint32(len(b)))
+	return append(out, b...)
+}
+
+// mpint encodes a non-negative integer as an SSH mpint body, with a leading
+// zero byte when the high bit is set.
+func mpint(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
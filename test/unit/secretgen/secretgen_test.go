@@ -0,0 +1,104 @@
+package secretgen
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// TestRDSPassword tests that generated passwords satisfy the RDS constraints
+// and invalid passwords do not
+func TestRDSPassword(t *testing.T) {
+	t.Parallel()
+
+	g := NewRandom()
+	t.Logf("seed %d", g.Seed())
+
+	lengths := map[int]bool{}
+	for i := 0; i < 2000; i++ {
+		password := g.RDSPassword()
+		require.NoError(t, CheckRDSPassword(password), password)
+		assert.Regexp(t, `[A-Z]`, password)
+		assert.Regexp(t, `[a-z]`, password)
+		assert.Regexp(t, `[0-9]`, password)
+		lengths[len(password)] = true
+
+		invalid := g.InvalidRDSPassword()
+		require.Error(t, CheckRDSPassword(invalid), invalid)
+		assert.True(t, strings.ContainsAny(invalid, RDSPasswordForbidden), invalid)
+	}
+
+	// Every length from the minimum to the maximum is produced
+	assert.Len(t, lengths, RDSPasswordMaxLength-RDSPasswordMinLength+1)
+}
+
+// TestCheckRDSPassword tests the RDS password oracle
+func TestCheckRDSPassword(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, CheckRDSPassword("aB3$aB3$"))
+	assert.NoError(t, CheckRDSPassword(strings.Repeat("x", RDSPasswordMaxLength)))
+	for _, invalid := range []string{
+		"aB3$aB3",
+		strings.Repeat("x", RDSPasswordMaxLength+1),
+		"aB3$/aB3$",
+		"aB3$@aB3$",
+		`aB3$"aB3$`,
+		"aB3$ aB3$",
+		"aB3$\taB3$",
+		"aB3$éaB3$",
+	} {
+		assert.Error(t, CheckRDSPassword(invalid), invalid)
+	}
+}
+
+// TestHECToken tests that HEC tokens are distinct version 4 UUIDs
+func TestHECToken(t *testing.T) {
+	t.Parallel()
+
+	g := NewRandom()
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		token := g.HECToken()
+		require.Regexp(t, uuidV4, token)
+		require.False(t, seen[token], "duplicate token %s", token)
+		seen[token] = true
+	}
+}
+
+// TestPublicKeys tests that generated keys parse as authorized_keys entries
+func TestPublicKeys(t *testing.T) {
+	t.Parallel()
+
+	g := New(1)
+
+	line, err := g.ED25519PublicKey("splunk@test")
+	require.NoError(t, err)
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	require.NoError(t, err)
+	assert.Equal(t, ssh.KeyAlgoED25519, key.Type())
+	assert.Equal(t, "splunk@test", comment)
+	assert.Len(t, key.(ssh.CryptoPublicKey).CryptoPublicKey().(ed25519.PublicKey), ed25519.PublicKeySize)
+
+	// The same seed produces the same key
+	again, err := New(1).ED25519PublicKey("splunk@test")
+	require.NoError(t, err)
+	assert.Equal(t, line, again)
+
+	line, err = g.RSAPublicKey(2048, "")
+	require.NoError(t, err)
+	key, _, _, _, err = ssh.ParseAuthorizedKey([]byte(line))
+	require.NoError(t, err)
+	assert.Equal(t, ssh.KeyAlgoRSA, key.Type())
+	public := key.(ssh.CryptoPublicKey).CryptoPublicKey().(*rsa.PublicKey)
+	assert.Equal(t, 2048, public.N.BitLen())
+	assert.Equal(t, 65537, public.E)
+}
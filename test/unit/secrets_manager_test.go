@@ -1,6 +1,7 @@
 package test
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
@@ -21,7 +22,7 @@ func TestSecretsManagerModuleVariablesValidation(t *testing.T) {
 			"create_kms_key":          true,
 			"recovery_window_in_days": 7,
 			"db_username":             "admin",
-			"db_password":             "SecurePassword123!",
+			"db_password":             testSecrets.RDSPassword(),
 			"db_host":                 "db.example.com",
 			"db_port":                 5432,
 			"db_name":                 "testdb",
@@ -30,8 +31,8 @@ func TestSecretsManagerModuleVariablesValidation(t *testing.T) {
 				"SECRET_KEY":  "test-secret-key",
 			},
 			"create_splunk_secret":    true,
-			"splunk_admin_password":   "SplunkAdmin123!",
-			"splunk_hec_token":        "12345678-1234-1234-1234-123456789012",
+			"splunk_admin_password":   testSecrets.SplunkPassword(),
+			"splunk_hec_token":        testSecrets.HECToken(),
 			"create_dockerhub_secret": true,
 			"dockerhub_username":      "testuser",
 			"dockerhub_password":      "testpassword",
@@ -93,14 +94,14 @@ func TestSecretsManagerModuleSecretTypes(t *testing.T) {
 					"create_kms_key":          true,
 					"recovery_window_in_days": 7,
 					"db_username":             "admin",
-					"db_password":             "SecurePassword123!",
+					"db_password":             testSecrets.RDSPassword(),
 					"db_host":                 "db.example.com",
 					"db_port":                 5432,
 					"db_name":                 "testdb",
 					"application_secrets":     map[string]string{},
 					"create_splunk_secret":    tc.createSplunkSecret,
-					"splunk_admin_password":   "SplunkAdmin123!",
-					"splunk_hec_token":        "12345678-1234-1234-1234-123456789012",
+					"splunk_admin_password":   testSecrets.SplunkPassword(),
+					"splunk_hec_token":        testSecrets.HECToken(),
 					"create_dockerhub_secret": tc.createDockerhubSecret,
 					"dockerhub_username":      "testuser",
 					"dockerhub_password":      "testpassword",
@@ -156,7 +157,7 @@ func TestSecretsManagerModuleKMSConfiguration(t *testing.T) {
 					"create_kms_key":          tc.createKMSKey,
 					"recovery_window_in_days": 7,
 					"db_username":             "admin",
-					"db_password":             "SecurePassword123!",
+					"db_password":             testSecrets.RDSPassword(),
 					"db_host":                 "db.example.com",
 					"db_port":                 5432,
 					"db_name":                 "testdb",
@@ -187,7 +188,7 @@ func TestSecretsManagerModuleRecoveryWindow(t *testing.T) {
 
 	for _, window := range recoveryWindows {
 		window := window
-		t.Run("RecoveryWindow_"+strconv.Itoa(window)), func(t *testing.T) {
+		t.Run("RecoveryWindow_"+strconv.Itoa(window), func(t *testing.T) {
 			t.Parallel()
 
 			terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
@@ -199,7 +200,7 @@ func TestSecretsManagerModuleRecoveryWindow(t *testing.T) {
 					"create_kms_key":          false,
 					"recovery_window_in_days": window,
 					"db_username":             "admin",
-					"db_password":             "SecurePassword123!",
+					"db_password":             testSecrets.RDSPassword(),
 					"db_host":                 "db.example.com",
 					"db_port":                 5432,
 					"db_name":                 "testdb",
@@ -265,7 +266,7 @@ func TestSecretsManagerModuleApplicationSecrets(t *testing.T) {
 					"create_kms_key":          false,
 					"recovery_window_in_days": 7,
 					"db_username":             "admin",
-					"db_password":             "SecurePassword123!",
+					"db_password":             testSecrets.RDSPassword(),
 					"db_host":                 "db.example.com",
 					"db_port":                 5432,
 					"db_name":                 "testdb",
@@ -328,7 +329,7 @@ func TestSecretsManagerModuleDatabasePorts(t *testing.T) {
 					"create_kms_key":          false,
 					"recovery_window_in_days": 7,
 					"db_username":             "admin",
-					"db_password":             "SecurePassword123!",
+					"db_password":             testSecrets.RDSPassword(),
 					"db_host":                 "db.example.com",
 					"db_port":                 tc.dbPort,
 					"db_name":                 "testdb",
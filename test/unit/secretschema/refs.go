@@ -0,0 +1,348 @@
+package secretschema
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// ValueFrom is a parsed ECS secret valueFrom of the form
+// <secret-arn>:<json-key>:<version-stage>:<version-id>.
+type ValueFrom struct {
+	SecretArn    string
+	JSONKey      string
+	VersionStage string
+	VersionID    string
+}
+
+// ParseValueFrom parses a Secrets Manager valueFrom. The fields after the
+// secret ARN are optional.
+func ParseValueFrom(s string) (ValueFrom, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 7 || parts[0] != "arn" || parts[2] != "secretsmanager" || parts[5] != "secret" || parts[6] == "" {
+		return ValueFrom{}, fmt.Errorf("%q is not a Secrets Manager secret ARN", s)
+	}
+	if len(parts) > 10 {
+		return ValueFrom{}, fmt.Errorf("%q has too many fields", s)
+	}
+	parts = append(parts, "", "", "")
+
+	return ValueFrom{
+		SecretArn:    strings.Join(parts[:7], ":"),
+		JSONKey:      parts[7],
+		VersionStage: parts[8],
+		VersionID:    parts[9],
+	}, nil
+}
+
+// Reference is an entry of the ECS secrets input of a terragrunt.hcl whose
+// valueFrom starts with a dependency output, e.g.
+// "${dependency.secrets_manager.outputs.database_secret_arn}:password::".
+type Reference struct {
+	// Name is the environment variable set in the container.
+	Name string
+
+	Dependency string
+	Output     string
+
+	// OutputKey is the map key for outputs such as custom_secret_arns["x"],
+	// "" otherwise.
+	OutputKey string
+
+	JSONKey      string
+	VersionStage string
+	VersionID    string
+
+	Range hcl.Range
+}
+
+func (r Reference) String() string {
+	output := r.Output
+	if r.OutputKey != "" {
+		output += fmt.Sprintf("[%q]", r.OutputKey)
+	}
+	return fmt.Sprintf("%s (dependency.%s.outputs.%s:%s)", r.Name, r.Dependency, output, r.JSONKey)
+}
+
+// TerragruntReferences returns the entries of inputs.secrets in a
+// terragrunt.hcl whose valueFrom refers to a dependency output. Entries with
+// a literal ARN are not returned.
+func TerragruntReferences(path string) ([]Reference, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	inputs, ok := file.Body.(*hclsyntax.Body).Attributes["inputs"]
+	if !ok {
+		return nil, nil
+	}
+	object, ok := inputs.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return nil, fmt.Errorf("%s: inputs is not an object", path)
+	}
+
+	secrets, ok := objectItem(object, "secrets").(*hclsyntax.TupleConsExpr)
+	if !ok {
+		return nil, nil
+	}
+
+	var refs []Reference
+	for _, expr := range secrets.Exprs {
+		entry, ok := expr.(*hclsyntax.ObjectConsExpr)
+		if !ok {
+			return nil, fmt.Errorf("%s: secrets entry is not an object", expr.Range())
+		}
+
+		name, _ := literalString(objectItem(entry, "name"))
+		valueFrom := objectItem(entry, "valueFrom")
+		if valueFrom == nil {
+			return nil, fmt.Errorf("%s: secret %s has no valueFrom", entry.Range(), name)
+		}
+
+		ref, ok, err := reference(valueFrom)
+		if err != nil {
+			return nil, fmt.Errorf("%s: secret %s: %w", valueFrom.Range(), name, err)
+		}
+		if ok {
+			ref.Name = name
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// reference decodes a "${dependency.<name>.outputs.<output>}<suffix>"
+// template. ok is false when the template does not start with a dependency
+// output.
+func reference(expr hclsyntax.Expression) (Reference, bool, error) {
+	template, ok := expr.(*hclsyntax.TemplateExpr)
+	if !ok || len(template.Parts) == 0 {
+		return Reference{}, false, nil
+	}
+
+	ref := Reference{Range: expr.Range()}
+	if !dependencyOutput(template.Parts[0], &ref) {
+		return Reference{}, false, nil
+	}
+
+	var suffix strings.Builder
+	for _, part := range template.Parts[1:] {
+		s, ok := literalString(part)
+		if !ok {
+			return Reference{}, false, fmt.Errorf("valueFrom must be a dependency output followed by literal text")
+		}
+		suffix.WriteString(s)
+	}
+
+	// The output is the secret ARN; parse the suffix against a placeholder
+	value, err := ParseValueFrom("arn:aws:secretsmanager:region:000000000000:secret:output" + suffix.String())
+	if err != nil {
+		return Reference{}, false, fmt.Errorf("invalid valueFrom suffix %q", suffix.String())
+	}
+	ref.JSONKey, ref.VersionStage, ref.VersionID = value.JSONKey, value.VersionStage, value.VersionID
+	return ref, true, nil
+}
+
+// dependencyOutput fills ref from a dependency.<name>.outputs.<output>[<key>]
+// traversal.
+func dependencyOutput(expr hclsyntax.Expression, ref *Reference) bool {
+	var traversal hcl.Traversal
+	switch e := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		traversal = e.Traversal
+	case *hclsyntax.IndexExpr:
+		collection, ok := e.Collection.(*hclsyntax.ScopeTraversalExpr)
+		key, isString := literalString(e.Key)
+		if !ok || !isString {
+			return false
+		}
+		traversal, ref.OutputKey = collection.Traversal, key
+	default:
+		return false
+	}
+
+	if len(traversal) < 4 || traversal.RootName() != "dependency" {
+		return false
+	}
+	names := make([]string, 0, 3)
+	for _, step := range traversal[1:4] {
+		attr, ok := step.(hcl.TraverseAttr)
+		if !ok {
+			return false
+		}
+		names = append(names, attr.Name)
+	}
+	if names[1] != "outputs" {
+		return false
+	}
+	ref.Dependency, ref.Output = names[0], names[2]
+
+	if len(traversal) == 5 {
+		index, ok := traversal[4].(hcl.TraverseIndex)
+		if !ok {
+			return false
+		}
+		if index.Key.Type() == cty.String {
+			ref.OutputKey = index.Key.AsString()
+		}
+	} else if len(traversal) > 5 {
+		return false
+	}
+	return true
+}
+
+func objectItem(object *hclsyntax.ObjectConsExpr, name string) hclsyntax.Expression {
+	for _, item := range object.Items {
+		if key, ok := literalString(item.KeyExpr); ok && key == name {
+			return item.ValueExpr
+		}
+	}
+	return nil
+}
+
+// literalString returns the value of a keyword, string literal or template
+// without interpolations.
+func literalString(expr hclsyntax.Expression) (string, bool) {
+	if expr == nil {
+		return "", false
+	}
+	if keyword := hcl.ExprAsKeyword(expr); keyword != "" {
+		return keyword, true
+	}
+	if len(expr.Variables()) > 0 {
+		return "", false
+	}
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// OutputSecrets maps each output of the secrets-manager module that returns
+// the ARN of a single kind of secret to the name of that
+// aws_secretsmanager_secret resource. Outputs of several secrets, such as
+// all_secret_arns, are not included.
+func OutputSecrets(mod *tfmodule.Module) map[string]string {
+	outputs := map[string]string{}
+	for _, output := range mod.Outputs {
+		if output.Value == nil {
+			continue
+		}
+
+		secrets := map[string]bool{}
+		arn := false
+		for _, traversal := range output.Value.Variables() {
+			if traversal.RootName() != "aws_secretsmanager_secret" || len(traversal) < 2 {
+				continue
+			}
+			if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+				secrets[attr.Name] = true
+			}
+		}
+		hclsyntax.VisitAll(output.Value, func(node hclsyntax.Node) hcl.Diagnostics {
+			switch e := node.(type) {
+			case *hclsyntax.ScopeTraversalExpr:
+				arn = arn || hasAttr(e.Traversal, "arn")
+			case *hclsyntax.RelativeTraversalExpr:
+				arn = arn || hasAttr(e.Traversal, "arn")
+			}
+			return nil
+		})
+
+		if len(secrets) == 1 && arn {
+			for name := range secrets {
+				outputs[output.Name] = name
+			}
+		}
+	}
+	return outputs
+}
+
+func hasAttr(traversal hcl.Traversal, name string) bool {
+	for _, step := range traversal {
+		if attr, ok := step.(hcl.TraverseAttr); ok && attr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckReferences checks that every reference to the dependency names an
+// output in outputs (as returned by OutputSecrets) and, for fixed schemas, a
+// JSON key of the secret's schema.
+func CheckReferences(refs []Reference, dependency string, outputs map[string]string) []Problem {
+	var problems []Problem
+	for _, ref := range refs {
+		if ref.Dependency != dependency {
+			continue
+		}
+
+		secret, ok := outputs[ref.Output]
+		if !ok {
+			problems = append(problems, Problem{Address: ref.String(), Message: fmt.Sprintf("output %q is not the ARN of a single secret", ref.Output)})
+			continue
+		}
+		schema, ok := Schemas[secret]
+		if !ok {
+			problems = append(problems, Problem{Address: ref.String(), Message: fmt.Sprintf("secret %q has no schema", secret)})
+			continue
+		}
+		if ref.JSONKey != "" && !schema.Has(ref.JSONKey) {
+			problems = append(problems, Problem{
+				Address: ref.String(),
+				Key:     ref.JSONKey,
+				Message: fmt.Sprintf("is not a key of the %s secret (%s)", secret, strings.Join(schema.Keys(), ", ")),
+			})
+		}
+	}
+	return problems
+}
+
+// CheckReferencePayloads checks that the JSON key of every reference to the
+// dependency exists in the planned payload of the referenced secret.
+func CheckReferencePayloads(refs []Reference, dependency string, outputs map[string]string, payloads []Payload) []Problem {
+	var problems []Problem
+	for _, ref := range refs {
+		if ref.Dependency != dependency || ref.JSONKey == "" {
+			continue
+		}
+
+		secret := outputs[ref.Output]
+		var payload *Payload
+		for i := range payloads {
+			if payloads[i].Secret == secret && payloads[i].Key == ref.OutputKey {
+				payload = &payloads[i]
+			}
+		}
+
+		switch {
+		case payload == nil:
+			problems = append(problems, Problem{Address: ref.String(), Message: "refers to a secret that is not planned"})
+		case !payload.Known:
+			problems = append(problems, Problem{Address: ref.String(), Message: payload.Address + " is unknown until apply"})
+		default:
+			keys := Keys(payload.Value)
+			if i := sort.SearchStrings(keys, ref.JSONKey); i == len(keys) || keys[i] != ref.JSONKey {
+				problems = append(problems, Problem{
+					Address: ref.String(),
+					Key:     ref.JSONKey,
+					Message: fmt.Sprintf("is not a key of %s (%s)", payload.Address, strings.Join(keys, ", ")),
+				})
+			}
+		}
+	}
+	return problems
+}
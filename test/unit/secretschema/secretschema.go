@@ -0,0 +1,253 @@
+// Package secretschema checks the JSON payloads written by the
+// secrets-manager module and the ECS secret references that read them.
+//
+// Each aws_secretsmanager_secret_version resource of the module has a
+// schema, keyed by the resource name. Fixed schemas list every key of the
+// payload; free-form schemas, such as the application and custom secrets,
+// only require string values.
+package secretschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Type is the JSON type of a payload value.
+type Type string
+
+const (
+	String Type = "string"
+	Number Type = "number"
+)
+
+// Schema is the expected JSON payload of a secret type.
+type Schema struct {
+	Name string
+
+	// Fields lists the required keys and their types. A free-form schema has
+	// no fields.
+	Fields map[string]Type
+
+	// FreeForm accepts any key with a string value.
+	FreeForm bool
+}
+
+// Keys returns the sorted keys of a fixed schema.
+func (s Schema) Keys() []string {
+	keys := make([]string, 0, len(s.Fields))
+	for k := range s.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Has reports whether key is a valid key of the schema. Any key is valid in
+// a free-form schema.
+func (s Schema) Has(key string) bool {
+	if s.FreeForm {
+		return true
+	}
+	_, ok := s.Fields[key]
+	return ok
+}
+
+// Schemas maps the secret version resource names of the secrets-manager
+// module to their schemas.
+var Schemas = map[string]Schema{
+	"database": {
+		Name: "database",
+		Fields: map[string]Type{
+			"username": String,
+			"password": String,
+			"host":     String,
+			"port":     Number,
+			"dbname":   String,
+			// Old name of dbname, written until the next release
+			"database": String,
+		},
+	},
+	"application": {Name: "application", FreeForm: true},
+	"splunk": {
+		Name: "splunk",
+		Fields: map[string]Type{
+			"admin_password": String,
+			"hec_token":      String,
+		},
+	},
+	"dockerhub": {
+		Name: "dockerhub",
+		Fields: map[string]Type{
+			"username": String,
+			"password": String,
+		},
+	},
+	"custom": {Name: "custom", FreeForm: true},
+}
+
+// Problem is a payload that does not match its schema.
+type Problem struct {
+	Address string `json:"address,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Address != "" {
+		fmt.Fprintf(&b, "%s: ", p.Address)
+	}
+	if p.Key != "" {
+		fmt.Fprintf(&b, "key %q ", p.Key)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// Check decodes payload as a JSON object and returns its problems against
+// schema, sorted by key.
+func Check(schema Schema, payload string) []Problem {
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return []Problem{{Message: "is not a JSON object"}}
+	}
+
+	var problems []Problem
+	for key, value := range object {
+		want, ok := schema.Fields[key]
+		switch {
+		case schema.FreeForm:
+			want = String
+		case !ok:
+			problems = append(problems, Problem{Key: key, Message: fmt.Sprintf("is not part of the %s schema", schema.Name)})
+			continue
+		}
+		if got := typeOf(value); got != want {
+			problems = append(problems, Problem{Key: key, Message: fmt.Sprintf("is a %s, want a %s", got, want)})
+		}
+	}
+	for key := range schema.Fields {
+		if _, ok := object[key]; !ok {
+			problems = append(problems, Problem{Key: key, Message: "is missing"})
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Key < problems[j].Key })
+	return problems
+}
+
+func typeOf(value interface{}) Type {
+	switch value.(type) {
+	case string:
+		return String
+	case json.Number:
+		return Number
+	case bool:
+		return "bool"
+	case nil:
+		return "null"
+	case []interface{}:
+		return "list"
+	default:
+		return "object"
+	}
+}
+
+// Payload is the planned secret_string of a secret version.
+type Payload struct {
+	Address string
+
+	// Secret is the resource name of the secret version, e.g. "database".
+	Secret string
+
+	// Key is the for_each key of custom secrets, "" otherwise.
+	Key string
+
+	// Known is false when the secret string is only known after apply.
+	Known bool
+
+	// Value is the secret string. The plan JSON carries sensitive values in
+	// clear text and marks them in after_sensitive; the value is kept as is
+	// and must not be logged.
+	Value string
+}
+
+// Payloads returns the aws_secretsmanager_secret_version resources created or
+// updated by plan, sorted by address.
+func Payloads(plan *tfjson.Plan) []Payload {
+	var payloads []Payload
+	if plan == nil {
+		return payloads
+	}
+
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Type != "aws_secretsmanager_secret_version" || rc.Change == nil || rc.Change.Actions.Delete() {
+			continue
+		}
+
+		payload := Payload{Address: rc.Address, Secret: rc.Name}
+		if key, ok := rc.Index.(string); ok {
+			payload.Key = key
+		}
+		after, _ := rc.Change.After.(map[string]interface{})
+		if value, ok := after["secret_string"].(string); ok {
+			payload.Known, payload.Value = true, value
+		}
+		payloads = append(payloads, payload)
+	}
+
+	sort.Slice(payloads, func(i, j int) bool { return payloads[i].Address < payloads[j].Address })
+	return payloads
+}
+
+// CheckPayloads checks every known payload against the schema of its secret.
+// Payloads of secrets without a schema and unknown payloads are problems.
+func CheckPayloads(payloads []Payload) []Problem {
+	var problems []Problem
+	for _, p := range payloads {
+		schema, ok := Schemas[p.Secret]
+		switch {
+		case !ok:
+			problems = append(problems, Problem{Address: p.Address, Message: fmt.Sprintf("secret %q has no schema", p.Secret)})
+		case !p.Known:
+			problems = append(problems, Problem{Address: p.Address, Message: "secret_string is unknown until apply"})
+		default:
+			for _, problem := range Check(schema, p.Value) {
+				problem.Address = p.Address
+				problems = append(problems, problem)
+			}
+		}
+	}
+	return problems
+}
+
+// Keys returns the sorted top-level keys of a JSON object payload, or nil
+// when it is not an object.
+func Keys(payload string) []string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &object); err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Report renders the problems one per line, or "" if there are none.
+func Report(problems []Problem) string {
+	lines := make([]string, 0, len(problems))
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
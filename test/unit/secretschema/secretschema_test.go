@@ -0,0 +1,183 @@
+package secretschema
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheck tests payloads against fixed and free-form schemas
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		schema   Schema
+		payload  string
+		problems []Problem
+	}{
+		{
+			name:    "ValidDatabase",
+			schema:  Schemas["database"],
+			payload: `{"username":"u","password":"p","host":"h","port":5432,"dbname":"d","database":"d"}`,
+		},
+		{
+			name:    "DatabasePortAsString",
+			schema:  Schemas["database"],
+			payload: `{"username":"u","password":"p","host":"h","port":"5432","database":"d"}`,
+			problems: []Problem{
+				{Key: "dbname", Message: "is missing"},
+				{Key: "port", Message: "is a string, want a number"},
+			},
+		},
+		{
+			name:    "FreeForm",
+			schema:  Schemas["application"],
+			payload: `{"APP_SECRET_KEY":"k","RETRIES":3,"EMPTY":null}`,
+			problems: []Problem{
+				{Key: "EMPTY", Message: "is a null, want a string"},
+				{Key: "RETRIES", Message: "is a number, want a string"},
+			},
+		},
+		{
+			name:     "NotAnObject",
+			schema:   Schemas["custom"],
+			payload:  `["a"]`,
+			problems: []Problem{{Message: "is not a JSON object"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.problems, Check(tc.schema, tc.payload))
+		})
+	}
+}
+
+// TestPayloadsFixture tests payload extraction and checks on a recorded plan
+func TestPayloadsFixture(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "secrets-plan.json"))
+	require.NoError(t, err)
+
+	var plan tfjson.Plan
+	require.NoError(t, json.Unmarshal(data, &plan))
+
+	payloads := Payloads(&plan)
+
+	// Deleted versions and secrets are skipped
+	addresses := make([]string, 0, len(payloads))
+	for _, p := range payloads {
+		addresses = append(addresses, p.Address)
+	}
+	assert.Equal(t, []string{
+		"aws_secretsmanager_secret_version.application",
+		`aws_secretsmanager_secret_version.custom["api"]`,
+		"aws_secretsmanager_secret_version.database",
+		"aws_secretsmanager_secret_version.legacy",
+		"aws_secretsmanager_secret_version.splunk[0]",
+	}, addresses)
+	assert.Equal(t, "api", payloads[1].Key)
+	assert.False(t, payloads[0].Known)
+
+	assert.Equal(t, []Problem{
+		{Address: "aws_secretsmanager_secret_version.application", Message: "secret_string is unknown until apply"},
+		{Address: `aws_secretsmanager_secret_version.custom["api"]`, Key: "retries", Message: "is a number, want a string"},
+		{Address: "aws_secretsmanager_secret_version.legacy", Message: `secret "legacy" has no schema`},
+		{Address: "aws_secretsmanager_secret_version.splunk[0]", Key: "hec", Message: "is not part of the splunk schema"},
+		{Address: "aws_secretsmanager_secret_version.splunk[0]", Key: "hec_token", Message: "is missing"},
+	}, CheckPayloads(payloads))
+}
+
+// TestParseValueFrom tests ECS valueFrom parsing
+func TestParseValueFrom(t *testing.T) {
+	t.Parallel()
+
+	value, err := ParseValueFrom("arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf:password:AWSCURRENT:")
+	require.NoError(t, err)
+	assert.Equal(t, ValueFrom{
+		SecretArn:    "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf",
+		JSONKey:      "password",
+		VersionStage: "AWSCURRENT",
+	}, value)
+
+	value, err = ParseValueFrom("arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf")
+	require.NoError(t, err)
+	assert.Equal(t, "", value.JSONKey)
+
+	for _, invalid := range []string{
+		"db-AbCdEf:password::",
+		"arn:aws:ssm:us-east-1:123456789012:parameter/db",
+		"arn:aws:secretsmanager:us-east-1:123456789012:secret:db:password:AWSCURRENT:id:extra",
+	} {
+		_, err := ParseValueFrom(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestReferencesFixture tests reading and checking the secret references of a
+// terragrunt.hcl against the schemas and a recorded plan
+func TestReferencesFixture(t *testing.T) {
+	t.Parallel()
+
+	refs, err := TerragruntReferences(filepath.Join("testdata", "ecs-terragrunt.hcl"))
+	require.NoError(t, err)
+
+	// The literal ARN is not a dependency reference
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	require.Equal(t, []string{"DB_PASSWORD", "DB_NAME", "SPLUNK_HEC_TOKEN", "API_TOKEN", "ALL"}, names)
+	assert.Equal(t, "secrets_manager", refs[0].Dependency)
+	assert.Equal(t, "database_secret_arn", refs[0].Output)
+	assert.Equal(t, "password", refs[0].JSONKey)
+	assert.Equal(t, "AWSCURRENT", refs[2].VersionStage)
+	assert.Equal(t, "api", refs[3].OutputKey)
+
+	outputs := map[string]string{
+		"database_secret_arn": "database",
+		"splunk_secret_arn":   "splunk",
+		"custom_secret_arns":  "custom",
+	}
+
+	assert.Equal(t, []Problem{
+		{
+			Address: "DB_NAME (dependency.secrets_manager.outputs.database_secret_arn:db_name)",
+			Key:     "db_name",
+			Message: "is not a key of the database secret (database, dbname, host, password, port, username)",
+		},
+		{
+			Address: "ALL (dependency.secrets_manager.outputs.all_secret_arns:key)",
+			Message: `output "all_secret_arns" is not the ARN of a single secret`,
+		},
+	}, CheckReferences(refs, "secrets_manager", outputs))
+
+	data, err := os.ReadFile(filepath.Join("testdata", "secrets-plan.json"))
+	require.NoError(t, err)
+	var plan tfjson.Plan
+	require.NoError(t, json.Unmarshal(data, &plan))
+
+	problems := CheckReferencePayloads(refs, "secrets_manager", outputs, Payloads(&plan))
+	assert.Equal(t, []string{
+		`DB_NAME (dependency.secrets_manager.outputs.database_secret_arn:db_name): key "db_name" is not a key of aws_secretsmanager_secret_version.database (database, dbname, host, password, port, username)`,
+		`SPLUNK_HEC_TOKEN (dependency.secrets_manager.outputs.splunk_secret_arn:hec_token): key "hec_token" is not a key of aws_secretsmanager_secret_version.splunk[0] (admin_password, hec)`,
+		`ALL (dependency.secrets_manager.outputs.all_secret_arns:key): refers to a secret that is not planned`,
+	}, stringsOf(problems))
+}
+
+func stringsOf(problems []Problem) []string {
+	lines := make([]string, 0, len(problems))
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	return lines
+}
@@ -0,0 +1,35 @@
+# ECS inputs referencing the secrets-manager dependency, including mistakes
+dependency "secrets_manager" {
+  config_path = "../secrets-manager"
+}
+
+inputs = {
+  container_name = "gogs-app"
+
+  secrets = [
+    {
+      name      = "DB_PASSWORD"
+      valueFrom = "${dependency.secrets_manager.outputs.database_secret_arn}:password::"
+    },
+    {
+      name      = "DB_NAME"
+      valueFrom = "${dependency.secrets_manager.outputs.database_secret_arn}:db_name::"
+    },
+    {
+      name      = "SPLUNK_HEC_TOKEN"
+      valueFrom = "${dependency.secrets_manager.outputs.splunk_secret_arn}:hec_token:AWSCURRENT:"
+    },
+    {
+      name      = "API_TOKEN"
+      valueFrom = "${dependency.secrets_manager.outputs.custom_secret_arns["api"]}:token::"
+    },
+    {
+      name      = "ALL"
+      valueFrom = "${dependency.secrets_manager.outputs.all_secret_arns[0]}:key::"
+    },
+    {
+      name      = "STATIC"
+      valueFrom = "arn:aws:secretsmanager:us-east-1:123456789012:secret:static-AbCdEf:key::"
+    }
+  ]
+}
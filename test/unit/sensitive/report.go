@@ -0,0 +1,34 @@
+package sensitive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Report renders findings one per line.
+func Report(findings []Finding) string {
+	lines := make([]string, 0, len(findings))
+	for _, f := range findings {
+		lines = append(lines, f.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteText writes a table of the sensitive data paths of every result.
+func WriteText(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "MODULE\tSOURCE\tVIA\tSINK\tKIND\tSENSITIVE")
+	for _, r := range results {
+		for _, p := range r.Paths {
+			via := "-"
+			if len(p.Via) > 0 {
+				via = strings.Join(p.Via, " > ")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\n", p.Module, p.Source, via, p.Sink, p.Kind, p.Sensitive)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,321 @@
+// Package sensitive audits how secret values flow through a Terraform
+// module, without running Terraform.
+//
+// A value is a secret when it comes from a variable marked sensitive or from
+// a variable whose name looks like a secret (password, token, ...). Secrets
+// are followed through locals and resource arguments: an argument assigned
+// from a secret makes that resource attribute a secret too, so
+// aws_db_instance.main.username carries var.username. A nonsensitive() call
+// explicitly declassifies its argument.
+//
+// The audit reports:
+//
+//   - secret-like variables and outputs that are not marked sensitive;
+//   - non-sensitive outputs that expose a secret;
+//   - resource tags assigned from a secret, since tags show up in the console,
+//     in billing reports and in every tag API response.
+package sensitive
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+var (
+	secretName = regexp.MustCompile(`(^|_)(password|passwd|secrets?|tokens?|private_key|credentials?|api_key|username)($|_)`)
+
+	// notSecretName matches references to secrets rather than secret values,
+	// and feature flags.
+	notSecretName = regexp.MustCompile(`(_(arns?|names?|ids?)$)|(^(create|enable)_)`)
+)
+
+// SecretLike reports whether a variable or output name looks like it holds a
+// secret value.
+func SecretLike(name string) bool {
+	return secretName.MatchString(name) && !notSecretName.MatchString(name)
+}
+
+// Kind is the kind of place a secret flows to.
+type Kind string
+
+const (
+	Argument Kind = "argument"
+	Tag      Kind = "tag"
+	Output   Kind = "output"
+)
+
+// Path is a secret reaching a resource argument or an output.
+type Path struct {
+	Module string `json:"module"`
+
+	// Source is the variable the secret comes from, e.g. "var.password".
+	Source string `json:"source"`
+
+	// Via lists the locals and resource attributes the secret passes
+	// through, in order.
+	Via []string `json:"via,omitempty"`
+
+	// Sink is "<resource address>.<argument path>" or "output.<name>".
+	Sink string `json:"sink"`
+	Kind Kind   `json:"kind"`
+
+	// Sensitive is whether an output sink is marked sensitive. It is always
+	// true for arguments, which Terraform redacts in plans when they are
+	// derived from sensitive variables.
+	Sensitive bool `json:"sensitive"`
+}
+
+// Problem classifies a finding.
+type Problem string
+
+const (
+	// NotMarked is a secret-like variable or output without sensitive = true.
+	NotMarked Problem = "not marked sensitive"
+
+	// Exposed is a non-sensitive output assigned from a secret.
+	Exposed Problem = "exposes a secret in a non-sensitive output"
+
+	// Tagged is a resource tag assigned from a secret.
+	Tagged Problem = "puts a secret in a resource tag"
+)
+
+// Finding is a problem with a variable, output or resource argument.
+type Finding struct {
+	Module  string    `json:"module"`
+	Subject string    `json:"subject"`
+	Problem Problem   `json:"problem"`
+	Source  string    `json:"source,omitempty"`
+	Range   hcl.Range `json:"-"`
+}
+
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s: %s %s", f.Module, f.Subject, f.Problem)
+	if f.Source != "" {
+		s += " (" + f.Source + ")"
+	}
+	return fmt.Sprintf("%s at %s", s, f.Range)
+}
+
+// Result is the outcome of auditing one module.
+type Result struct {
+	Module   string
+	Paths    []Path
+	Findings []Finding
+}
+
+// origin is how a secret reached a symbol.
+type origin struct {
+	source string
+	via    []string
+}
+
+// Audit audits a module. allow maps "var.<name>" or "output.<name>" to the
+// reason a secret-like name does not hold a secret; allowed variables are not
+// treated as secrets.
+func Audit(name string, mod *tfmodule.Module, allow map[string]string) Result {
+	result := Result{Module: name}
+
+	// Every symbol carrying a secret, e.g. "var.password",
+	// "local.credentials" or "aws_db_instance.main.username"
+	secrets := map[string][]origin{}
+
+	for _, v := range mod.Variables {
+		subject := "var." + v.Name
+		if _, ok := allow[subject]; ok {
+			continue
+		}
+		if SecretLike(v.Name) && !v.Sensitive {
+			result.Findings = append(result.Findings, Finding{Module: name, Subject: subject, Problem: NotMarked, Range: v.Range})
+		}
+		if v.Sensitive || SecretLike(v.Name) {
+			secrets[subject] = []origin{{source: subject}}
+		}
+	}
+
+	// Propagate through locals and resource arguments until nothing changes
+	resources := append([]tfmodule.Resource(nil), mod.Resources...)
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address() < resources[j].Address() })
+	localNames := make([]string, 0, len(mod.Locals))
+	for local := range mod.Locals {
+		localNames = append(localNames, local)
+	}
+	sort.Strings(localNames)
+
+	for changed := true; changed; {
+		changed = false
+		for _, local := range localNames {
+			changed = taint(secrets, "local."+local, refs(mod.Locals[local], secrets)) || changed
+		}
+		for _, r := range resources {
+			if r.Mode != "managed" {
+				continue
+			}
+			for _, arg := range r.Arguments() {
+				attribute := r.Type + "." + r.Name + "." + firstSegment(arg.Path)
+				changed = taint(secrets, attribute, refs(arg.Expr, secrets)) || changed
+			}
+		}
+	}
+
+	for _, r := range resources {
+		if r.Mode != "managed" {
+			continue
+		}
+		for _, arg := range r.Arguments() {
+			sink := r.Address() + "." + arg.Path
+			kind := Argument
+			if isTag(arg.Path) {
+				kind = Tag
+			}
+			for _, o := range refs(arg.Expr, secrets) {
+				result.Paths = append(result.Paths, Path{Module: name, Source: o.source, Via: o.via, Sink: sink, Kind: kind, Sensitive: true})
+				if kind == Tag {
+					result.Findings = append(result.Findings, Finding{Module: name, Subject: sink, Problem: Tagged, Source: o.source, Range: arg.Expr.Range()})
+				}
+			}
+		}
+	}
+
+	for _, output := range mod.Outputs {
+		subject := "output." + output.Name
+		if _, ok := allow[subject]; !ok && SecretLike(output.Name) && !output.Sensitive {
+			result.Findings = append(result.Findings, Finding{Module: name, Subject: subject, Problem: NotMarked, Range: output.Range})
+		}
+		if output.Value == nil {
+			continue
+		}
+		for _, o := range refs(output.Value, secrets) {
+			result.Paths = append(result.Paths, Path{Module: name, Source: o.source, Via: o.via, Sink: subject, Kind: Output, Sensitive: output.Sensitive})
+			if !output.Sensitive {
+				result.Findings = append(result.Findings, Finding{Module: name, Subject: subject, Problem: Exposed, Source: o.source, Range: output.Value.Range()})
+			}
+		}
+	}
+
+	sort.SliceStable(result.Paths, func(i, j int) bool {
+		if result.Paths[i].Source != result.Paths[j].Source {
+			return result.Paths[i].Source < result.Paths[j].Source
+		}
+		return result.Paths[i].Sink < result.Paths[j].Sink
+	})
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		return result.Findings[i].Subject < result.Findings[j].Subject
+	})
+	return result
+}
+
+// taint records that symbol carries the secrets in origins, and reports
+// whether a new source was added.
+func taint(secrets map[string][]origin, symbol string, origins []origin) bool {
+	changed := false
+	for _, o := range origins {
+		known := false
+		for _, existing := range secrets[symbol] {
+			if existing.source == o.source {
+				known = true
+				break
+			}
+		}
+		if !known {
+			via := append(append([]string(nil), o.via...), symbol)
+			secrets[symbol] = append(secrets[symbol], origin{source: o.source, via: via})
+			changed = true
+		}
+	}
+	return changed
+}
+
+// refs returns the secrets expr refers to, one per source, outside of
+// nonsensitive() calls.
+func refs(expr hclsyntax.Expression, secrets map[string][]origin) []origin {
+	var declassified []hcl.Range
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && call.Name == "nonsensitive" {
+			declassified = append(declassified, call.Range())
+		}
+		return nil
+	})
+
+	seen := map[string]bool{}
+	var origins []origin
+	for _, traversal := range expr.Variables() {
+		if within(traversal.SourceRange(), declassified) {
+			continue
+		}
+		for _, symbol := range symbols(traversal) {
+			for _, o := range secrets[symbol] {
+				if !seen[o.source] {
+					seen[o.source] = true
+					origins = append(origins, o)
+				}
+			}
+		}
+	}
+	return origins
+}
+
+// symbols returns the secret symbol a traversal refers to: the variable or
+// local, or the resource attribute with any instance key skipped.
+func symbols(traversal hcl.Traversal) []string {
+	var names []string
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, s.Name)
+		case hcl.TraverseAttr:
+			names = append(names, s.Name)
+		}
+	}
+
+	switch {
+	case len(names) >= 2 && (names[0] == "var" || names[0] == "local"):
+		return []string{names[0] + "." + names[1]}
+	case len(names) >= 3 && !notResource[names[0]]:
+		return []string{names[0] + "." + names[1] + "." + names[2]}
+	}
+	return nil
+}
+
+// notResource are the traversal roots that are not managed resource types.
+var notResource = map[string]bool{
+	"data":   true,
+	"module": true,
+	"each":   true,
+	"count":  true,
+	"path":   true,
+	"self":   true,
+}
+
+func within(r hcl.Range, ranges []hcl.Range) bool {
+	for _, outer := range ranges {
+		if r.Filename == outer.Filename && r.Start.Byte >= outer.Start.Byte && r.End.Byte <= outer.End.Byte {
+			return true
+		}
+	}
+	return false
+}
+
+func firstSegment(path string) string {
+	if i := strings.IndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// isTag reports whether an argument path is a tag map or a tag block.
+func isTag(path string) bool {
+	for _, segment := range strings.Split(path, ".") {
+		switch segment {
+		case "tags", "tags_all", "tag", "default_tags":
+			return true
+		}
+	}
+	return false
+}
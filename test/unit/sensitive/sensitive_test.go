@@ -0,0 +1,100 @@
+package sensitive
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// TestSecretLike tests the secret-like name heuristic
+func TestSecretLike(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"password", "db_password", "splunk_hec_token", "application_secrets", "dockerhub_username", "aws_credentials", "private_key_pem"} {
+		assert.True(t, SecretLike(name), name)
+	}
+	for _, name := range []string{"secret_arn", "custom_secret_names", "kms_key_id", "create_dockerhub_secret", "enable_secrets", "tokenizer", "passwords_policy_name", "ssh_public_key"} {
+		assert.False(t, SecretLike(name), name)
+	}
+}
+
+// TestAuditFixture tests the findings and paths of a module that leaks
+// secrets
+func TestAuditFixture(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join("testdata", "leaky"))
+	require.NoError(t, err)
+
+	result := Audit("leaky", mod, nil)
+
+	var findings []string
+	for _, f := range result.Findings {
+		findings = append(findings, strings.Join([]string{f.Subject, string(f.Problem), f.Source}, " | "))
+	}
+	assert.Equal(t, []string{
+		"aws_ssm_parameter.connection.tags | puts a secret in a resource tag | var.api_token",
+		"output.api_token | not marked sensitive | ",
+		"output.connection | exposes a secret in a non-sensitive output | var.db_password",
+		"var.api_token | not marked sensitive | ",
+	}, findings)
+
+	assert.Equal(t, []Path{
+		{Module: "leaky", Source: "var.api_token", Sink: "aws_ssm_parameter.connection.tags", Kind: Tag, Sensitive: true},
+		{Module: "leaky", Source: "var.db_password", Sink: "aws_db_instance.main.password", Kind: Argument, Sensitive: true},
+		{Module: "leaky", Source: "var.db_password", Via: []string{"local.connection"}, Sink: "aws_ssm_parameter.connection.value", Kind: Argument, Sensitive: true},
+		{Module: "leaky", Source: "var.db_password", Via: []string{"local.connection", "aws_ssm_parameter.connection.value"}, Sink: "output.connection", Kind: Output},
+		{Module: "leaky", Source: "var.db_password", Via: []string{"aws_db_instance.main.password"}, Sink: "output.db_password", Kind: Output, Sensitive: true},
+	}, result.Paths)
+
+	// nonsensitive() declassifies var.master_key
+	for _, p := range result.Paths {
+		assert.NotEqual(t, "var.master_key", p.Source)
+	}
+}
+
+// TestAuditAllow tests that allowed names are neither reported nor treated as
+// secrets
+func TestAuditAllow(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join("testdata", "leaky"))
+	require.NoError(t, err)
+
+	result := Audit("leaky", mod, map[string]string{
+		"var.api_token":    "test fixture",
+		"output.api_token": "test fixture",
+	})
+
+	var subjects []string
+	for _, f := range result.Findings {
+		subjects = append(subjects, f.Subject)
+	}
+	assert.Equal(t, []string{"output.connection"}, subjects)
+}
+
+// TestWriteText tests the path table
+func TestWriteText(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	require.NoError(t, WriteText(&b, []Result{{
+		Module: "leaky",
+		Paths: []Path{
+			{Module: "leaky", Source: "var.db_password", Sink: "aws_db_instance.main.password", Kind: Argument, Sensitive: true},
+			{Module: "leaky", Source: "var.db_password", Via: []string{"local.connection", "aws_ssm_parameter.connection.value"}, Sink: "output.connection", Kind: Output},
+		},
+	}}))
+
+	assert.Equal(t, strings.Join([]string{
+		"MODULE  SOURCE           VIA                                                    SINK                           KIND      SENSITIVE",
+		"leaky   var.db_password  -                                                      aws_db_instance.main.password  argument  true",
+		"leaky   var.db_password  local.connection > aws_ssm_parameter.connection.value  output.connection              output    false",
+		"",
+	}, "\n"), b.String())
+}
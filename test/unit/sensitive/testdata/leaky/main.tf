@@ -0,0 +1,27 @@
+locals {
+  connection = "postgres://app:${var.db_password}@db"
+  label      = "${var.name}-app"
+}
+
+resource "aws_db_instance" "main" {
+  identifier = local.label
+  password   = var.db_password
+
+  tags = {
+    Name = local.label
+  }
+}
+
+resource "aws_ssm_parameter" "connection" {
+  name  = "/${var.name}/connection"
+  value = local.connection
+
+  tags = {
+    Name  = var.name
+    Token = var.api_token
+  }
+}
+
+resource "aws_kms_key" "main" {
+  description = nonsensitive(var.master_key)
+}
@@ -0,0 +1,20 @@
+output "db_password" {
+  value     = aws_db_instance.main.password
+  sensitive = true
+}
+
+output "api_token" {
+  value = "redacted"
+}
+
+output "connection" {
+  value = aws_ssm_parameter.connection[0].value
+}
+
+output "key_description" {
+  value = aws_kms_key.main.description
+}
+
+output "secret_arn" {
+  value = var.secret_arn
+}
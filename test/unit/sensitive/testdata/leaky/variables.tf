@@ -0,0 +1,25 @@
+variable "name" {
+  type = string
+}
+
+variable "api_token" {
+  type = string
+}
+
+variable "db_password" {
+  type      = string
+  sensitive = true
+}
+
+variable "master_key" {
+  type      = string
+  sensitive = true
+}
+
+variable "secret_arn" {
+  type = string
+}
+
+variable "create_secret" {
+  type = bool
+}
@@ -0,0 +1,42 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/sensitive"
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// sensitiveAllowed lists secret-like variables and outputs that do not hold
+// secret values, with the reason
+var sensitiveAllowed = map[string]map[string]string{
+	"ecs": {
+		"var.secrets": "maps environment variable names to Secrets Manager valueFrom ARNs",
+	},
+}
+
+// TestSensitiveDataAudit tests offline that every secret-like variable and
+// output is marked sensitive and that secrets never reach a non-sensitive
+// output or a resource tag
+func TestSensitiveDataAudit(t *testing.T) {
+	t.Parallel()
+
+	var results []sensitive.Result
+	for _, module := range environmentModules {
+		mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", module))
+		require.NoError(t, err)
+
+		result := sensitive.Audit(module, mod, sensitiveAllowed[module])
+		assert.Empty(t, result.Findings, "sensitive data audit findings:\n%s", sensitive.Report(result.Findings))
+		results = append(results, result)
+	}
+
+	var b strings.Builder
+	require.NoError(t, sensitive.WriteText(&b, results))
+	t.Logf("sensitive data paths:\n%s", b.String())
+}
@@ -0,0 +1,136 @@
+// Package tagcheck verifies the effective tags of planned AWS resources.
+//
+// The effective tags of a resource are its tags_all attribute: the resource's
+// own tags merged over the provider default_tags. A resource is considered
+// taggable when its planned change carries a tags_all attribute, whether known
+// or still unknown at plan time.
+package tagcheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Problem classifies a tag violation.
+type Problem string
+
+const (
+	// Missing means the required key is absent from the effective tags.
+	Missing Problem = "missing"
+
+	// Mismatch means the key is present with an unexpected value.
+	Mismatch Problem = "mismatch"
+
+	// Unknown means the effective tags cannot be determined at plan time.
+	Unknown Problem = "unknown"
+)
+
+// Violation is a single tag problem on a resource.
+type Violation struct {
+	Address string  `json:"address"`
+	Key     string  `json:"key"`
+	Problem Problem `json:"problem"`
+	Want    string  `json:"want,omitempty"`
+	Got     string  `json:"got,omitempty"`
+}
+
+func (v Violation) String() string {
+	switch v.Problem {
+	case Missing:
+		return fmt.Sprintf("%s: tag %q is missing", v.Address, v.Key)
+	case Mismatch:
+		return fmt.Sprintf("%s: tag %q is %q, want %q", v.Address, v.Key, v.Got, v.Want)
+	default:
+		return fmt.Sprintf("%s: tags are unknown until apply", v.Address)
+	}
+}
+
+// Result is the outcome of checking a plan.
+type Result struct {
+	// Checked lists the addresses of every taggable resource that was checked.
+	Checked []string
+
+	// Violations lists every tag problem, sorted by address and key.
+	Violations []Violation
+}
+
+// Check verifies that every taggable resource created or updated by plan has
+// the required tags. A required value of "" accepts any non-empty value.
+func Check(plan *tfjson.Plan, required map[string]string) Result {
+	var result Result
+	if plan == nil {
+		return result
+	}
+
+	keys := make([]string, 0, len(required))
+	for k := range required {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil || rc.Change.Actions.Delete() {
+			continue
+		}
+
+		after, _ := rc.Change.After.(map[string]interface{})
+		tagsAll, known := after["tags_all"]
+		if !known {
+			if !isUnknown(rc.Change.AfterUnknown, "tags_all") {
+				// The resource type has no tags
+				continue
+			}
+			result.Checked = append(result.Checked, rc.Address)
+			result.Violations = append(result.Violations, Violation{Address: rc.Address, Problem: Unknown})
+			continue
+		}
+
+		result.Checked = append(result.Checked, rc.Address)
+		tags, _ := tagsAll.(map[string]interface{})
+
+		for _, key := range keys {
+			want := required[key]
+			value, ok := tags[key]
+			got, _ := value.(string)
+
+			switch {
+			case !ok || got == "":
+				result.Violations = append(result.Violations, Violation{
+					Address: rc.Address, Key: key, Problem: Missing, Want: want,
+				})
+			case want != "" && got != want:
+				result.Violations = append(result.Violations, Violation{
+					Address: rc.Address, Key: key, Problem: Mismatch, Want: want, Got: got,
+				})
+			}
+		}
+	}
+
+	sort.Strings(result.Checked)
+	sort.SliceStable(result.Violations, func(i, j int) bool {
+		if result.Violations[i].Address != result.Violations[j].Address {
+			return result.Violations[i].Address < result.Violations[j].Address
+		}
+		return result.Violations[i].Key < result.Violations[j].Key
+	})
+
+	return result
+}
+
+// Report renders the violations one per line, or "" if there are none.
+func (r Result) Report() string {
+	lines := make([]string, 0, len(r.Violations))
+	for _, v := range r.Violations {
+		lines = append(lines, v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isUnknown(afterUnknown interface{}, attribute string) bool {
+	unknown, _ := afterUnknown.(map[string]interface{})
+	value, _ := unknown[attribute].(bool)
+	return value
+}
@@ -0,0 +1,60 @@
+package tagcheck
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckFixture verifies missing, mis-tagged and unknown tags in a recorded plan
+func TestCheckFixture(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "ecs-mixed-tags.json"))
+	require.NoError(t, err)
+
+	var plan tfjson.Plan
+	require.NoError(t, json.Unmarshal(data, &plan))
+
+	result := Check(&plan, map[string]string{
+		"Environment": "staging",
+		"ManagedBy":   "Terraform",
+		"Project":     "gogs-fork",
+		"Repository":  "",
+	})
+
+	// Untaggable and deleted resources are skipped
+	assert.Equal(t, []string{
+		"aws_cloudwatch_log_group.ecs",
+		"aws_ecs_cluster.main",
+		"aws_ecs_service.main",
+		"aws_lb_listener.http",
+	}, result.Checked)
+
+	assert.Equal(t, []Violation{
+		{Address: "aws_cloudwatch_log_group.ecs", Key: "Environment", Problem: Mismatch, Want: "staging", Got: "production"},
+		{Address: "aws_cloudwatch_log_group.ecs", Key: "ManagedBy", Problem: Mismatch, Want: "Terraform", Got: "terraform"},
+		{Address: "aws_ecs_service.main", Problem: Unknown},
+		{Address: "aws_lb_listener.http", Key: "Environment", Problem: Missing, Want: "staging"},
+		{Address: "aws_lb_listener.http", Key: "ManagedBy", Problem: Missing, Want: "Terraform"},
+		{Address: "aws_lb_listener.http", Key: "Project", Problem: Missing, Want: "gogs-fork"},
+		{Address: "aws_lb_listener.http", Key: "Repository", Problem: Missing},
+	}, result.Violations)
+
+	assert.Contains(t, result.Report(), `aws_cloudwatch_log_group.ecs: tag "Environment" is "production", want "staging"`)
+	assert.Contains(t, result.Report(), `aws_lb_listener.http: tag "Repository" is missing`)
+}
+
+// TestCheckNilPlan verifies that an empty plan has nothing to report
+func TestCheckNilPlan(t *testing.T) {
+	t.Parallel()
+
+	result := Check(nil, map[string]string{"Environment": "staging"})
+	assert.Empty(t, result.Checked)
+	assert.Empty(t, result.Report())
+}
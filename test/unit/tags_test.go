@@ -0,0 +1,66 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tagcheck"
+)
+
+// requiredTags returns the cost allocation tags every resource must carry
+func requiredTags(environment string) map[string]string {
+	return defaultTags(environment)
+}
+
+// TestTagComplianceDefaultTags plans every module with the provider
+// default_tags generated by terragrunt.hcl and verifies the effective tags of
+// every taggable resource
+func TestTagComplianceDefaultTags(t *testing.T) {
+	t.Parallel()
+
+	for _, environment := range []string{"staging", "production"} {
+		for _, module := range environmentModules {
+			environment, module := environment, module
+			t.Run(environment+"/"+module, func(t *testing.T) {
+				t.Parallel()
+
+				plan := planModule(t, module, environment, environmentInputs(t, environment, module))
+				result := tagcheck.Check(&plan.RawPlan, requiredTags(environment))
+
+				assert.NotEmpty(t, result.Checked, "no taggable resources found")
+				assert.Empty(t, result.Violations, "untagged or mis-tagged resources:\n%s", result.Report())
+			})
+		}
+	}
+}
+
+// TestTagComplianceModuleTags plans every module without provider
+// default_tags and verifies that the module applies var.tags to every
+// taggable resource on its own
+func TestTagComplianceModuleTags(t *testing.T) {
+	t.Parallel()
+
+	moduleTags := map[string]string{
+		"Environment": "staging",
+		"Project":     testProjectName,
+		"ManagedBy":   "Terraform",
+		"CostCenter":  "gogs-platform",
+	}
+
+	for _, module := range environmentModules {
+		module := module
+		t.Run(module, func(t *testing.T) {
+			t.Parallel()
+
+			vars := environmentInputs(t, "staging", module)
+			vars["tags"] = moduleTags
+
+			plan := terraformPlan(t, moduleOptions(t, module, nil, vars))
+			result := tagcheck.Check(&plan.RawPlan, moduleTags)
+
+			assert.NotEmpty(t, result.Checked, "no taggable resources found")
+			assert.Empty(t, result.Violations, "resources not applying var.tags:\n%s", result.Report())
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
+)
+
+// terragruntDependencies returns the modules named by the config_path of the
+// dependency blocks in environments/us-east-1/<environment>/<module>/terragrunt.hcl
+func terragruntDependencies(t *testing.T, environment, module string) []string {
+	t.Helper()
+
+	path := filepath.Join(repoRoot, "environments", testRegion, environment, module, "terragrunt.hcl")
+	src, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	require.False(t, diags.HasErrors(), "%s", diags)
+
+	var dependencies []string
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "dependency" {
+			continue
+		}
+		attr, ok := block.Body.Attributes["config_path"]
+		require.True(t, ok, "%s: dependency %v has no config_path", path, block.Labels)
+		value, diags := attr.Expr.Value(nil)
+		require.False(t, diags.HasErrors(), "%s: config_path is not a literal: %s", path, diags)
+		dependencies = append(dependencies, filepath.Base(value.AsString()))
+	}
+	return dependencies
+}
+
+// TestTerragruntDependencyOrder tests that every module only depends on the
+// modules before it in environmentModules, which rules out dependency cycles,
+// and that the pipeline applies the modules in that order
+func TestTerragruntDependencyOrder(t *testing.T) {
+	t.Parallel()
+
+	for _, environment := range []string{"staging", "production"} {
+		applied := map[string]bool{}
+		for _, module := range environmentModules {
+			for _, dependency := range terragruntDependencies(t, environment, module) {
+				assert.True(t, applied[dependency], "%s %s depends on %s, which is not applied before it", environment, module, dependency)
+			}
+			applied[module] = true
+		}
+	}
+
+	jenkinsfile, err := os.ReadFile(filepath.Join(repoRoot, "Jenkinsfile"))
+	require.NoError(t, err)
+	match := regexp.MustCompile(`MODULE_ORDER = '([^']+)'`).FindSubmatch(jenkinsfile)
+	require.NotNil(t, match, "Jenkinsfile does not set MODULE_ORDER")
+	assert.Equal(t, environmentModules, strings.Split(string(match[1]), ","))
+}
+
+// terragruntFunctions returns the functions available to the terragrunt.hcl
+// files of dir, as terragrunt plan evaluates them before any apply: get_env
+// returns its default and run_cmd is only known when terragrunt runs
+func terragruntFunctions(t *testing.T, dir string) map[string]function.Function {
+	functions := tfmodule.Functions()
+	functions["find_in_parent_folders"] = function.New(&function.Spec{
+		VarParam: &function.Parameter{Name: "name", Type: cty.String},
+		Type:     function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			name := "terragrunt.hcl"
+			if len(args) > 0 {
+				name = args[0].AsString()
+			}
+			for parent := filepath.Dir(dir); parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+				if _, err := os.Stat(filepath.Join(parent, name)); err == nil {
+					return cty.StringVal(filepath.Join(parent, name)), nil
+				}
+			}
+			return cty.NilVal, fmt.Errorf("no %s above %s", name, dir)
+		},
+	})
+	functions["read_terragrunt_config"] = function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "path", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			body := parseTerragrunt(t, args[0].AsString())
+			locals := terragruntLocals(t, body, &hcl.EvalContext{Functions: functions})
+			return cty.ObjectVal(map[string]cty.Value{"locals": locals}), nil
+		},
+	})
+	functions["get_env"] = function.New(&function.Spec{
+		Params:   []function.Parameter{{Name: "name", Type: cty.String}},
+		VarParam: &function.Parameter{Name: "default", Type: cty.DynamicPseudoType, AllowNull: true},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			if len(args) > 1 {
+				return args[1].Type(), nil
+			}
+			return cty.String, nil
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if len(args) > 1 {
+				return args[1], nil
+			}
+			return cty.UnknownVal(retType), nil
+		},
+	})
+	functions["run_cmd"] = function.New(&function.Spec{
+		VarParam: &function.Parameter{Name: "args", Type: cty.String},
+		Type:     function.StaticReturnType(cty.String),
+		Impl: func(_ []cty.Value, _ cty.Type) (cty.Value, error) {
+			return cty.UnknownVal(cty.String), nil
+		},
+	})
+	return functions
+}
+
+// parseTerragrunt parses a terragrunt.hcl file
+func parseTerragrunt(t *testing.T, path string) *hclsyntax.Body {
+	t.Helper()
+
+	src, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	require.False(t, diags.HasErrors(), "%s", diags)
+	return file.Body.(*hclsyntax.Body)
+}
+
+// terragruntLocals evaluates the locals block of body in file order, so a
+// local can use the locals above it
+func terragruntLocals(t *testing.T, body *hclsyntax.Body, ctx *hcl.EvalContext) cty.Value {
+	t.Helper()
+
+	locals := map[string]cty.Value{}
+	for _, block := range body.Blocks {
+		if block.Type != "locals" {
+			continue
+		}
+		attrs := make([]*hclsyntax.Attribute, 0, len(block.Body.Attributes))
+		for _, attr := range block.Body.Attributes {
+			attrs = append(attrs, attr)
+		}
+		sort.Slice(attrs, func(i, j int) bool { return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte })
+		for _, attr := range attrs {
+			child := ctx.NewChild()
+			child.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+			value, diags := attr.Expr.Value(child)
+			require.False(t, diags.HasErrors(), "%s", diags)
+			locals[attr.Name] = value
+		}
+	}
+	return cty.ObjectVal(locals)
+}
+
+// terragruntInputs evaluates the inputs of the root terragrunt.hcl and of
+// environments/us-east-1/<environment>/<module>/terragrunt.hcl, with the
+// dependency outputs replaced by their mock_outputs
+func terragruntInputs(t *testing.T, environment, module string) map[string]cty.Value {
+	t.Helper()
+
+	dir := filepath.Join(repoRoot, "environments", testRegion, environment, module)
+	functions := terragruntFunctions(t, dir)
+	inputs := map[string]cty.Value{}
+	for _, path := range []string{filepath.Join(repoRoot, "terragrunt.hcl"), filepath.Join(dir, "terragrunt.hcl")} {
+		body := parseTerragrunt(t, path)
+		ctx := &hcl.EvalContext{Functions: functions}
+
+		dependencies := map[string]cty.Value{}
+		for _, block := range body.Blocks {
+			if block.Type != "dependency" {
+				continue
+			}
+			attr, ok := block.Body.Attributes["mock_outputs"]
+			require.True(t, ok, "%s: dependency %v has no mock_outputs", path, block.Labels)
+			outputs, diags := attr.Expr.Value(ctx)
+			require.False(t, diags.HasErrors(), "%s", diags)
+			dependencies[block.Labels[0]] = cty.ObjectVal(map[string]cty.Value{"outputs": outputs})
+		}
+		ctx.Variables = map[string]cty.Value{
+			"local":      terragruntLocals(t, body, ctx),
+			"dependency": cty.ObjectVal(dependencies),
+		}
+
+		attr, ok := body.Attributes["inputs"]
+		require.True(t, ok, "%s has no inputs", path)
+		value, diags := attr.Expr.Value(ctx)
+		require.False(t, diags.HasErrors(), "%s", diags)
+		for name, v := range value.AsValueMap() {
+			inputs[name] = v
+		}
+	}
+	return inputs
+}
+
+// generatedInputs lists the inputs the tests generate instead of using the
+// get_env defaults of the terragrunt.hcl files. Inputs only known when
+// terragrunt runs, such as the production AMI looked up with run_cmd, are
+// generated as well.
+var generatedInputs = map[string][]string{
+	"rds":             {"password"},
+	"secrets-manager": {"db_password", "splunk_admin_password", "splunk_hec_token"},
+}
+
+// TestEnvironmentInputsMatchTerragrunt tests that environmentInputs returns
+// the inputs the terragrunt.hcl files pass to the module variables
+func TestEnvironmentInputsMatchTerragrunt(t *testing.T) {
+	t.Parallel()
+
+	for _, environment := range []string{"staging", "production"} {
+		for _, module := range environmentModules {
+			mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", module))
+			require.NoError(t, err)
+
+			generated := generatedInputs[module]
+			want := map[string]interface{}{}
+			for name, value := range terragruntInputs(t, environment, module) {
+				// Terragrunt passes the root inputs to every module, and
+				// terraform ignores those the module does not declare. A
+				// null input leaves the variable to its default.
+				if _, ok := mod.Variable(name); !ok || value.IsNull() {
+					continue
+				}
+				if !value.IsWhollyKnown() {
+					generated = append(generated, name)
+					want[name] = nil
+					continue
+				}
+				src, err := ctyjson.SimpleJSONValue{Value: value}.MarshalJSON()
+				require.NoError(t, err)
+				var v interface{}
+				require.NoError(t, json.Unmarshal(src, &v))
+				want[name] = v
+			}
+
+			src, err := json.Marshal(environmentInputs(t, environment, module))
+			require.NoError(t, err)
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(src, &got))
+
+			for _, name := range generated {
+				assert.Contains(t, want, name, "%s %s", environment, module)
+				assert.Contains(t, got, name, "%s %s", environment, module)
+				delete(want, name)
+				delete(got, name)
+			}
+			assert.Equal(t, want, got, "%s %s", environment, module)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package tfmodule
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// FunctionCall is a function called, directly or through locals, by a
+// resource argument.
+type FunctionCall struct {
+	// Resource is the address of the resource.
+	Resource string
+
+	// Argument is the path of the argument, e.g. "final_snapshot_identifier"
+	// or "root_block_device.tags" for an argument of a nested block.
+	Argument string
+
+	Function string
+
+	// Local is the name of the local the call was found in, or "" when the
+	// argument calls the function itself.
+	Local string
+
+	Range hcl.Range
+}
+
+// FunctionCalls returns every call to one of the named functions made by a
+// resource argument, sorted by resource and argument. Meta-arguments and the
+// lifecycle, provisioner and connection blocks are not included.
+func (m *Module) FunctionCalls(functions ...string) []FunctionCall {
+	wanted := map[string]bool{}
+	for _, name := range functions {
+		wanted[name] = true
+	}
+
+	// Calls made by each local, including the locals it refers to
+	localCalls := map[string][]FunctionCall{}
+	for name, expr := range m.Locals {
+		for _, call := range directCalls(expr, wanted) {
+			call.Local = name
+			localCalls[name] = append(localCalls[name], call)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, expr := range m.Locals {
+			for _, dep := range localRefs(expr) {
+				for _, call := range localCalls[dep] {
+					if !hasCall(localCalls[name], call) {
+						localCalls[name] = append(localCalls[name], call)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	var calls []FunctionCall
+	for _, r := range m.Resources {
+		walkArguments(r.Body, "", func(path string, expr hclsyntax.Expression) {
+			for _, call := range directCalls(expr, wanted) {
+				call.Resource, call.Argument = r.Address(), path
+				calls = append(calls, call)
+			}
+			for _, dep := range localRefs(expr) {
+				for _, call := range localCalls[dep] {
+					call.Resource, call.Argument = r.Address(), path
+					if !hasCall(calls, call) {
+						calls = append(calls, call)
+					}
+				}
+			}
+		})
+	}
+
+	sort.SliceStable(calls, func(i, j int) bool {
+		if calls[i].Resource != calls[j].Resource {
+			return calls[i].Resource < calls[j].Resource
+		}
+		if calls[i].Argument != calls[j].Argument {
+			return calls[i].Argument < calls[j].Argument
+		}
+		return calls[i].Range.Start.Byte < calls[j].Range.Start.Byte
+	})
+	return calls
+}
+
+// Ignores reports whether lifecycle ignore_changes covers every change to the
+// argument at path.
+func (r Resource) Ignores(path string) bool {
+	if r.IgnoreAllChanges {
+		return true
+	}
+	for _, ignored := range r.IgnoreChanges {
+		if path == ignored || strings.HasPrefix(path, ignored+".") || strings.HasPrefix(path, ignored+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Argument is an argument of a resource or of one of its nested blocks.
+type Argument struct {
+	// Path is the argument path as in FunctionCall.Argument.
+	Path string
+
+	Expr hclsyntax.Expression
+}
+
+// Arguments returns the arguments of the resource sorted by path.
+// Meta-arguments and the lifecycle, provisioner and connection blocks are not
+// included.
+func (r Resource) Arguments() []Argument {
+	var args []Argument
+	walkArguments(r.Body, "", func(path string, expr hclsyntax.Expression) {
+		args = append(args, Argument{Path: path, Expr: expr})
+	})
+	sort.SliceStable(args, func(i, j int) bool {
+		if args[i].Path != args[j].Path {
+			return args[i].Path < args[j].Path
+		}
+		return args[i].Expr.Range().Start.Byte < args[j].Expr.Range().Start.Byte
+	})
+	return args
+}
+
+// metaArguments are resource arguments that are not sent to the provider.
+var metaArguments = map[string]bool{
+	"count":      true,
+	"for_each":   true,
+	"depends_on": true,
+	"provider":   true,
+}
+
+// walkArguments calls fn for every argument in body and its nested blocks.
+// Arguments of dynamic blocks are reported under the generated block type.
+func walkArguments(body *hclsyntax.Body, prefix string, fn func(path string, expr hclsyntax.Expression)) {
+	for name, attr := range body.Attributes {
+		if prefix == "" && metaArguments[name] {
+			continue
+		}
+		fn(prefix+name, attr.Expr)
+	}
+
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "lifecycle", "provisioner", "connection":
+			continue
+		case "dynamic":
+			path := prefix + block.Labels[0]
+			if attr, ok := block.Body.Attributes["for_each"]; ok {
+				fn(path, attr.Expr)
+			}
+			for _, content := range nestedBlocks(block.Body, "content") {
+				walkArguments(content.Body, path+".", fn)
+			}
+		default:
+			walkArguments(block.Body, prefix+block.Type+".", fn)
+		}
+	}
+}
+
+// directCalls returns the calls to wanted functions inside expr.
+func directCalls(expr hclsyntax.Expression, wanted map[string]bool) []FunctionCall {
+	var calls []FunctionCall
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && wanted[call.Name] {
+			calls = append(calls, FunctionCall{Function: call.Name, Range: call.Range()})
+		}
+		return nil
+	})
+	return calls
+}
+
+// localRefs returns the names of the locals expr refers to.
+func localRefs(expr hclsyntax.Expression) []string {
+	var names []string
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			names = append(names, attr.Name)
+		}
+	}
+	return names
+}
+
+func hasCall(calls []FunctionCall, call FunctionCall) bool {
+	for _, c := range calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,426 @@
+package tfmodule
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Functions returns the Terraform built-in functions available to CheckConditions.
+// It covers the functions used in variable validations, locals and
+// preconditions; an expression calling any other function fails to evaluate.
+func Functions() map[string]function.Function {
+	return map[string]function.Function{
+		"abs":        stdlib.AbsoluteFunc,
+		"alltrue":    allTrueFunc,
+		"anytrue":    anyTrueFunc,
+		"can":        tryfunc.CanFunc,
+		"ceil":       stdlib.CeilFunc,
+		"cidrhost":   cidrHostFunc,
+		"coalesce":   stdlib.CoalesceFunc,
+		"concat":     stdlib.ConcatFunc,
+		"contains":   stdlib.ContainsFunc,
+		"distinct":   stdlib.DistinctFunc,
+		"element":    stdlib.ElementFunc,
+		"flatten":    stdlib.FlattenFunc,
+		"floor":      stdlib.FloorFunc,
+		"format":     stdlib.FormatFunc,
+		"join":       stdlib.JoinFunc,
+		"jsonencode": stdlib.JSONEncodeFunc,
+		"keys":       stdlib.KeysFunc,
+		"length":     stdlib.LengthFunc,
+		"lookup":     stdlib.LookupFunc,
+		"lower":      stdlib.LowerFunc,
+		"max":        stdlib.MaxFunc,
+		"merge":      stdlib.MergeFunc,
+		"min":        stdlib.MinFunc,
+		"range":      stdlib.RangeFunc,
+		"regex":      stdlib.RegexFunc,
+		"regexall":   stdlib.RegexAllFunc,
+		"replace":    stdlib.ReplaceFunc,
+		"setproduct": stdlib.SetProductFunc,
+		"slice":      stdlib.SliceFunc,
+		"split":      stdlib.SplitFunc,
+		"startswith": startsWithFunc,
+		"substr":     stdlib.SubstrFunc,
+		"tolist":     stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+		"tomap":      stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+		"tonumber":   stdlib.MakeToFunc(cty.Number),
+		"toset":      stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+		"tostring":   stdlib.MakeToFunc(cty.String),
+		"trimspace":  stdlib.TrimSpaceFunc,
+		"try":        tryfunc.TryFunc,
+		"upper":      stdlib.UpperFunc,
+		"values":     stdlib.ValuesFunc,
+	}
+}
+
+// Failure is a condition that did not hold for a set of inputs.
+type Failure struct {
+	// Subject is "var.<name>" for variable validations and the resource
+	// address for preconditions.
+	Subject string
+
+	// Message is the rendered error_message, or the evaluation error when the
+	// condition could not be evaluated.
+	Message string
+
+	Range hcl.Range
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("%s: %s", f.Subject, f.Message)
+}
+
+// CheckConditions evaluates the variable validations and resource
+// preconditions of the module for the given input variables, the way
+// `terraform plan` would before creating any resource. Values are converted
+// to each variable's type and unset variables take their default.
+//
+// Preconditions that refer to anything other than variables and locals are
+// skipped, since their result is only known during a real plan, and so are
+// the preconditions of resources whose count or for_each is empty. A condition
+// that fails to evaluate is reported as a failure, matching Terraform which
+// rejects the plan in that case.
+func (m *Module) CheckConditions(vars map[string]interface{}) ([]Failure, error) {
+	values, failures, err := m.inputValues(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(values)},
+		Functions: Functions(),
+	}
+
+	for _, v := range m.Variables {
+		for _, c := range v.Validations {
+			if f, failed := evalCondition(ctx, "var."+v.Name, c); failed {
+				failures = append(failures, f)
+			}
+		}
+	}
+
+	locals, localFailures := m.evalLocals(ctx)
+	ctx.Variables["local"] = cty.ObjectVal(locals)
+	failures = append(failures, localFailures...)
+
+	for _, r := range m.Resources {
+		if noInstances(ctx, r) {
+			continue
+		}
+		for _, c := range r.Preconditions {
+			if !offline(c.Condition) {
+				continue
+			}
+			if f, failed := evalCondition(ctx, r.Address(), c); failed {
+				failures = append(failures, f)
+			}
+		}
+	}
+
+	return failures, nil
+}
+
+// inputValues converts vars to cty values of the declared variable types.
+// Values that cannot be converted are returned as failures.
+func (m *Module) inputValues(vars map[string]interface{}) (map[string]cty.Value, []Failure, error) {
+	for name := range vars {
+		if _, ok := m.Variable(name); !ok {
+			return nil, nil, fmt.Errorf("module has no variable %q", name)
+		}
+	}
+
+	values := map[string]cty.Value{}
+	var failures []Failure
+
+	for _, v := range m.Variables {
+		raw, ok := vars[v.Name]
+		if !ok {
+			if !v.HasDefault {
+				return nil, nil, fmt.Errorf("required variable %q is not set", v.Name)
+			}
+			raw = v.Default
+		}
+
+		value, err := toValue(raw, v.Type, v.Defaults)
+		if err != nil {
+			failures = append(failures, Failure{
+				Subject: "var." + v.Name,
+				Message: "invalid value: " + err.Error(),
+				Range:   v.Range,
+			})
+			value = cty.UnknownVal(v.Type)
+		}
+		values[v.Name] = value
+	}
+
+	return values, failures, nil
+}
+
+// evalLocals evaluates the locals in dependency order. Locals that refer to
+// resources or data sources are unknown. Locals that fail to evaluate are
+// unknown and returned as failures.
+func (m *Module) evalLocals(ctx *hcl.EvalContext) (map[string]cty.Value, []Failure) {
+	names := make([]string, 0, len(m.Locals))
+	for name := range m.Locals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	locals := map[string]cty.Value{}
+	var failures []Failure
+	for progress := true; progress; {
+		progress = false
+		for _, name := range names {
+			if _, done := locals[name]; done {
+				continue
+			}
+
+			expr := m.Locals[name]
+			ready, external := true, false
+			for _, traversal := range expr.Variables() {
+				switch traversal.RootName() {
+				case "var":
+				case "local":
+					if dep, ok := traversal[1].(hcl.TraverseAttr); ok {
+						if _, done := locals[dep.Name]; !done {
+							ready = false
+						}
+					}
+				default:
+					external = true
+				}
+			}
+			if external {
+				locals[name] = cty.DynamicVal
+				progress = true
+				continue
+			}
+			if !ready {
+				continue
+			}
+
+			ctx.Variables["local"] = cty.ObjectVal(locals)
+			value, diags := expr.Value(ctx)
+			if diags.HasErrors() {
+				failures = append(failures, Failure{Subject: "local." + name, Message: diags.Error(), Range: expr.Range()})
+				value = cty.DynamicVal
+			}
+			locals[name] = value
+			progress = true
+		}
+	}
+
+	// Locals in a reference cycle are left unknown
+	for _, name := range names {
+		if _, done := locals[name]; !done {
+			locals[name] = cty.DynamicVal
+		}
+	}
+	return locals, failures
+}
+
+func evalCondition(ctx *hcl.EvalContext, subject string, c Condition) (Failure, bool) {
+	failure := Failure{Subject: subject, Range: c.Range}
+
+	if c.Condition == nil {
+		failure.Message = "condition is not set"
+		return failure, true
+	}
+
+	result, diags := c.Condition.Value(ctx)
+	if diags.HasErrors() {
+		failure.Message = diags.Error()
+		return failure, true
+	}
+	if !result.IsKnown() {
+		return failure, false
+	}
+	if result.IsNull() || !result.Type().Equals(cty.Bool) {
+		failure.Message = "condition must be a bool"
+		return failure, true
+	}
+	if result.True() {
+		return failure, false
+	}
+
+	failure.Message = "condition failed"
+	if c.ErrorMessage != nil {
+		if msg, diags := c.ErrorMessage.Value(ctx); !diags.HasErrors() && msg.IsKnown() && msg.Type() == cty.String && !msg.IsNull() {
+			failure.Message = msg.AsString()
+		}
+	}
+	return failure, true
+}
+
+// noInstances reports whether the count or for_each of r evaluates to no
+// instances. Terraform does not check the preconditions of such resources.
+func noInstances(ctx *hcl.EvalContext, r Resource) bool {
+	for _, expr := range []hclsyntax.Expression{r.Count, r.ForEach} {
+		if expr == nil || !offline(expr) {
+			continue
+		}
+		v, diags := expr.Value(ctx)
+		if diags.HasErrors() || !v.IsWhollyKnown() || v.IsNull() {
+			continue
+		}
+		switch {
+		case v.Type() == cty.Number:
+			if v.Equals(cty.Zero).True() {
+				return true
+			}
+		case v.CanIterateElements():
+			if v.LengthInt() == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// offline reports whether expr only refers to variables and locals.
+func offline(expr hclsyntax.Expression) bool {
+	if expr == nil {
+		return true
+	}
+	for _, traversal := range expr.Variables() {
+		switch traversal.RootName() {
+		case "var", "local":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// toValue converts a Go value, as passed in terraform.Options.Vars, to a cty
+// value of type ty. Like terraform, it fills in the optional attribute
+// defaults before the conversion.
+func toValue(raw interface{}, ty cty.Type, defaults *typeexpr.Defaults) (cty.Value, error) {
+	if raw == nil {
+		return cty.NullVal(ty), nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	implied, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	value, err := ctyjson.Unmarshal(data, implied)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if defaults != nil {
+		value = defaults.Apply(value)
+	}
+	return convert.Convert(value, ty)
+}
+
+var allTrueFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "list", Type: cty.List(cty.Bool)},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		result := cty.True
+		for it := args[0].ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			if !v.IsKnown() {
+				return cty.UnknownVal(cty.Bool), nil
+			}
+			if v.IsNull() {
+				return cty.False, nil
+			}
+			result = result.And(v)
+		}
+		return result, nil
+	},
+})
+
+var anyTrueFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "list", Type: cty.List(cty.Bool)},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		result := cty.False
+		for it := args[0].ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			if !v.IsKnown() {
+				return cty.UnknownVal(cty.Bool), nil
+			}
+			if v.IsNull() {
+				continue
+			}
+			result = result.Or(v)
+		}
+		return result, nil
+	},
+})
+
+var startsWithFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+		{Name: "prefix", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.BoolVal(strings.HasPrefix(args[0].AsString(), args[1].AsString())), nil
+	},
+})
+
+// cidrHostFunc implements cidrhost. Unlike Terraform it rejects IPv4 octets
+// with leading zeros, which Go's net package no longer parses.
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "hostnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		_, network, err := net.ParseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), fmt.Errorf("invalid CIDR expression: %s", err)
+		}
+		hostnum, accuracy := args[1].AsBigFloat().Int(nil)
+		if accuracy != big.Exact {
+			return cty.UnknownVal(cty.String), fmt.Errorf("hostnum must be a whole number")
+		}
+
+		ones, bits := network.Mask.Size()
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+		if hostnum.Sign() < 0 {
+			hostnum.Add(hostnum, size)
+		}
+		if hostnum.Sign() < 0 || hostnum.Cmp(size) >= 0 {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix of %d does not accommodate a host numbered %s", ones, args[1].AsBigFloat().String())
+		}
+
+		ip := network.IP
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		addr := new(big.Int).SetBytes(ip)
+		addr.Add(addr, hostnum)
+		out := addr.FillBytes(make([]byte, len(ip)))
+
+		return cty.StringVal(net.IP(out).String()), nil
+	},
+})
@@ -0,0 +1,88 @@
+variable "name" {
+  description = "Name prefix"
+  type        = string
+}
+
+variable "enable_nat" {
+  type    = bool
+  default = true
+}
+
+variable "cidrs" {
+  type    = list(string)
+  default = ["10.0.1.0/24", "10.0.2.0/24"]
+
+  validation {
+    condition     = alltrue([for cidr in var.cidrs : can(cidrhost(cidr, 0))])
+    error_message = "cidrs must be CIDR blocks."
+  }
+}
+
+variable "listeners" {
+  type = list(object({
+    port     = number
+    protocol = optional(string, "HTTP")
+  }))
+  default = [{ port = 80 }]
+
+  validation {
+    condition     = alltrue([for listener in var.listeners : contains(["HTTP", "HTTPS"], listener.protocol)])
+    error_message = "listener protocols must be HTTP or HTTPS."
+  }
+}
+
+locals {
+  networks     = [for cidr in var.cidrs : cidrhost(cidr, 0)]
+  subnet_count = length(local.networks)
+  account_id   = data.aws_caller_identity.current.account_id
+}
+
+variable "key_name" {
+  type    = string
+  default = null
+}
+
+variable "password" {
+  type      = string
+  sensitive = true
+}
+
+data "aws_caller_identity" "current" {}
+
+resource "aws_subnet" "public" {
+  count      = length(var.cidrs)
+  cidr_block = var.cidrs[count.index]
+}
+
+resource "aws_nat_gateway" "main" {
+  count = var.enable_nat ? 1 : 0
+
+  lifecycle {
+    precondition {
+      condition     = local.subnet_count > 0
+      error_message = "A NAT gateway needs ${local.subnet_count + 1} subnet."
+    }
+
+    precondition {
+      condition     = local.account_id != ""
+      error_message = "Only known after the plan."
+    }
+  }
+}
+
+resource "aws_secretsmanager_secret" "custom" {
+  for_each = {
+    for k, v in var.custom :
+    k => v
+  }
+  name = "${var.name}-${each.key}"
+}
+
+output "password" {
+  value     = var.password
+  sensitive = true
+}
+
+output "subnet_ids" {
+  value = aws_subnet.public[*].id
+}
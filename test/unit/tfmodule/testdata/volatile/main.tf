@@ -0,0 +1,47 @@
+locals {
+  created_at = timestamp()
+  build_tags = {
+    CreatedAt = local.created_at
+  }
+}
+
+resource "aws_db_instance" "main" {
+  identifier                = "db"
+  final_snapshot_identifier = "db-final-${formatdate("YYYYMMDDhhmm", timestamp())}"
+
+  lifecycle {
+    ignore_changes = [final_snapshot_identifier]
+  }
+}
+
+resource "aws_instance" "app" {
+  count = length(uuid()) > 0 ? 1 : 0
+
+  ami  = "ami-12345678"
+  tags = local.build_tags
+
+  root_block_device {
+    tags = {
+      Token = uuid()
+    }
+  }
+
+  dynamic "ebs_block_device" {
+    for_each = [1]
+    content {
+      device_name = "/dev/sd${substr(uuid(), 0, 1)}"
+    }
+  }
+
+  lifecycle {
+    ignore_changes = [tags["CreatedAt"], root_block_device]
+  }
+}
+
+resource "aws_s3_bucket" "logs" {
+  bucket = "logs-${timestamp()}"
+
+  lifecycle {
+    ignore_changes = all
+  }
+}
@@ -0,0 +1,342 @@
+// Package tfmodule reads the variables, outputs and resources of a Terraform
+// module straight from its .tf files, without running Terraform.
+//
+// It is used by checks that need the module configuration rather than a plan,
+// such as variable defaults, count and for_each expressions or the attributes
+// of a resource block.
+package tfmodule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Module is the parsed configuration of a single module directory.
+type Module struct {
+	Dir       string
+	Variables []Variable
+	Locals    map[string]hclsyntax.Expression
+	Outputs   []Output
+	Resources []Resource
+
+	sources map[string][]byte
+}
+
+// Variable is a variable block.
+type Variable struct {
+	Name      string
+	Sensitive bool
+
+	// HasDefault is false for required variables.
+	HasDefault bool
+
+	// Default is the default value decoded as JSON (nil for null).
+	Default interface{}
+
+	// Type is the type constraint, cty.DynamicPseudoType when it is "any",
+	// omitted or not understood.
+	Type cty.Type
+
+	// Defaults holds the optional(type, default) attribute defaults of Type,
+	// nil when there are none.
+	Defaults *typeexpr.Defaults
+
+	Validations []Condition
+	Range       hcl.Range
+}
+
+// Condition is a validation, precondition or postcondition block.
+type Condition struct {
+	Condition    hclsyntax.Expression
+	ErrorMessage hclsyntax.Expression
+	Range        hcl.Range
+}
+
+// Output is an output block.
+type Output struct {
+	Name      string
+	Sensitive bool
+	Value     hclsyntax.Expression
+	Range     hcl.Range
+}
+
+// Resource is a resource or data block.
+type Resource struct {
+	// Mode is "managed" for resource blocks and "data" for data blocks.
+	Mode string
+	Type string
+	Name string
+
+	// Count and ForEach are nil when the meta-argument is not set.
+	Count   hclsyntax.Expression
+	ForEach hclsyntax.Expression
+
+	// Preconditions are the precondition blocks of the lifecycle block.
+	Preconditions []Condition
+
+	// IgnoreChanges lists the lifecycle ignore_changes paths, e.g. "ami" or
+	// "tags.Owner". IgnoreAllChanges is set for ignore_changes = all.
+	IgnoreChanges    []string
+	IgnoreAllChanges bool
+
+	Body  *hclsyntax.Body
+	Range hcl.Range
+}
+
+// Address returns the resource address without an instance key, e.g.
+// "aws_nat_gateway.main" or "data.aws_caller_identity.current".
+func (r Resource) Address() string {
+	if r.Mode == "data" {
+		return "data." + r.Type + "." + r.Name
+	}
+	return r.Type + "." + r.Name
+}
+
+// Load parses every .tf file in dir. Override files are not supported.
+func Load(dir string) (*Module, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .tf files in %s", dir)
+	}
+	sort.Strings(files)
+
+	m := &Module{Dir: dir, Locals: map[string]hclsyntax.Expression{}, sources: map[string][]byte{}}
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		m.sources[path] = src
+
+		if err := m.decode(file.Body.(*hclsyntax.Body)); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Module) decode(body *hclsyntax.Body) error {
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "variable":
+			v, err := decodeVariable(block)
+			if err != nil {
+				return err
+			}
+			m.Variables = append(m.Variables, v)
+
+		case "locals":
+			for name, attr := range block.Body.Attributes {
+				m.Locals[name] = attr.Expr
+			}
+
+		case "output":
+			m.Outputs = append(m.Outputs, Output{
+				Name:      block.Labels[0],
+				Sensitive: isTrue(block.Body.Attributes["sensitive"]),
+				Value:     expression(block.Body.Attributes["value"]),
+				Range:     block.DefRange(),
+			})
+
+		case "resource", "data":
+			mode := "managed"
+			if block.Type == "data" {
+				mode = "data"
+			}
+			ignored, all := ignoreChanges(nestedBlocks(block.Body, "lifecycle"))
+			m.Resources = append(m.Resources, Resource{
+				Mode:             mode,
+				Type:             block.Labels[0],
+				Name:             block.Labels[1],
+				Count:            expression(block.Body.Attributes["count"]),
+				ForEach:          expression(block.Body.Attributes["for_each"]),
+				Preconditions:    conditions(nestedBlocks(block.Body, "lifecycle"), "precondition"),
+				IgnoreChanges:    ignored,
+				IgnoreAllChanges: all,
+				Body:             block.Body,
+				Range:            block.DefRange(),
+			})
+		}
+	}
+	return nil
+}
+
+func decodeVariable(block *hclsyntax.Block) (Variable, error) {
+	v := Variable{
+		Name:        block.Labels[0],
+		Sensitive:   isTrue(block.Body.Attributes["sensitive"]),
+		Type:        cty.DynamicPseudoType,
+		Validations: conditions([]*hclsyntax.Block{block}, "validation"),
+		Range:       block.DefRange(),
+	}
+
+	if attr, ok := block.Body.Attributes["type"]; ok {
+		if ty, defaults, diags := typeexpr.TypeConstraintWithDefaults(attr.Expr); !diags.HasErrors() {
+			v.Type = ty
+			v.Defaults = defaults
+		}
+	}
+
+	attr, ok := block.Body.Attributes["default"]
+	if !ok {
+		return v, nil
+	}
+	v.HasDefault = true
+
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return v, fmt.Errorf("variable %q: %w", v.Name, diags)
+	}
+	if value.IsNull() {
+		return v, nil
+	}
+
+	data, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return v, fmt.Errorf("variable %q: %w", v.Name, err)
+	}
+	if err := json.Unmarshal(data, &v.Default); err != nil {
+		return v, fmt.Errorf("variable %q: %w", v.Name, err)
+	}
+	return v, nil
+}
+
+// Variable returns the variable with the given name.
+func (m *Module) Variable(name string) (Variable, bool) {
+	for _, v := range m.Variables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variable{}, false
+}
+
+// Resource returns the resource or data source with the given address.
+func (m *Module) Resource(address string) (Resource, bool) {
+	for _, r := range m.Resources {
+		if r.Address() == address {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+// Source returns the configuration text of rng, e.g. of an expression, with
+// runs of whitespace collapsed to a single space.
+func (m *Module) Source(rng hcl.Range) string {
+	src, ok := m.sources[rng.Filename]
+	if !ok {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(rng.SliceBytes(src))), " ")
+}
+
+// nestedBlocks returns the blocks of the given type directly inside body.
+func nestedBlocks(body *hclsyntax.Body, blockType string) []*hclsyntax.Block {
+	var blocks []*hclsyntax.Block
+	for _, block := range body.Blocks {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// conditions decodes the condition blocks of the given type inside parents.
+func conditions(parents []*hclsyntax.Block, blockType string) []Condition {
+	var result []Condition
+	for _, parent := range parents {
+		for _, block := range nestedBlocks(parent.Body, blockType) {
+			result = append(result, Condition{
+				Condition:    expression(block.Body.Attributes["condition"]),
+				ErrorMessage: expression(block.Body.Attributes["error_message"]),
+				Range:        block.DefRange(),
+			})
+		}
+	}
+	return result
+}
+
+// ignoreChanges decodes ignore_changes from lifecycle blocks.
+func ignoreChanges(lifecycles []*hclsyntax.Block) ([]string, bool) {
+	var paths []string
+	for _, lifecycle := range lifecycles {
+		attr, ok := lifecycle.Body.Attributes["ignore_changes"]
+		if !ok {
+			continue
+		}
+		if hcl.ExprAsKeyword(attr.Expr) == "all" {
+			return nil, true
+		}
+		exprs, diags := hcl.ExprList(attr.Expr)
+		if diags.HasErrors() {
+			continue
+		}
+		for _, expr := range exprs {
+			traversal, diags := hcl.AbsTraversalForExpr(expr)
+			if diags.HasErrors() {
+				continue
+			}
+			paths = append(paths, traversalPath(traversal))
+		}
+	}
+	return paths, false
+}
+
+// traversalPath renders a traversal as an attribute path such as
+// "tags.Owner" or "ingress[0]".
+func traversalPath(traversal hcl.Traversal) string {
+	var b strings.Builder
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			b.WriteString(s.Name)
+		case hcl.TraverseAttr:
+			b.WriteString("." + s.Name)
+		case hcl.TraverseIndex:
+			if s.Key.Type() == cty.String {
+				fmt.Fprintf(&b, "[%q]", s.Key.AsString())
+			} else {
+				fmt.Fprintf(&b, "[%s]", s.Key.AsBigFloat().String())
+			}
+		}
+	}
+	return b.String()
+}
+
+func expression(attr *hclsyntax.Attribute) hclsyntax.Expression {
+	if attr == nil {
+		return nil
+	}
+	return attr.Expr
+}
+
+func isTrue(attr *hclsyntax.Attribute) bool {
+	if attr == nil {
+		return false
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || value.Type() != cty.Bool || value.IsNull() || !value.IsKnown() {
+		return false
+	}
+	return value.True()
+}
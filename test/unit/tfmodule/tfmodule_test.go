@@ -0,0 +1,261 @@
+package tfmodule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TestLoadFixture tests variables, outputs and resources of a fixture module
+func TestLoadFixture(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load(filepath.Join("testdata", "simple"))
+	require.NoError(t, err)
+
+	name, ok := mod.Variable("name")
+	require.True(t, ok)
+	assert.False(t, name.HasDefault)
+
+	enableNat, _ := mod.Variable("enable_nat")
+	assert.True(t, enableNat.HasDefault)
+	assert.Equal(t, true, enableNat.Default)
+
+	cidrs, _ := mod.Variable("cidrs")
+	assert.Equal(t, []interface{}{"10.0.1.0/24", "10.0.2.0/24"}, cidrs.Default)
+
+	key, _ := mod.Variable("key_name")
+	assert.True(t, key.HasDefault)
+	assert.Nil(t, key.Default)
+
+	password, _ := mod.Variable("password")
+	assert.True(t, password.Sensitive)
+
+	require.Len(t, mod.Outputs, 2)
+	assert.True(t, mod.Outputs[0].Sensitive)
+	assert.False(t, mod.Outputs[1].Sensitive)
+
+	caller, ok := mod.Resource("data.aws_caller_identity.current")
+	require.True(t, ok)
+	assert.Nil(t, caller.Count)
+	assert.Nil(t, caller.ForEach)
+
+	natGateway, ok := mod.Resource("aws_nat_gateway.main")
+	require.True(t, ok)
+	require.NotNil(t, natGateway.Count)
+	assert.Equal(t, "var.enable_nat ? 1 : 0", mod.Source(natGateway.Count.Range()))
+
+	custom, _ := mod.Resource("aws_secretsmanager_secret.custom")
+	require.NotNil(t, custom.ForEach)
+	assert.Equal(t, "{ for k, v in var.custom : k => v }", mod.Source(custom.ForEach.Range()))
+}
+
+// TestLoadRepositoryModules tests that every module in the repository parses
+func TestLoadRepositoryModules(t *testing.T) {
+	t.Parallel()
+
+	dirs, err := filepath.Glob(filepath.Join("..", "..", "..", "modules", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		mod, err := Load(dir)
+		require.NoError(t, err, dir)
+		assert.NotEmpty(t, mod.Variables, dir)
+		assert.NotEmpty(t, mod.Resources, dir)
+	}
+}
+
+// TestLoadEmptyDir tests that a directory without configuration is an error
+func TestLoadEmptyDir(t *testing.T) {
+	t.Parallel()
+
+	_, err := Load(t.TempDir())
+	assert.Error(t, err)
+}
+
+// TestCheckConditions tests validations and preconditions against inputs
+func TestCheckConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load(filepath.Join("testdata", "simple"))
+	require.NoError(t, err)
+
+	natGateway, _ := mod.Resource("aws_nat_gateway.main")
+	require.Len(t, natGateway.Preconditions, 2)
+
+	testCases := []struct {
+		name     string
+		vars     map[string]interface{}
+		failures []string
+	}{
+		{
+			name:     "Defaults",
+			vars:     map[string]interface{}{"name": "gogs", "password": "secret"},
+			failures: nil,
+		},
+		{
+			name:     "InvalidCIDR",
+			vars:     map[string]interface{}{"name": "gogs", "password": "secret", "cidrs": []string{"10.0.1.0/24", "10.0.2.0"}},
+			failures: []string{"var.cidrs: cidrs must be CIDR blocks.", "local.networks"},
+		},
+		{
+			name:     "PreconditionFails",
+			vars:     map[string]interface{}{"name": "gogs", "password": "secret", "cidrs": []string{}},
+			failures: []string{"aws_nat_gateway.main: A NAT gateway needs 1 subnet."},
+		},
+		{
+			name:     "PreconditionSkipped",
+			vars:     map[string]interface{}{"name": "gogs", "password": "secret", "cidrs": []string{}, "enable_nat": false},
+			failures: nil,
+		},
+		{
+			name:     "OptionalAttributeDefault",
+			vars:     map[string]interface{}{"name": "gogs", "password": "secret", "listeners": []map[string]interface{}{{"port": 80}, {"port": 443, "protocol": "HTTPS"}}},
+			failures: nil,
+		},
+		{
+			name:     "InvalidOptionalAttribute",
+			vars:     map[string]interface{}{"name": "gogs", "password": "secret", "listeners": []map[string]interface{}{{"port": 443, "protocol": "TLS"}}},
+			failures: []string{"var.listeners: listener protocols must be HTTP or HTTPS."},
+		},
+		{
+			name:     "InvalidType",
+			vars:     map[string]interface{}{"name": "gogs", "password": "secret", "enable_nat": "maybe"},
+			failures: []string{"var.enable_nat: invalid value"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			failures, err := mod.CheckConditions(tc.vars)
+			require.NoError(t, err)
+
+			var got []string
+			for _, f := range failures {
+				got = append(got, f.String())
+			}
+			require.Len(t, got, len(tc.failures), "%v", got)
+			for i, want := range tc.failures {
+				assert.Contains(t, got[i], want)
+			}
+		})
+	}
+}
+
+// TestCheckConditionsUnknownVariable tests that inputs must match the module
+func TestCheckConditionsUnknownVariable(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load(filepath.Join("testdata", "simple"))
+	require.NoError(t, err)
+
+	_, err = mod.CheckConditions(map[string]interface{}{"name": "gogs", "password": "secret", "nmae": "typo"})
+	assert.ErrorContains(t, err, `no variable "nmae"`)
+
+	_, err = mod.CheckConditions(map[string]interface{}{"password": "secret"})
+	assert.ErrorContains(t, err, `required variable "name"`)
+}
+
+// TestCidrHost tests the cidrhost implementation
+func TestCidrHost(t *testing.T) {
+	t.Parallel()
+
+	host := func(prefix string, hostnum int64) (string, error) {
+		v, err := cidrHostFunc.Call([]cty.Value{cty.StringVal(prefix), cty.NumberIntVal(hostnum)})
+		if err != nil {
+			return "", err
+		}
+		return v.AsString(), nil
+	}
+
+	for _, tc := range []struct {
+		prefix  string
+		hostnum int64
+		want    string
+	}{
+		{"10.0.1.7/24", 0, "10.0.1.0"},
+		{"10.0.0.0/16", 5, "10.0.0.5"},
+		{"10.0.0.0/16", -1, "10.0.255.255"},
+		{"10.12.112.0/20", 268, "10.12.113.12"},
+		{"fd00:fd12:3456:7890::/56", 34, "fd00:fd12:3456:7800::22"},
+	} {
+		got, err := host(tc.prefix, tc.hostnum)
+		require.NoError(t, err, tc.prefix)
+		assert.Equal(t, tc.want, got, tc.prefix)
+	}
+
+	_, err := host("10.0.0.0/30", 4)
+	assert.Error(t, err)
+	_, err = host("10.0.0.0", 0)
+	assert.Error(t, err)
+}
+
+// TestFunctionCalls tests finding volatile calls and ignore_changes coverage
+func TestFunctionCalls(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load(filepath.Join("testdata", "volatile"))
+	require.NoError(t, err)
+
+	type found struct {
+		Argument string
+		Function string
+		Local    string
+		Ignored  bool
+	}
+	var got []found
+	for _, call := range mod.FunctionCalls("timestamp", "uuid") {
+		r, ok := mod.Resource(call.Resource)
+		require.True(t, ok)
+		got = append(got, found{call.Resource + " " + call.Argument, call.Function, call.Local, r.Ignores(call.Argument)})
+	}
+
+	// count is a meta-argument and is not sent to the provider
+	assert.Equal(t, []found{
+		{"aws_db_instance.main final_snapshot_identifier", "timestamp", "", true},
+		{"aws_instance.app ebs_block_device.device_name", "uuid", "", false},
+		{"aws_instance.app root_block_device.tags", "uuid", "", true},
+		{"aws_instance.app tags", "timestamp", "created_at", false},
+		{"aws_s3_bucket.logs bucket", "timestamp", "", true},
+	}, got)
+
+	app, _ := mod.Resource("aws_instance.app")
+	assert.Equal(t, []string{`tags["CreatedAt"]`, "root_block_device"}, app.IgnoreChanges)
+	assert.True(t, app.Ignores(`tags["CreatedAt"]`))
+	assert.False(t, app.Ignores("tags"))
+}
+
+// TestResourceArguments tests the argument paths of a resource
+func TestResourceArguments(t *testing.T) {
+	t.Parallel()
+
+	mod, err := Load(filepath.Join("testdata", "volatile"))
+	require.NoError(t, err)
+
+	app, ok := mod.Resource("aws_instance.app")
+	require.True(t, ok)
+
+	var paths []string
+	for _, arg := range app.Arguments() {
+		paths = append(paths, arg.Path)
+	}
+	assert.Equal(t, []string{
+		"ami",
+		"ebs_block_device",
+		"ebs_block_device.device_name",
+		"root_block_device.tags",
+		"tags",
+	}, paths)
+}
@@ -1,10 +1,20 @@
 package test
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EzequielAndreus/gogs-fork-infrastructure-aws/test/tfmodule"
 )
 
 // TestVpcModuleVariablesValidation validates that the VPC module has required variables
@@ -50,6 +60,7 @@ func TestVpcModuleCIDRValidation(t *testing.T) {
 		vpcCIDR            string
 		publicSubnetCIDRs  []string
 		privateSubnetCIDRs []string
+		availabilityZones  []string
 		shouldFail         bool
 	}{
 		{
@@ -57,6 +68,7 @@ func TestVpcModuleCIDRValidation(t *testing.T) {
 			vpcCIDR:            "10.0.0.0/16",
 			publicSubnetCIDRs:  []string{"10.0.1.0/24", "10.0.2.0/24"},
 			privateSubnetCIDRs: []string{"10.0.10.0/24", "10.0.11.0/24"},
+			availabilityZones:  []string{"us-east-1a", "us-east-1b"},
 			shouldFail:         false,
 		},
 		{
@@ -64,6 +76,7 @@ func TestVpcModuleCIDRValidation(t *testing.T) {
 			vpcCIDR:            "172.16.0.0/20",
 			publicSubnetCIDRs:  []string{"172.16.0.0/24", "172.16.1.0/24"},
 			privateSubnetCIDRs: []string{"172.16.2.0/24", "172.16.3.0/24"},
+			availabilityZones:  []string{"us-east-1a", "us-east-1b"},
 			shouldFail:         false,
 		},
 		{
@@ -71,6 +84,7 @@ func TestVpcModuleCIDRValidation(t *testing.T) {
 			vpcCIDR:            "192.168.0.0/16",
 			publicSubnetCIDRs:  []string{"192.168.1.0/24"},
 			privateSubnetCIDRs: []string{"192.168.10.0/24"},
+			availabilityZones:  []string{"us-east-1a"},
 			shouldFail:         false,
 		},
 	}
@@ -88,7 +102,7 @@ func TestVpcModuleCIDRValidation(t *testing.T) {
 					"vpc_cidr":             tc.vpcCIDR,
 					"public_subnet_cidrs":  tc.publicSubnetCIDRs,
 					"private_subnet_cidrs": tc.privateSubnetCIDRs,
-					"availability_zones":   []string{"us-east-1a", "us-east-1b"},
+					"availability_zones":   tc.availabilityZones,
 					"enable_nat_gateway":   false,
 					"tags":                 map[string]string{},
 				},
@@ -180,3 +194,892 @@ func TestVpcModuleTagging(t *testing.T) {
 	result := terraform.Validate(t, terraformOptions)
 	assert.NotNil(t, result)
 }
+
+// vpcCIDRProblems checks a VPC layout independently of the module and returns
+// why it is invalid: CIDR blocks must be IPv4 without host bits set, between
+// /16 and /28 as AWS requires, with one public and one private subnet per
+// availability zone, inside the VPC and not overlapping each other
+func vpcCIDRProblems(vpcCIDR string, public, private, zones []string) []string {
+	var problems []string
+
+	parse := func(name, cidr string) (netip.Prefix, bool) {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil || !prefix.Addr().Is4() || prefix.String() != cidr {
+			problems = append(problems, fmt.Sprintf("%s %q is not an IPv4 CIDR block", name, cidr))
+			return netip.Prefix{}, false
+		}
+		if prefix != prefix.Masked() {
+			problems = append(problems, fmt.Sprintf("%s %q has host bits set", name, cidr))
+		}
+		if prefix.Bits() < 16 || prefix.Bits() > 28 {
+			problems = append(problems, fmt.Sprintf("%s %q is not between /16 and /28", name, cidr))
+		}
+		return prefix, true
+	}
+
+	if len(zones) == 0 {
+		problems = append(problems, "no availability zones")
+	}
+	if len(public) != len(zones) || len(private) != len(zones) {
+		problems = append(problems, fmt.Sprintf("%d public and %d private subnets for %d zones", len(public), len(private), len(zones)))
+	}
+
+	vpc, vpcOK := parse("vpc_cidr", vpcCIDR)
+
+	var subnets []netip.Prefix
+	for _, cidr := range append(append([]string{}, public...), private...) {
+		if subnet, ok := parse("subnet", cidr); ok {
+			subnets = append(subnets, subnet.Masked())
+		}
+	}
+
+	for i, a := range subnets {
+		if vpcOK && (a.Bits() < vpc.Bits() || !vpc.Masked().Contains(a.Addr())) {
+			problems = append(problems, fmt.Sprintf("subnet %s is outside %s", a, vpc))
+		}
+		for _, b := range subnets[i+1:] {
+			if a.Overlaps(b) {
+				problems = append(problems, fmt.Sprintf("subnets %s and %s overlap", a, b))
+			}
+		}
+	}
+
+	return problems
+}
+
+// vpcCIDRInputs returns the VPC module variables of a layout
+func vpcCIDRInputs(vpcCIDR string, public, private, zones []string) map[string]interface{} {
+	return map[string]interface{}{
+		"project_name":         testProjectName,
+		"environment":          "test",
+		"vpc_cidr":             vpcCIDR,
+		"public_subnet_cidrs":  public,
+		"private_subnet_cidrs": private,
+		"availability_zones":   zones,
+	}
+}
+
+// checkVpcCIDRs verifies that the module validation and preconditions reject
+// exactly the layouts vpcCIDRProblems finds invalid. The conditions are
+// evaluated by tfmodule, not by terraform; TestVpcCIDRSeedsTerraform replays
+// the seed corpus through terraform plan.
+func checkVpcCIDRs(t *testing.T, module *tfmodule.Module, vpcCIDR string, public, private, zones []string) {
+	t.Helper()
+
+	problems := vpcCIDRProblems(vpcCIDR, public, private, zones)
+
+	failures, err := module.CheckConditions(vpcCIDRInputs(vpcCIDR, public, private, zones))
+	require.NoError(t, err)
+
+	if len(problems) == 0 {
+		assert.Empty(t, failures, "module rejects valid layout vpc=%q public=%q private=%q zones=%q", vpcCIDR, public, private, zones)
+	} else {
+		assert.NotEmpty(t, failures, "module accepts invalid layout vpc=%q public=%q private=%q zones=%q: %v", vpcCIDR, public, private, zones, problems)
+	}
+}
+
+// availabilityZones returns the first n zones of the test region
+func availabilityZones(n int) []string {
+	zones := []string{}
+	for i := 0; i < n; i++ {
+		zones = append(zones, fmt.Sprintf("%s%c", testRegion, 'a'+i))
+	}
+	return zones
+}
+
+// splitCIDRs splits a comma-separated list, returning an empty list for ""
+func splitCIDRs(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// vpcCIDRSeeds is the seed corpus of FuzzVpcCIDRStrings: the staging and
+// production layouts, then valid and invalid edge cases
+var vpcCIDRSeeds = []struct {
+	vpc, public, private string
+	zones                uint8
+}{
+	{"10.0.0.0/16", "10.0.1.0/24,10.0.2.0/24", "10.0.10.0/24,10.0.11.0/24", 2},
+	{"10.1.0.0/16", "10.1.1.0/24,10.1.2.0/24", "10.1.10.0/24,10.1.11.0/24", 2},
+	{"192.168.0.0/16", "192.168.1.0/24", "192.168.10.0/24", 1},
+	{"172.16.0.0/20", "172.16.0.0/24,172.16.1.0/24", "172.16.2.0/24,172.16.3.0/24", 2},
+	{"10.0.0.0/28", "10.0.0.0/28", "10.0.0.0/28", 1},
+	{"10.0.0.0/12", "10.0.1.0/24", "10.0.2.0/24", 1},
+	{"10.0.0.0/16", "10.0.1.0/29", "10.0.2.0/24", 1},
+	{"10.0.0.0/16", "10.0.1.0/24", "10.1.1.0/24", 1},
+	{"10.0.0.0/16", "10.0.0.0/17", "10.0.1.0/24", 1},
+	{"10.0.0.0/16", "10.0.1.0/24,10.0.2.0/24", "10.0.10.0/24", 2},
+	{"10.0.0.0/16", "", "", 0},
+	{"10.0.01.0/16", "10.0.1.0/24", "10.0.2.0/24", 1},
+	{"10.0.0.0/016", "10.0.1.0/24", "10.0.2.0/24", 1},
+	{"fd00::/48", "10.0.1.0/24", "10.0.2.0/24", 1},
+	{"10.0.0.0", "10.0.1.0/24 ", "10.0.2.0/24", 1},
+	{"10.0.0.5/16", "10.0.1.0/24", "10.0.2.0/24", 1},
+	{"10.0.0.0/16", "10.0.1.5/24", "10.0.2.0/24", 1},
+	{"10.0.0.0/16", "10.0.1.0/24", "10.0.2.128/24", 1},
+}
+
+// FuzzVpcCIDRStrings fuzzes the raw CIDR strings passed to the VPC module
+func FuzzVpcCIDRStrings(f *testing.F) {
+	module, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "vpc"))
+	require.NoError(f, err)
+
+	for _, seed := range vpcCIDRSeeds {
+		f.Add(seed.vpc, seed.public, seed.private, seed.zones)
+	}
+
+	f.Fuzz(func(t *testing.T, vpcCIDR, public, private string, zones uint8) {
+		publicCIDRs, privateCIDRs := splitCIDRs(public), splitCIDRs(private)
+		if len(publicCIDRs)+len(privateCIDRs) > 12 {
+			t.Skip("too many subnets")
+		}
+
+		checkVpcCIDRs(t, module, vpcCIDR, publicCIDRs, privateCIDRs, availabilityZones(int(zones%5)))
+	})
+}
+
+// TestVpcCIDRSeedsTerraform tests that terraform plan rejects exactly the
+// seeds of FuzzVpcCIDRStrings that vpcCIDRProblems finds invalid, so that the
+// fuzz targets, which evaluate the module with tfmodule, are checked against
+// terraform itself
+func TestVpcCIDRSeedsTerraform(t *testing.T) {
+	t.Parallel()
+	skipWithoutTerraform(t)
+
+	options := moduleOptions(t, "vpc", defaultTags("test"), nil)
+	terraform.Init(t, options)
+
+	for _, seed := range vpcCIDRSeeds {
+		public, private := splitCIDRs(seed.public), splitCIDRs(seed.private)
+		zones := availabilityZones(int(seed.zones % 5))
+		problems := vpcCIDRProblems(seed.vpc, public, private, zones)
+
+		rejected := terraformRejects(t, options, vpcCIDRInputs(seed.vpc, public, private, zones))
+		assert.Equal(t, len(problems) > 0, rejected, "vpc=%q public=%q private=%q zones=%q: %v", seed.vpc, public, private, zones, problems)
+	}
+}
+
+// FuzzVpcSubnetLayout fuzzes subnets carved out of the VPC range, so that
+// valid, overlapping and out-of-range layouts are all generated often
+func FuzzVpcSubnetLayout(f *testing.F) {
+	module, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "vpc"))
+	require.NoError(f, err)
+
+	f.Add(uint32(0x0a000000), uint8(4), uint8(1), []byte{8, 0, 1, 8, 0, 2, 8, 0, 10, 8, 0, 11})
+	f.Add(uint32(0xac100000), uint8(8), uint8(2), []byte{4, 0, 0, 4, 0, 1, 4, 0, 2, 4, 0, 3, 4, 0, 4, 4, 0, 5})
+	f.Add(uint32(0x0a000000), uint8(4), uint8(1), []byte{8, 0, 1, 8, 0, 1})
+	f.Add(uint32(0x0a000000), uint8(4), uint8(0), []byte{0, 0, 0, 8, 0, 1})
+	f.Add(uint32(0x0a000000), uint8(4), uint8(0), []byte{200, 0, 1, 8, 0, 2})
+	f.Add(uint32(0xc0a80000), uint8(16), uint8(0x40), []byte{1, 0, 0, 1, 0, 1})
+
+	f.Fuzz(func(t *testing.T, vpcAddr uint32, vpcBits, zones uint8, layout []byte) {
+		// VPC prefix lengths from /12 to /31, so sizes outside /16-/28 occur
+		bits := 12 + int(vpcBits%20)
+		vpc := netip.PrefixFrom(netip.AddrFrom4([4]byte{byte(vpcAddr >> 24), byte(vpcAddr >> 16), byte(vpcAddr >> 8), byte(vpcAddr)}), bits).Masked()
+
+		zoneCount := int(zones%4) + 1
+		publicCount, privateCount := zoneCount, zoneCount
+		if zones&0x40 != 0 {
+			publicCount--
+		}
+		if zones&0x80 != 0 {
+			privateCount++
+		}
+
+		subnet := func(i int) string {
+			if len(layout) == 0 {
+				layout = []byte{8, 0, 0}
+			}
+			b := func(k int) byte { return layout[(3*i+k)%len(layout)] }
+
+			// One bit shorter than the VPC up to 12 bits longer
+			subnetBits := bits + int(b(0)%14) - 1
+			if subnetBits > 32 {
+				subnetBits = 32
+			}
+			netnum := uint64(b(1))<<8 | uint64(b(2))
+			addr := uint64(vpc.Addr().As4()[0])<<24 | uint64(vpc.Addr().As4()[1])<<16 | uint64(vpc.Addr().As4()[2])<<8 | uint64(vpc.Addr().As4()[3])
+			addr += netnum << (32 - subnetBits)
+			if b(0) >= 200 {
+				// Move the subnet past the end of the VPC
+				addr += 1 << (32 - bits)
+			}
+			addr &= 0xffffffff
+
+			prefix := netip.PrefixFrom(netip.AddrFrom4([4]byte{byte(addr >> 24), byte(addr >> 16), byte(addr >> 8), byte(addr)}), subnetBits).Masked()
+			return prefix.String()
+		}
+
+		public, private := []string{}, []string{}
+		for i := 0; i < publicCount; i++ {
+			public = append(public, subnet(i))
+		}
+		for i := 0; i < privateCount; i++ {
+			private = append(private, subnet(publicCount+i))
+		}
+
+		checkVpcCIDRs(t, module, vpc.String(), public, private, availabilityZones(zoneCount))
+	})
+}
+
+// vpcNATCases are the NAT gateway modes with the NAT gateways and private
+// route tables they create for the zones
+var vpcNATCases = []struct {
+	name          string
+	mode          string
+	zones         int
+	natGateways   int
+	privateTables int
+}{
+	{name: "None", mode: "none", zones: 2, natGateways: 0, privateTables: 1},
+	{name: "Single", mode: "single", zones: 2, natGateways: 1, privateTables: 1},
+	{name: "PerAZ", mode: "per_az", zones: 2, natGateways: 2, privateTables: 2},
+	{name: "PerAZThreeZones", mode: "per_az", zones: 3, natGateways: 3, privateTables: 3},
+}
+
+// vpcNATInputs returns VPC inputs with one public and one private subnet in
+// each of the first zones of the test region
+func vpcNATInputs(t *testing.T, mode string, zones int) map[string]interface{} {
+	t.Helper()
+
+	vars := environmentInputs(t, "production", "vpc")
+	public, private := []string{}, []string{}
+	for i := 0; i < zones; i++ {
+		public = append(public, fmt.Sprintf("10.1.%d.0/24", i+1))
+		private = append(private, fmt.Sprintf("10.1.%d.0/24", i+10))
+	}
+	vars["public_subnet_cidrs"] = public
+	vars["private_subnet_cidrs"] = private
+	vars["availability_zones"] = availabilityZones(zones)
+	vars["nat_gateway_mode"] = mode
+	return vars
+}
+
+// TestVpcModuleNATGatewayModeConditions tests the nat_gateway_mode validation
+// and its fallback to enable_nat_gateway without running terraform
+func TestVpcModuleNATGatewayModeConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "vpc"))
+	require.NoError(t, err)
+
+	for _, mode := range []interface{}{"none", "single", "per_az", nil} {
+		for _, enable := range []bool{true, false} {
+			vars := vpcNATInputs(t, "", 2)
+			vars["nat_gateway_mode"] = mode
+			vars["enable_nat_gateway"] = enable
+
+			failures, err := mod.CheckConditions(vars)
+			require.NoError(t, err)
+			assert.Empty(t, failures, "nat_gateway_mode=%v enable_nat_gateway=%t", mode, enable)
+		}
+	}
+
+	for _, mode := range []string{"multi_az", "PER_AZ", "per-az"} {
+		failures, err := mod.CheckConditions(vpcNATInputs(t, mode, 2))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, "var.nat_gateway_mode", mode)
+	}
+}
+
+// plannedRoutes returns the number of routes planned for a route table. The
+// NAT gateway ID is unknown until apply, which can make the whole route set
+// unknown, in which case known is false.
+func plannedRoutes(t *testing.T, plan *terraform.PlanStruct, address string) (routes int, known bool) {
+	t.Helper()
+
+	change := plan.ResourceChangesMap[address]
+	require.NotNil(t, change, "%s is not planned", address)
+
+	if unknown, ok := change.Change.AfterUnknown.(map[string]interface{}); ok && unknown["route"] == true {
+		return 0, false
+	}
+	after, _ := change.Change.After.(map[string]interface{})
+	list, _ := after["route"].([]interface{})
+	return len(list), true
+}
+
+// TestVpcModuleNATGatewayModes tests the NAT gateways, EIPs and private route
+// tables planned for each mode, and that gateway and route table i are named
+// after zone i
+func TestVpcModuleNATGatewayModes(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range vpcNATCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			plan := planModule(t, "vpc", "production", vpcNATInputs(t, tc.mode, tc.zones))
+			zones := availabilityZones(tc.zones)
+
+			natGateways := resourceAddresses(plan, "aws_nat_gateway")
+			assert.Len(t, natGateways, tc.natGateways)
+			assert.Len(t, resourceAddresses(plan, "aws_eip"), tc.natGateways)
+			assert.Len(t, resourceAddresses(plan, "aws_route_table_association"), 2*tc.zones)
+
+			for i := 0; i < tc.natGateways; i++ {
+				nat := plan.ResourcePlannedValuesMap[fmt.Sprintf("aws_nat_gateway.main[%d]", i)]
+				require.NotNil(t, nat, "aws_nat_gateway.main[%d] is not planned", i)
+				if tc.mode == "per_az" {
+					assert.Equal(t, fmt.Sprintf("%s-production-nat-gw-%s", testProjectName, zones[i]), nat.AttributeValues["tags"].(map[string]interface{})["Name"])
+				}
+			}
+
+			for i := 0; i < tc.privateTables; i++ {
+				address := fmt.Sprintf("aws_route_table.private[%d]", i)
+				table := plan.ResourcePlannedValuesMap[address]
+				require.NotNil(t, table, "%s is not planned", address)
+
+				routes, known := plannedRoutes(t, plan, address)
+				if tc.natGateways > 0 {
+					assert.True(t, !known || routes == 1, "%s has %d routes, want a default route", address, routes)
+				} else {
+					assert.True(t, known && routes == 0, "%s has routes without a NAT gateway", address)
+				}
+
+				if tc.mode == "per_az" {
+					assert.Equal(t, fmt.Sprintf("%s-production-private-rt-%s", testProjectName, zones[i]), table.AttributeValues["tags"].(map[string]interface{})["Name"])
+				}
+			}
+			assert.Nil(t, plan.ResourcePlannedValuesMap[fmt.Sprintf("aws_route_table.private[%d]", tc.privateTables)])
+		})
+	}
+}
+
+// TestVpcModuleNATGatewayPerAZApply applies the VPC module in per_az mode
+// against LocalStack and follows each private subnet to its route table, NAT
+// gateway and public subnet, which must all be in the same zone
+func TestVpcModuleNATGatewayPerAZApply(t *testing.T) {
+	if os.Getenv("LOCALSTACK_ENDPOINT") == "" {
+		t.Skip("LOCALSTACK_ENDPOINT is not set")
+	}
+	t.Parallel()
+
+	options := applyOptions(t, moduleOptions(t, "vpc", defaultTags("production"), vpcNATInputs(t, "per_az", 3)))
+	defer terraform.Destroy(t, options)
+	terraform.InitAndApply(t, options)
+
+	resources := stateResources(t, options)
+	byID := func(resourceType string) map[string]map[string]interface{} {
+		found := map[string]map[string]interface{}{}
+		for address, values := range resources {
+			if strings.HasPrefix(address, resourceType+".") {
+				found[values["id"].(string)] = values
+			}
+		}
+		return found
+	}
+	subnets, tables, natGateways := byID("aws_subnet"), byID("aws_route_table"), byID("aws_nat_gateway")
+
+	natGatewayIDs := terraform.OutputList(t, options, "nat_gateway_ids")
+	tableIDs := terraform.OutputList(t, options, "private_route_table_ids")
+	require.Len(t, natGatewayIDs, 3)
+	require.Len(t, tableIDs, 3)
+
+	for i := 0; i < 3; i++ {
+		association := resources[fmt.Sprintf("aws_route_table_association.private[%d]", i)]
+		require.NotNil(t, association)
+		private := subnets[association["subnet_id"].(string)]
+		table := tables[association["route_table_id"].(string)]
+		require.NotNil(t, private)
+		require.NotNil(t, table)
+		assert.Equal(t, tableIDs[i], table["id"], "private subnet %d route table", i)
+
+		routes := table["route"].([]interface{})
+		require.Len(t, routes, 1)
+		nat := natGateways[routes[0].(map[string]interface{})["nat_gateway_id"].(string)]
+		require.NotNil(t, nat)
+		assert.Equal(t, natGatewayIDs[i], nat["id"], "private subnet %d NAT gateway", i)
+
+		public := subnets[nat["subnet_id"].(string)]
+		require.NotNil(t, public)
+		assert.Equal(t, private["availability_zone"], public["availability_zone"], "private subnet %d egresses through another zone", i)
+	}
+}
+
+// stateResources returns the attribute values of the applied resources by
+// address
+func stateResources(t *testing.T, options *terraform.Options) map[string]map[string]interface{} {
+	t.Helper()
+
+	var state tfjson.State
+	require.NoError(t, json.Unmarshal([]byte(terraform.Show(t, options)), &state))
+	require.NotNil(t, state.Values, "state is empty")
+
+	resources := map[string]map[string]interface{}{}
+	for _, r := range state.Values.RootModule.Resources {
+		resources[r.Address] = r.AttributeValues
+	}
+	return resources
+}
+
+// vpcGatewayServices and vpcInterfaceServices are the endpoints requested in
+// the endpoint tests
+var (
+	vpcGatewayServices   = []string{"s3", "dynamodb"}
+	vpcInterfaceServices = []string{"secretsmanager", "ecr.api", "ecr.dkr", "logs", "kms"}
+)
+
+// vpcEndpointInputs returns per_az VPC inputs with every endpoint service
+func vpcEndpointInputs(t *testing.T) map[string]interface{} {
+	t.Helper()
+
+	vars := vpcNATInputs(t, "per_az", 2)
+	vars["gateway_endpoints"] = vpcGatewayServices
+	vars["interface_endpoints"] = vpcInterfaceServices
+	return vars
+}
+
+// configReferences returns the references of a resource argument in the
+// configuration section of a plan. Arguments of nested blocks are written
+// "block.argument" and read from the first block.
+func configReferences(t *testing.T, plan *terraform.PlanStruct, address, argument string) []string {
+	t.Helper()
+
+	require.NotNil(t, plan.RawPlan.Config, "plan has no configuration")
+	for _, r := range plan.RawPlan.Config.RootModule.Resources {
+		if r.Address != address {
+			continue
+		}
+		path := strings.Split(argument, ".")
+		expressions := r.Expressions
+		for _, block := range path[:len(path)-1] {
+			expr, ok := expressions[block]
+			require.True(t, ok && expr.ExpressionData != nil && len(expr.NestedBlocks) > 0, "%s has no %s block", address, block)
+			expressions = expr.NestedBlocks[0]
+		}
+		expr, ok := expressions[path[len(path)-1]]
+		require.True(t, ok && expr.ExpressionData != nil, "%s has no %s", address, argument)
+		return expr.References
+	}
+	require.Failf(t, "resource not in configuration", "%s", address)
+	return nil
+}
+
+// TestVpcModuleEndpointConditions tests the endpoint validations and the
+// private DNS precondition without running terraform
+func TestVpcModuleEndpointConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "vpc"))
+	require.NoError(t, err)
+
+	failures, err := mod.CheckConditions(vpcEndpointInputs(t))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{
+			name:    "InterfaceOnlyService",
+			vars:    map[string]interface{}{"gateway_endpoints": []string{"s3", "secretsmanager"}},
+			subject: "var.gateway_endpoints",
+		},
+		{
+			name:    "FullServiceName",
+			vars:    map[string]interface{}{"interface_endpoints": []string{"com.amazonaws.us-east-1.kms"}},
+			subject: "var.interface_endpoints",
+		},
+		{
+			name:    "GatewayServiceAsInterface",
+			vars:    map[string]interface{}{"interface_endpoints": []string{"s3"}},
+			subject: "var.interface_endpoints",
+		},
+		{
+			name:    "PrivateDNSWithoutDNSHostnames",
+			vars:    map[string]interface{}{"enable_dns_hostnames": false},
+			subject: "aws_vpc_endpoint.interface",
+		},
+	}
+
+	for _, tc := range invalid {
+		vars := vpcEndpointInputs(t)
+		for k, v := range tc.vars {
+			vars[k] = v
+		}
+
+		failures, err := mod.CheckConditions(vars)
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+}
+
+// TestVpcModuleEndpoints tests that every requested gateway endpoint is
+// attached to the private route tables and every interface endpoint to the
+// private subnets, with private DNS and the endpoint security group
+func TestVpcModuleEndpoints(t *testing.T) {
+	t.Parallel()
+
+	plan := planModule(t, "vpc", "production", vpcEndpointInputs(t))
+
+	var want []string
+	for _, service := range vpcGatewayServices {
+		want = append(want, fmt.Sprintf("aws_vpc_endpoint.gateway[%q]", service))
+	}
+	for _, service := range vpcInterfaceServices {
+		want = append(want, fmt.Sprintf("aws_vpc_endpoint.interface[%q]", service))
+	}
+	assert.ElementsMatch(t, want, resourceAddresses(plan, "aws_vpc_endpoint"))
+
+	for _, service := range vpcGatewayServices {
+		address := fmt.Sprintf("aws_vpc_endpoint.gateway[%q]", service)
+		endpoint := plan.ResourcePlannedValuesMap[address]
+		require.NotNil(t, endpoint, "%s is not planned", address)
+		assert.Equal(t, fmt.Sprintf("com.amazonaws.%s.%s", testRegion, service), endpoint.AttributeValues["service_name"])
+		assert.Equal(t, "Gateway", endpoint.AttributeValues["vpc_endpoint_type"])
+	}
+	assert.Contains(t, configReferences(t, plan, "aws_vpc_endpoint.gateway", "route_table_ids"), "aws_route_table.private")
+	assert.NotContains(t, configReferences(t, plan, "aws_vpc_endpoint.gateway", "route_table_ids"), "aws_route_table.public")
+
+	for _, service := range vpcInterfaceServices {
+		address := fmt.Sprintf("aws_vpc_endpoint.interface[%q]", service)
+		endpoint := plan.ResourcePlannedValuesMap[address]
+		require.NotNil(t, endpoint, "%s is not planned", address)
+		assert.Equal(t, fmt.Sprintf("com.amazonaws.%s.%s", testRegion, service), endpoint.AttributeValues["service_name"])
+		assert.Equal(t, "Interface", endpoint.AttributeValues["vpc_endpoint_type"])
+		assert.Equal(t, true, endpoint.AttributeValues["private_dns_enabled"])
+	}
+	assert.Contains(t, configReferences(t, plan, "aws_vpc_endpoint.interface", "subnet_ids"), "aws_subnet.private")
+	assert.NotContains(t, configReferences(t, plan, "aws_vpc_endpoint.interface", "subnet_ids"), "aws_subnet.public")
+	assert.Contains(t, configReferences(t, plan, "aws_vpc_endpoint.interface", "security_group_ids"), "aws_security_group.vpc_endpoints")
+
+	sg := plan.ResourcePlannedValuesMap["aws_security_group.vpc_endpoints[0]"]
+	require.NotNil(t, sg, "aws_security_group.vpc_endpoints[0] is not planned")
+	ingress, ok := sg.AttributeValues["ingress"].([]interface{})
+	require.True(t, ok && len(ingress) == 1, "expected one ingress rule")
+	rule := ingress[0].(map[string]interface{})
+	assert.EqualValues(t, 443, rule["from_port"])
+	assert.EqualValues(t, 443, rule["to_port"])
+	assert.Equal(t, []interface{}{"10.1.0.0/16"}, rule["cidr_blocks"])
+}
+
+// TestVpcModuleWithoutEndpoints tests that no endpoint or endpoint security
+// group is planned by default
+func TestVpcModuleWithoutEndpoints(t *testing.T) {
+	t.Parallel()
+
+	vars := vpcNATInputs(t, "single", 2)
+	delete(vars, "gateway_endpoints")
+	delete(vars, "interface_endpoints")
+
+	plan := planModule(t, "vpc", "production", vars)
+	assert.Empty(t, resourceAddresses(plan, "aws_vpc_endpoint"))
+	assert.Nil(t, plan.ResourcePlannedValuesMap["aws_security_group.vpc_endpoints[0]"])
+}
+
+// TestVpcModuleEndpointsApply applies the VPC module with every endpoint
+// against LocalStack and checks the endpoint route tables and subnets by ID
+func TestVpcModuleEndpointsApply(t *testing.T) {
+	if os.Getenv("LOCALSTACK_ENDPOINT") == "" {
+		t.Skip("LOCALSTACK_ENDPOINT is not set")
+	}
+	t.Parallel()
+
+	options := applyOptions(t, moduleOptions(t, "vpc", defaultTags("production"), vpcEndpointInputs(t)))
+	defer terraform.Destroy(t, options)
+	terraform.InitAndApply(t, options)
+
+	resources := stateResources(t, options)
+	tableIDs := terraform.OutputList(t, options, "private_route_table_ids")
+	subnetIDs := terraform.OutputList(t, options, "private_subnet_ids")
+	endpointIDs := terraform.OutputMap(t, options, "vpc_endpoint_ids")
+
+	for _, service := range vpcGatewayServices {
+		endpoint := resources[fmt.Sprintf("aws_vpc_endpoint.gateway[%q]", service)]
+		require.NotNil(t, endpoint, service)
+		assert.ElementsMatch(t, tableIDs, endpoint["route_table_ids"], "%s route tables", service)
+		assert.Equal(t, endpointIDs[service], endpoint["id"])
+	}
+	for _, service := range vpcInterfaceServices {
+		endpoint := resources[fmt.Sprintf("aws_vpc_endpoint.interface[%q]", service)]
+		require.NotNil(t, endpoint, service)
+		assert.ElementsMatch(t, subnetIDs, endpoint["subnet_ids"], "%s subnets", service)
+		assert.Equal(t, endpointIDs[service], endpoint["id"])
+	}
+}
+
+// vpcFlowLogCases are flow log destinations with the resources they need
+var vpcFlowLogCases = []struct {
+	name        string
+	vars        map[string]interface{}
+	destination string
+	logGroup    bool
+	bucket      bool
+}{
+	{
+		name:        "CloudWatch",
+		vars:        map[string]interface{}{},
+		destination: "cloud-watch-logs",
+		logGroup:    true,
+	},
+	{
+		name: "CloudWatchRejectedCustomFormat",
+		vars: map[string]interface{}{
+			"flow_log_traffic_type":             "REJECT",
+			"flow_log_format_fields":            []string{"srcaddr", "dstaddr", "dstport", "action"},
+			"flow_log_max_aggregation_interval": 60,
+			"flow_log_retention_in_days":        30,
+		},
+		destination: "cloud-watch-logs",
+		logGroup:    true,
+	},
+	{
+		name:        "S3CreatedBucket",
+		vars:        map[string]interface{}{"flow_log_destination_type": "s3"},
+		destination: "s3",
+		bucket:      true,
+	},
+	{
+		name: "S3CreatedBucketParquetHive",
+		vars: map[string]interface{}{
+			"flow_log_destination_type":           "s3",
+			"flow_log_file_format":                "parquet",
+			"flow_log_hive_compatible_partitions": true,
+			"flow_log_per_hour_partition":         true,
+			"flow_log_retention_in_days":          400,
+		},
+		destination: "s3",
+		bucket:      true,
+	},
+	{
+		name: "S3ExistingBucket",
+		vars: map[string]interface{}{
+			"flow_log_destination_type": "s3",
+			"flow_log_s3_bucket_arn":    "arn:aws:s3:::gogs-fork-security-flow-logs/vpc",
+			"flow_log_file_format":      "parquet",
+		},
+		destination: "s3",
+	},
+}
+
+// vpcFlowLogInputs returns the staging VPC inputs with the flow log
+// variables of a case
+func vpcFlowLogInputs(t *testing.T, vars map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	inputs := environmentInputs(t, "staging", "vpc")
+	for k, v := range vars {
+		inputs[k] = v
+	}
+	return inputs
+}
+
+// TestVpcModuleFlowLogConditions tests the flow log validations and
+// preconditions without running terraform
+func TestVpcModuleFlowLogConditions(t *testing.T) {
+	t.Parallel()
+
+	mod, err := tfmodule.Load(filepath.Join(repoRoot, "modules", "vpc"))
+	require.NoError(t, err)
+
+	for _, tc := range vpcFlowLogCases {
+		failures, err := mod.CheckConditions(vpcFlowLogInputs(t, tc.vars))
+		require.NoError(t, err)
+		assert.Empty(t, failures, tc.name)
+	}
+
+	invalid := []struct {
+		name    string
+		vars    map[string]interface{}
+		subject string
+	}{
+		{
+			name:    "UnsupportedDestination",
+			vars:    map[string]interface{}{"flow_log_destination_type": "kinesis-data-firehose"},
+			subject: "var.flow_log_destination_type",
+		},
+		{
+			name:    "UnsupportedTrafficType",
+			vars:    map[string]interface{}{"flow_log_traffic_type": "DENY"},
+			subject: "var.flow_log_traffic_type",
+		},
+		{
+			name:    "WrappedFormatField",
+			vars:    map[string]interface{}{"flow_log_format_fields": []string{"${srcaddr}"}},
+			subject: "var.flow_log_format_fields",
+		},
+		{
+			name:    "UnsupportedAggregationInterval",
+			vars:    map[string]interface{}{"flow_log_max_aggregation_interval": 300},
+			subject: "var.flow_log_max_aggregation_interval",
+		},
+		{
+			name:    "CloudWatchRetention",
+			vars:    map[string]interface{}{"flow_log_retention_in_days": 10},
+			subject: "aws_cloudwatch_log_group.vpc_flow_logs",
+		},
+		{
+			name:    "ParquetToCloudWatch",
+			vars:    map[string]interface{}{"flow_log_file_format": "parquet"},
+			subject: "aws_flow_log.main",
+		},
+		{
+			name:    "BucketName",
+			vars:    map[string]interface{}{"flow_log_destination_type": "s3", "flow_log_s3_bucket_arn": "gogs-fork-flow-logs"},
+			subject: "var.flow_log_s3_bucket_arn",
+		},
+	}
+
+	for _, tc := range invalid {
+		failures, err := mod.CheckConditions(vpcFlowLogInputs(t, tc.vars))
+		require.NoError(t, err)
+
+		var subjects []string
+		for _, f := range failures {
+			subjects = append(subjects, f.Subject)
+		}
+		assert.Contains(t, subjects, tc.subject, tc.name)
+	}
+
+	// Any whole number of days is a valid S3 expiration
+	failures, err := mod.CheckConditions(vpcFlowLogInputs(t, map[string]interface{}{"flow_log_destination_type": "s3", "flow_log_retention_in_days": 10}))
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+}
+
+// TestVpcModuleFlowLogDestinations tests the flow log and the resources
+// planned for each destination. The IAM role is only created for CloudWatch
+// Logs.
+func TestVpcModuleFlowLogDestinations(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range vpcFlowLogCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			vars := vpcFlowLogInputs(t, tc.vars)
+			plan := planModule(t, "vpc", "staging", vars)
+
+			flowLog := plan.ResourcePlannedValuesMap["aws_flow_log.main"]
+			require.NotNil(t, flowLog, "aws_flow_log.main is not planned")
+			assert.Equal(t, tc.destination, flowLog.AttributeValues["log_destination_type"])
+			assert.Equal(t, valueOr(vars, "flow_log_traffic_type", "ALL"), flowLog.AttributeValues["traffic_type"])
+			assert.EqualValues(t, valueOr(vars, "flow_log_max_aggregation_interval", 600), flowLog.AttributeValues["max_aggregation_interval"])
+
+			if fields, ok := vars["flow_log_format_fields"].([]string); ok {
+				wrapped := make([]string, 0, len(fields))
+				for _, field := range fields {
+					wrapped = append(wrapped, "${"+field+"}")
+				}
+				assert.Equal(t, strings.Join(wrapped, " "), flowLog.AttributeValues["log_format"])
+			}
+
+			options, _ := flowLog.AttributeValues["destination_options"].([]interface{})
+			if tc.destination == "s3" {
+				require.Len(t, options, 1)
+				option := options[0].(map[string]interface{})
+				assert.Equal(t, valueOr(vars, "flow_log_file_format", "plain-text"), option["file_format"])
+				assert.Equal(t, valueOr(vars, "flow_log_hive_compatible_partitions", false), option["hive_compatible_partitions"])
+				assert.Equal(t, valueOr(vars, "flow_log_per_hour_partition", false), option["per_hour_partition"])
+				assert.Nil(t, flowLog.AttributeValues["iam_role_arn"])
+			} else {
+				assert.Empty(t, options)
+			}
+
+			assert.Equal(t, tc.logGroup, len(resourceAddresses(plan, "aws_iam_role")) == 1, "IAM role")
+			assert.Equal(t, tc.logGroup, len(resourceAddresses(plan, "aws_iam_role_policy")) == 1, "IAM role policy")
+
+			logGroup := plan.ResourcePlannedValuesMap["aws_cloudwatch_log_group.vpc_flow_logs[0]"]
+			assert.Equal(t, tc.logGroup, logGroup != nil, "log group")
+			if logGroup != nil {
+				assert.EqualValues(t, vars["flow_log_retention_in_days"], logGroup.AttributeValues["retention_in_days"])
+			}
+
+			assert.Equal(t, tc.bucket, len(resourceAddresses(plan, "aws_s3_bucket")) == 1, "S3 bucket")
+			assert.Equal(t, tc.bucket, len(resourceAddresses(plan, "aws_s3_bucket_policy")) == 1, "S3 bucket policy")
+			if tc.bucket {
+				lifecycle := plan.ResourcePlannedValuesMap["aws_s3_bucket_lifecycle_configuration.flow_logs[0]"]
+				require.NotNil(t, lifecycle, "bucket lifecycle is not planned")
+				rules := lifecycle.AttributeValues["rule"].([]interface{})
+				require.Len(t, rules, 1)
+				expiration := rules[0].(map[string]interface{})["expiration"].([]interface{})
+				require.Len(t, expiration, 1)
+				assert.EqualValues(t, vars["flow_log_retention_in_days"], expiration[0].(map[string]interface{})["days"])
+			}
+
+			if arn, ok := vars["flow_log_s3_bucket_arn"]; ok {
+				assert.Equal(t, arn, flowLog.AttributeValues["log_destination"])
+			}
+		})
+	}
+}
+
+// TestVpcModuleFlowLogBucketPolicy tests that the created bucket lets log
+// delivery write under the account prefix of each partition layout, and only
+// for this account
+func TestVpcModuleFlowLogBucketPolicy(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		hive          bool
+		accountPrefix string
+	}{
+		{"Plain", false, `[0-9]{12}`},
+		{"HiveCompatible", true, `aws-account-id=[0-9]{12}`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			vars := vpcFlowLogInputs(t, map[string]interface{}{
+				"flow_log_destination_type":           "s3",
+				"flow_log_hive_compatible_partitions": tc.hive,
+			})
+			plan := planModule(t, "vpc", "staging", vars)
+
+			bucket := plan.ResourcePlannedValuesMap["aws_s3_bucket.flow_logs[0]"]
+			require.NotNil(t, bucket, "aws_s3_bucket.flow_logs[0] is not planned")
+			bucketName, ok := bucket.AttributeValues["bucket"].(string)
+			require.True(t, ok, "flow log bucket name is unknown until apply")
+
+			policy := plan.ResourcePlannedValuesMap["aws_s3_bucket_policy.flow_logs[0]"]
+			require.NotNil(t, policy, "aws_s3_bucket_policy.flow_logs[0] is not planned")
+			var document struct {
+				Statement []struct {
+					Sid       string
+					Resource  interface{}
+					Condition map[string]map[string]string
+				}
+			}
+			require.NoError(t, json.Unmarshal([]byte(policy.AttributeValues["policy"].(string)), &document))
+			require.Len(t, document.Statement, 2)
+
+			write := document.Statement[0]
+			assert.Equal(t, "AWSLogDeliveryWrite", write.Sid)
+			assert.Regexp(t, `^arn:aws:s3:::`+bucketName+`/AWSLogs/`+tc.accountPrefix+`/\*$`, write.Resource)
+
+			account := bucketName[len(bucketName)-12:]
+			for _, statement := range document.Statement {
+				assert.Equal(t, account, statement.Condition["StringEquals"]["aws:SourceAccount"], statement.Sid)
+			}
+		})
+	}
+}
+
+// valueOr returns vars[name], or def when it is not set
+func valueOr(vars map[string]interface{}, name string, def interface{}) interface{} {
+	if v, ok := vars[name]; ok {
+		return v
+	}
+	return def
+}